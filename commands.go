@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Pijuyy/testing_project4/models"
+	"github.com/Pijuyy/testing_project4/service"
+	"gorm.io/gorm"
+)
+
+// runCommand runs one of the maintenance commands:
+//
+//	import-products [-dry-run] [-mode atomic|best_effort] [-actor email] file.csv
+//	export-products [file.csv]
+func runCommand(db *gorm.DB, name string, args []string) error {
+	switch name {
+	case "import-products":
+		return importProductsCommand(db, args)
+	case "export-products":
+		return exportProductsCommand(db, args)
+	default:
+		return fmt.Errorf("unknown command %q", name)
+	}
+}
+
+func importProductsCommand(db *gorm.DB, args []string) error {
+	flags := flag.NewFlagSet("import-products", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "validate the file without saving anything")
+	mode := flags.String("mode", service.ImportAtomic, "atomic or best_effort")
+	actorEmail := flags.String("actor", "", "email of the user recorded in the audit log")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: import-products [-dry-run] [-mode atomic|best_effort] [-actor email] file.csv")
+	}
+
+	var actor *models.User
+	if *actorEmail != "" {
+		actor = &models.User{}
+		if err := db.Where("email = ?", *actorEmail).First(actor).Error; err != nil {
+			return fmt.Errorf("actor %s not found", *actorEmail)
+		}
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// Running the CLI requires database access, so stock changes are allowed
+	result, err := service.ImportProducts(db, file, service.ImportOptions{
+		Mode:           *mode,
+		DryRun:         *dryRun,
+		Actor:          actor,
+		CanAdjustStock: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(result); err != nil {
+		return err
+	}
+	if result.Failed > 0 {
+		return fmt.Errorf("%d rows failed", result.Failed)
+	}
+	return nil
+}
+
+func exportProductsCommand(db *gorm.DB, args []string) error {
+	var out io.Writer = os.Stdout
+	if len(args) > 0 {
+		file, err := os.Create(args[0])
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+
+	return service.ExportProducts(db, out)
+}
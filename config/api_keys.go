@@ -0,0 +1,63 @@
+package config
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/Pijuyy/testing_project4/models"
+	"gorm.io/gorm"
+)
+
+// HashToken returns the SHA-256 hash of a secret token, which is what gets
+// stored in the database for API keys and verification tokens.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func authenticateAPIKey(db *gorm.DB, key string) (*Claims, *models.User, error) {
+	lookup, ok := models.APIKeyLookup(key)
+	if !ok {
+		return nil, nil, errors.New("Invalid API key")
+	}
+
+	var apiKey models.APIKey
+	if err := db.Where("lookup = ?", lookup).First(&apiKey).Error; err != nil {
+		return nil, nil, errors.New("Invalid API key")
+	}
+	if subtle.ConstantTimeCompare([]byte(HashToken(key)), []byte(apiKey.KeyHash)) != 1 {
+		return nil, nil, errors.New("Invalid API key")
+	}
+
+	now := time.Now()
+	if apiKey.RevokedAt != nil {
+		return nil, nil, errors.New("API key has been revoked")
+	}
+	if apiKey.IsExpired(now) {
+		return nil, nil, errors.New("API key has expired")
+	}
+
+	var user models.User
+	if err := db.First(&user, apiKey.UserID).Error; err != nil {
+		return nil, nil, errors.New("User not found")
+	}
+	if err := checkUserActive(&user); err != nil {
+		return nil, nil, err
+	}
+
+	// Best effort; a failed timestamp update should not reject the request
+	db.Model(&apiKey).UpdateColumn("last_used_at", now)
+
+	claims := &Claims{
+		UserID:   user.ID,
+		Email:    user.Email,
+		Role:     user.Role,
+		APIKeyID: apiKey.ID,
+		Scopes:   apiKey.ScopeList(),
+	}
+
+	return claims, &user, nil
+}
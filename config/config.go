@@ -1,99 +1,118 @@
-package config
-
-import (
-	"encoding/json"
-	"errors"
-	"net/http"
-	"os"
-	"strings"
-
-	"github.com/Pijuyy/testing_project4/models"
-	"github.com/golang-jwt/jwt/v4"
-	"gorm.io/gorm"
-)
-
-var JwtKey = []byte(os.Getenv("JWT_KEY"))
-
-func init() {
-	if len(JwtKey) == 0 {
-		JwtKey = []byte("bMLRrApp4zf6qzWoMa-brT6HMwG5Lp5VY8l1Y-K34Xwsm8B3-kB9p7pcRoWKP8jafaTuCylxPMllgz6uFT6zfQ") // Fallback key
-	}
-}
-
-func SendJSONResponse(w http.ResponseWriter, v interface{}) {
-	encoder := json.NewEncoder(w)
-	encoder.SetIndent("", "  ")
-	encoder.Encode(v)
-}
-
-func ExtractUserFromToken(r *http.Request, db *gorm.DB) (*models.User, error) {
-	claims, err := Authenticate(r, db)
-	if err != nil {
-		return nil, err
-	}
-
-	var user models.User
-	if err := db.Where("email = ?", claims.Email).First(&user).Error; err != nil {
-		return nil, errors.New("User not found")
-	}
-
-	return &user, nil
-}
-
-type Claims struct {
-	UserID uint   `json:"user_id"`
-	Email  string `json:"email"`
-	Role   string `json:"role"`
-	jwt.RegisteredClaims
-}
-
-func Authenticate(r *http.Request, db *gorm.DB) (*Claims, error) {
-	authHeader := r.Header.Get("Authorization")
-	authHeaderParts := strings.Split(authHeader, " ")
-	if len(authHeaderParts) != 2 || authHeaderParts[0] != "Bearer" {
-		return nil, errors.New("Authorization header must be in the format 'Bearer {token}'")
-	}
-	tokenString := authHeaderParts[1]
-
-	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return JwtKey, nil
-	})
-
-	if err != nil {
-		return nil, errors.New("Invalid token")
-	}
-
-	if !token.Valid {
-		return nil, errors.New("Invalid token")
-	}
-
-	// Fetch user based on the email from claims
-	var user models.User
-	if err := db.Where("email = ?", claims.Email).First(&user).Error; err != nil {
-		return nil, errors.New("User not found")
-	}
-
-	// Set the correct UserID in the claims
-	claims.UserID = user.ID
-
-	return claims, nil
-}
-
-func AuthenticateAndAuthorize(r *http.Request, db *gorm.DB) (bool, error) {
-	claims, err := Authenticate(r, db)
-	if err != nil {
-		return false, err
-	}
-
-	var user models.User
-	if err := db.Where("email = ?", claims.Email).First(&user).Error; err != nil {
-		return false, errors.New("User not found")
-	}
-
-	if user.Role != "admin" {
-		return false, errors.New("Unauthorized access")
-	}
-
-	return true, nil
-}
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/Pijuyy/testing_project4/models"
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+)
+
+var JwtKey = []byte(os.Getenv("JWT_KEY"))
+
+func init() {
+	if len(JwtKey) == 0 {
+		JwtKey = []byte("bMLRrApp4zf6qzWoMa-brT6HMwG5Lp5VY8l1Y-K34Xwsm8B3-kB9p7pcRoWKP8jafaTuCylxPMllgz6uFT6zfQ") // Fallback key
+	}
+}
+
+func SendJSONResponse(w http.ResponseWriter, v interface{}) {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
+}
+
+func ExtractUserFromToken(r *http.Request, db *gorm.DB) (*models.User, error) {
+	_, user, err := authenticateUser(r, db)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+type Claims struct {
+	UserID uint   `json:"user_id"`
+	Email  string `json:"email"`
+	Role   string `json:"role"`
+	jwt.RegisteredClaims
+
+	// Set when the request was authenticated with an API key instead of a JWT.
+	// Scopes limit the permissions of the key to a subset of the user's role,
+	// plus any owner scopes such as models.ScopeOrdersCreate.
+	APIKeyID uint     `json:"-"`
+	Scopes   []string `json:"-"`
+}
+
+func Authenticate(r *http.Request, db *gorm.DB) (*Claims, error) {
+	claims, _, err := authenticateUser(r, db)
+	return claims, err
+}
+
+func authenticateUser(r *http.Request, db *gorm.DB) (*Claims, *models.User, error) {
+	// API keys may be sent in their own header or as a Bearer token
+	if apiKey := r.Header.Get("X-API-Key"); apiKey != "" {
+		return authenticateAPIKey(db, apiKey)
+	}
+
+	authHeader := r.Header.Get("Authorization")
+	authHeaderParts := strings.Split(authHeader, " ")
+	if len(authHeaderParts) != 2 || authHeaderParts[0] != "Bearer" {
+		return nil, nil, errors.New("Authorization header must be in the format 'Bearer {token}'")
+	}
+	tokenString := authHeaderParts[1]
+
+	if strings.HasPrefix(tokenString, models.APIKeyPrefix) {
+		return authenticateAPIKey(db, tokenString)
+	}
+
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return JwtKey, nil
+	})
+
+	if err != nil {
+		return nil, nil, errors.New("Invalid token")
+	}
+
+	if !token.Valid {
+		return nil, nil, errors.New("Invalid token")
+	}
+
+	// Fetch user based on the ID from claims, so tokens survive an email change.
+	// Tokens issued before the ID was added to the claims fall back to the email.
+	var user models.User
+	query := db.Where("email = ?", claims.Email)
+	if claims.UserID != 0 {
+		query = db.Where("id = ?", claims.UserID)
+	}
+	if err := query.First(&user).Error; err != nil {
+		return nil, nil, errors.New("User not found")
+	}
+
+	if err := checkUserActive(&user); err != nil {
+		return nil, nil, err
+	}
+
+	// Set the correct UserID in the claims
+	claims.UserID = user.ID
+
+	return claims, &user, nil
+}
+
+// checkUserActive rejects suspended and deleted accounts, which keep their
+// data but can no longer use the API.
+func checkUserActive(user *models.User) error {
+	if user.Status == models.UserStatusSuspended {
+		return errors.New("User account is suspended")
+	}
+	if !user.IsActive() {
+		return errors.New("User account is no longer active")
+	}
+
+	return nil
+}
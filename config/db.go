@@ -1,51 +1,113 @@
-package config
-
-import (
-	"fmt"
-	"os"
-
-	"github.com/Pijuyy/testing_project4/models"
-	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
-)
-
-// var (
-// 	host     = os.Getenv("PGHOST")
-// 	user     = os.Getenv("PGUSER")
-// 	password = os.Getenv("PGPASSWORD")
-// 	dbPort   = os.Getenv("PGPORT")
-// 	dbname   = os.Getenv("PGDATABASE")
-// 	// host       = "localhost"
-// 	// user       = "postgres"
-// 	// password   = "postgres890"
-// 	// dbPort     = "5432"
-// 	// dbname     = "mygram"
-// 	// debug_mode = os.Getenv("DEBUG_MODE")
-// 	DB  *gorm.DB
-// 	err error
-// )
-
-func ConnectDB() (*gorm.DB, error) {
-	dsn := os.Getenv("DATABASE_URL")
-	if dsn == "" {
-		dsn = "host=localhost user=postgres dbname=baru password=Hafidzurr1 sslmode=disable" // Lokal DB config
-		// dsn = fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable", host, user, password, dbname, dbPort)
-	}
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
-	if err != nil {
-		fmt.Println("Failed to connect to the database. Error:", err)
-		return nil, err
-	}
-
-	// Call Migrate function to perform database migrations
-	if err := Migrate(db); err != nil {
-		fmt.Println("Failed to perform database migrations. Error:", err)
-		return nil, err
-	}
-
-	return db, nil
-}
-
-func Migrate(db *gorm.DB) error {
-	return db.AutoMigrate(&models.User{}, &models.Category{}, &models.Product{}, &models.TransactionHistory{})
-}
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/Pijuyy/testing_project4/models"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// var (
+// 	host     = os.Getenv("PGHOST")
+// 	user     = os.Getenv("PGUSER")
+// 	password = os.Getenv("PGPASSWORD")
+// 	dbPort   = os.Getenv("PGPORT")
+// 	dbname   = os.Getenv("PGDATABASE")
+// 	// host       = "localhost"
+// 	// user       = "postgres"
+// 	// password   = "postgres890"
+// 	// dbPort     = "5432"
+// 	// dbname     = "mygram"
+// 	// debug_mode = os.Getenv("DEBUG_MODE")
+// 	DB  *gorm.DB
+// 	err error
+// )
+
+func ConnectDB() (*gorm.DB, error) {
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		dsn = "host=localhost user=postgres dbname=baru password=Hafidzurr1 sslmode=disable" // Lokal DB config
+		// dsn = fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable", host, user, password, dbname, dbPort)
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		fmt.Println("Failed to connect to the database. Error:", err)
+		return nil, err
+	}
+
+	// Call Migrate function to perform database migrations
+	if err := Migrate(db); err != nil {
+		fmt.Println("Failed to perform database migrations. Error:", err)
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func Migrate(db *gorm.DB) error {
+	err := db.AutoMigrate(
+		&models.User{}, &models.Category{}, &models.Product{}, &models.TransactionHistory{},
+		&models.BalanceAdjustment{}, &models.Permission{}, &models.Role{}, &models.APIKey{}, &models.AuditLog{},
+		&models.InventoryMovement{}, &models.StockAlert{}, &models.Warehouse{}, &models.WarehouseStock{},
+		&models.StockTransfer{}, &models.Reservation{}, &models.ProductVariant{}, &models.ProductImage{},
+		&models.Review{}, &models.WishlistItem{}, &models.Notification{},
+		&models.Promotion{}, &models.PromotionRedemption{}, &models.PriceSchedule{}, &models.PriceChange{},
+		&models.ExchangeRate{}, &models.TaxRate{}, &models.Address{},
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := runMigrations(db); err != nil {
+		return err
+	}
+
+	if err := backfillInventoryMovements(db); err != nil {
+		return err
+	}
+
+	if err := backfillWarehouseStock(db); err != nil {
+		return err
+	}
+
+	return SeedRoles(db)
+}
+
+// backfillInventoryMovements records an opening balance for products that
+// existed before stock movements were tracked, so their stock reconciles.
+func backfillInventoryMovements(db *gorm.DB) error {
+	return db.Exec(`INSERT INTO inventory_movements (product_id, type, quantity, stock_after, reason, created_at)
+		SELECT p.id, ?, p.stock, p.stock, 'opening balance', NOW() FROM products p
+		WHERE p.stock <> 0 AND NOT EXISTS (SELECT 1 FROM inventory_movements m WHERE m.product_id = p.id)`,
+		models.MovementCorrection).Error
+}
+
+// backfillWarehouseStock creates a default warehouse when there is none and
+// places the stock of products that have no warehouse levels yet in it.
+func backfillWarehouseStock(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var warehouse models.Warehouse
+		err := tx.Order("priority, id").First(&warehouse).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			warehouse = models.Warehouse{Code: "MAIN", Name: "Main warehouse", Active: true}
+			if err := tx.Create(&warehouse).Error; err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+
+		err = tx.Exec(`INSERT INTO warehouse_stocks (warehouse_id, product_id, quantity, updated_at)
+			SELECT ?, p.id, p.stock, NOW() FROM products p
+			WHERE p.stock <> 0 AND NOT EXISTS (SELECT 1 FROM warehouse_stocks ws WHERE ws.product_id = p.id)`,
+			warehouse.ID).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&models.InventoryMovement{}).Where("warehouse_id IS NULL").Update("warehouse_id", warehouse.ID).Error
+	})
+}
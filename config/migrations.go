@@ -0,0 +1,150 @@
+package config
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// migration is a versioned SQL change for what AutoMigrate cannot express,
+// such as extensions, generated columns and special indexes.
+type migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// schemaMigration records an applied migration.
+type schemaMigration struct {
+	Version   int    `gorm:"primaryKey;autoIncrement:false"`
+	Name      string `gorm:"not null"`
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// migrations are applied in order, each exactly once. Never change a
+// migration that has been released; add a new one instead.
+var migrations = []migration{
+	{
+		Version: 1,
+		Name:    "product_search",
+		// The simple configuration does not stem words, as titles mix languages
+		SQL: `CREATE EXTENSION IF NOT EXISTS pg_trgm;
+ALTER TABLE products ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+	setweight(to_tsvector('simple', coalesce(title, '')), 'A') ||
+	setweight(to_tsvector('simple', coalesce(description, '')), 'B')
+) STORED;
+CREATE INDEX IF NOT EXISTS idx_products_search_vector ON products USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS idx_products_title_trgm ON products USING GIN (title gin_trgm_ops);`,
+	},
+	{
+		Version: 2,
+		Name:    "transaction_subtotals",
+		// Transactions before promotions paid their full subtotal
+		SQL: `UPDATE transaction_histories SET subtotal = total_price WHERE subtotal = 0 AND discount = 0;`,
+	},
+	{
+		Version: 3,
+		Name:    "money_bigint",
+		// Amounts are models.Money, stored as 64-bit minor units
+		SQL: `ALTER TABLE products ALTER COLUMN price TYPE bigint;
+ALTER TABLE product_variants ALTER COLUMN price_override TYPE bigint;
+ALTER TABLE transaction_histories ALTER COLUMN total_price TYPE bigint, ALTER COLUMN subtotal TYPE bigint, ALTER COLUMN discount TYPE bigint;
+ALTER TABLE users ALTER COLUMN balance TYPE bigint;
+ALTER TABLE balance_adjustments ALTER COLUMN amount TYPE bigint, ALTER COLUMN balance_before TYPE bigint, ALTER COLUMN balance_after TYPE bigint;
+ALTER TABLE price_schedules ALTER COLUMN sale_price TYPE bigint;
+ALTER TABLE price_changes ALTER COLUMN old_price TYPE bigint, ALTER COLUMN new_price TYPE bigint;
+ALTER TABLE promotions ALTER COLUMN min_spend TYPE bigint;
+ALTER TABLE promotion_redemptions ALTER COLUMN discount TYPE bigint;`,
+	},
+	{
+		Version: 4,
+		Name:    "transaction_charged_amounts",
+		// Wallets were all in the base currency before exchange rates
+		SQL: `UPDATE transaction_histories SET charged_amount = total_price WHERE charged_amount = 0;`,
+	},
+	{
+		Version: 5,
+		Name:    "variant_product_stock",
+		// Products with variants are only sold through them, so stock and
+		// reservations left on the product itself move to its first variant
+		SQL: `CREATE TEMPORARY TABLE first_variants ON COMMIT DROP AS
+	SELECT product_id, MIN(id) AS variant_id FROM product_variants GROUP BY product_id;
+CREATE TEMPORARY TABLE moved_stock ON COMMIT DROP AS
+	SELECT ws.warehouse_id, ws.product_id, fv.variant_id, ws.quantity
+	FROM warehouse_stocks ws JOIN first_variants fv ON fv.product_id = ws.product_id
+	WHERE ws.variant_id = 0 AND ws.quantity > 0;
+INSERT INTO warehouse_stocks (warehouse_id, product_id, variant_id, quantity, updated_at)
+	SELECT warehouse_id, product_id, variant_id, quantity, now() FROM moved_stock
+	ON CONFLICT (warehouse_id, product_id, variant_id)
+	DO UPDATE SET quantity = warehouse_stocks.quantity + EXCLUDED.quantity, updated_at = EXCLUDED.updated_at;
+DELETE FROM warehouse_stocks ws USING moved_stock m
+	WHERE ws.warehouse_id = m.warehouse_id AND ws.product_id = m.product_id AND ws.variant_id = 0;
+UPDATE product_variants v SET stock = v.stock + m.quantity
+	FROM (SELECT variant_id, SUM(quantity) AS quantity FROM moved_stock GROUP BY variant_id) m
+	WHERE v.id = m.variant_id;
+INSERT INTO inventory_movements (product_id, variant_id, warehouse_id, type, quantity, stock_after, reason, created_at)
+	SELECT m.product_id, legs.variant_id, m.warehouse_id, 'transfer', legs.quantity, p.stock, 'moved to the first variant', now()
+	FROM moved_stock m JOIN products p ON p.id = m.product_id
+	CROSS JOIN LATERAL (VALUES (NULL::bigint, -m.quantity), (m.variant_id::bigint, m.quantity)) AS legs(variant_id, quantity);
+UPDATE product_variants v SET reserved = v.reserved + r.quantity
+	FROM (SELECT fv.variant_id, SUM(r.quantity) AS quantity
+		FROM reservations r JOIN first_variants fv ON fv.product_id = r.product_id
+		WHERE r.variant_id IS NULL AND r.status = 'active' GROUP BY fv.variant_id) r
+	WHERE v.id = r.variant_id;
+UPDATE reservations r SET variant_id = fv.variant_id FROM first_variants fv
+	WHERE r.product_id = fv.product_id AND r.variant_id IS NULL AND r.status = 'active';`,
+	},
+	{
+		Version: 6,
+		Name:    "customer_catalog_read",
+		// Customers browse the catalogue in their own currency. New databases
+		// get the permission when the roles are seeded.
+		SQL: `INSERT INTO role_permissions (role_id, permission_id)
+	SELECT r.id, p.id FROM roles r, permissions p WHERE r.name = 'customer' AND p.name = 'catalog:read'
+	ON CONFLICT DO NOTHING;`,
+	},
+	{
+		Version: 7,
+		Name:    "transaction_categories",
+		// Sales reports group by the category at checkout, which was not
+		// recorded before; the product's category now is the best guess
+		SQL: `UPDATE transaction_histories th SET category_id = p.category_id
+	FROM products p WHERE p.id = th.product_id AND th.category_id = 0;`,
+	},
+}
+
+// runMigrations applies the migrations that have not been applied yet.
+func runMigrations(db *gorm.DB) error {
+	if err := db.AutoMigrate(&schemaMigration{}); err != nil {
+		return err
+	}
+
+	var applied []int
+	if err := db.Model(&schemaMigration{}).Pluck("version", &applied).Error; err != nil {
+		return err
+	}
+	done := make(map[int]bool, len(applied))
+	for _, version := range applied {
+		done[version] = true
+	}
+
+	for _, m := range migrations {
+		if done[m.Version] {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(m.SQL).Error; err != nil {
+				return err
+			}
+			return tx.Create(&schemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/Pijuyy/testing_project4/models"
+	"gorm.io/gorm"
+)
+
+// ErrForbidden is returned when an authenticated user lacks a permission.
+var ErrForbidden = errors.New("Unauthorized access")
+
+// SeedRoles makes sure every known permission and built-in role exists.
+// Existing roles keep their edited permissions; only permissions that did not
+// exist before are granted according to models.DefaultRolePermissions.
+func SeedRoles(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		permissions := make(map[string]models.Permission)
+		created := make(map[string]bool)
+
+		for _, permission := range models.Permissions {
+			var existing models.Permission
+			err := tx.Where("name = ?", permission.Name).First(&existing).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				existing = permission
+				if err := tx.Create(&existing).Error; err != nil {
+					return err
+				}
+				created[permission.Name] = true
+			} else if err != nil {
+				return err
+			}
+			permissions[permission.Name] = existing
+		}
+
+		roles := map[string][]string{models.RoleSuperAdmin: nil}
+		for name, names := range models.DefaultRolePermissions {
+			roles[name] = names
+		}
+
+		for name, names := range roles {
+			// The super admin always holds every permission
+			if name == models.RoleSuperAdmin {
+				names = make([]string, 0, len(models.Permissions))
+				for _, permission := range models.Permissions {
+					names = append(names, permission.Name)
+				}
+			}
+
+			var role models.Role
+			err := tx.Preload("Permissions").Where("name = ?", name).First(&role).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				role = models.Role{Name: name}
+				for _, permissionName := range names {
+					role.Permissions = append(role.Permissions, permissions[permissionName])
+				}
+				if err := tx.Create(&role).Error; err != nil {
+					return err
+				}
+				continue
+			} else if err != nil {
+				return err
+			}
+
+			var missing []models.Permission
+			for _, permissionName := range names {
+				if !role.HasPermission(permissionName) && (created[permissionName] || name == models.RoleSuperAdmin) {
+					missing = append(missing, permissions[permissionName])
+				}
+			}
+			if len(missing) > 0 {
+				if err := tx.Model(&role).Association("Permissions").Append(missing); err != nil {
+					return fmt.Errorf("granting permissions to role %s: %w", name, err)
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// LoadRole loads the user's role together with its permissions.
+func LoadRole(db *gorm.DB, user *models.User) (*models.Role, error) {
+	var role models.Role
+	if err := db.Preload("Permissions").Where("name = ?", user.Role).First(&role).Error; err != nil {
+		return nil, err
+	}
+
+	return &role, nil
+}
+
+// HasPermission reports whether the user's role grants the given permission.
+func HasPermission(db *gorm.DB, user *models.User, permission string) (bool, error) {
+	role, err := LoadRole(db, user)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return role.HasPermission(permission), nil
+}
+
+// Authorize authenticates the request and checks that the user holds the
+// given permission. Requests made with an API key additionally need the
+// permission in the key's scopes. It returns ErrForbidden when the permission
+// is missing.
+func Authorize(r *http.Request, db *gorm.DB, permission string) (*models.User, error) {
+	claims, user, err := authenticateUser(r, db)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed, err := HasPermission(db, user, permission)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, ErrForbidden
+	}
+
+	if claims.APIKeyID != 0 && !slices.Contains(claims.Scopes, permission) {
+		return nil, ErrForbidden
+	}
+
+	return user, nil
+}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"context"
+	"net"
+	"net/http"
+)
+
+type contextKey string
+
+const requestIDKey contextKey = "request_id"
+
+// WithRequestID returns a copy of the request carrying the given request ID.
+func WithRequestID(r *http.Request, requestID string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), requestIDKey, requestID))
+}
+
+// RequestID returns the ID assigned to the request by the request ID middleware.
+// It is empty for work done outside of a request, such as CLI commands.
+func RequestID(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	requestID, _ := r.Context().Value(requestIDKey).(string)
+	return requestID
+}
+
+// ClientIP returns the IP address of the client that sent the request.
+func ClientIP(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
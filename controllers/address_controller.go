@@ -0,0 +1,279 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Pijuyy/testing_project4/config"
+	"github.com/Pijuyy/testing_project4/models"
+	"github.com/Pijuyy/testing_project4/service"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// CreateAddress - Save a shipping address for the authenticated user. Their
+// first address becomes the default.
+func CreateAddress(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := requireInteractiveUser(w, r, db)
+		if !ok {
+			return
+		}
+
+		var requestBody struct {
+			Label         string `json:"label"`
+			RecipientName string `json:"recipient_name"`
+			Phone         string `json:"phone"`
+			Line1         string `json:"line1"`
+			Line2         string `json:"line2"`
+			City          string `json:"city"`
+			Province      string `json:"province"`
+			PostalCode    string `json:"postal_code"`
+			CountryCode   string `json:"country_code"`
+			IsDefault     bool   `json:"is_default"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		address := models.Address{
+			UserID:        user.ID,
+			Label:         requestBody.Label,
+			RecipientName: requestBody.RecipientName,
+			Phone:         requestBody.Phone,
+			Line1:         requestBody.Line1,
+			Line2:         requestBody.Line2,
+			City:          requestBody.City,
+			Province:      requestBody.Province,
+			PostalCode:    requestBody.PostalCode,
+			CountryCode:   requestBody.CountryCode,
+			IsDefault:     requestBody.IsDefault,
+		}
+		if err := address.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			return service.CreateAddress(tx, &address)
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("ETag", etag(address.Version))
+		w.WriteHeader(http.StatusCreated)
+		config.SendJSONResponse(w, addressResponse(address))
+	}
+}
+
+// GetMyAddresses - List the authenticated user's addresses, the default first
+func GetMyAddresses(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := config.ExtractUserFromToken(r, db)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var addresses []models.Address
+		if err := db.Where("user_id = ?", user.ID).Order("is_default DESC, id DESC").Find(&addresses).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		response := make([]map[string]interface{}, 0, len(addresses))
+		for _, address := range addresses {
+			response = append(response, addressResponse(address))
+		}
+
+		config.SendJSONResponse(w, response)
+	}
+}
+
+// PatchAddress - Edit one of the authenticated user's addresses using JSON Merge
+// Patch. Orders already placed keep the address they were shipped to.
+func PatchAddress(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := requireInteractiveUser(w, r, db)
+		if !ok {
+			return
+		}
+
+		patch, err := decodeMergePatch(r)
+		if errors.Is(err, errUnsupportedPatch) {
+			http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		address, ok := findAddressFromPath(w, r, db, user.ID)
+		if !ok {
+			return
+		}
+
+		if !ifMatch(r, address.Version) {
+			http.Error(w, service.ErrVersionConflict.Error(), http.StatusPreconditionFailed)
+			return
+		}
+
+		// Only the members present in the patch are applied
+		wasDefault := address.IsDefault
+		for field, value := range patch {
+			switch field {
+			case "label":
+				err = decodePatchField(field, value, &address.Label)
+			case "recipient_name":
+				err = decodePatchField(field, value, &address.RecipientName)
+			case "phone":
+				err = decodePatchField(field, value, &address.Phone)
+			case "line1":
+				err = decodePatchField(field, value, &address.Line1)
+			case "line2":
+				err = decodePatchField(field, value, &address.Line2)
+			case "city":
+				err = decodePatchField(field, value, &address.City)
+			case "province":
+				err = decodePatchField(field, value, &address.Province)
+			case "postal_code":
+				err = decodePatchField(field, value, &address.PostalCode)
+			case "country_code":
+				err = decodePatchField(field, value, &address.CountryCode)
+			case "is_default":
+				err = decodePatchField(field, value, &address.IsDefault)
+			default:
+				err = fmt.Errorf("unknown field %s", field)
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		// Another address has to be made the default instead
+		if wasDefault && !address.IsDefault {
+			http.Error(w, "is_default cannot be unset, make another address the default instead", http.StatusBadRequest)
+			return
+		}
+
+		if err := address.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		address.UpdatedAt = time.Now()
+		err = db.Transaction(func(tx *gorm.DB) error {
+			return service.UpdateAddress(tx, address)
+		})
+		if errors.Is(err, service.ErrVersionConflict) {
+			http.Error(w, err.Error(), http.StatusPreconditionFailed)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("ETag", etag(address.Version))
+		config.SendJSONResponse(w, addressResponse(*address))
+	}
+}
+
+// DeleteAddress - Delete one of the authenticated user's addresses. When it was
+// the default, their most recently added address becomes the default.
+func DeleteAddress(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := requireInteractiveUser(w, r, db)
+		if !ok {
+			return
+		}
+
+		address, ok := findAddressFromPath(w, r, db, user.ID)
+		if !ok {
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			return service.DeleteAddress(tx, address)
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		config.SendJSONResponse(w, map[string]interface{}{
+			"message": "Address has been successfully deleted",
+		})
+	}
+}
+
+// SetDefaultAddress - Make one of the authenticated user's addresses the one
+// used at checkout when no address is chosen
+func SetDefaultAddress(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := requireInteractiveUser(w, r, db)
+		if !ok {
+			return
+		}
+
+		address, ok := findAddressFromPath(w, r, db, user.ID)
+		if !ok {
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			return service.SetDefaultAddress(tx, address)
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("ETag", etag(address.Version))
+		config.SendJSONResponse(w, addressResponse(*address))
+	}
+}
+
+// findAddressFromPath loads an address of the user. Other users' addresses
+// are reported as not found.
+func findAddressFromPath(w http.ResponseWriter, r *http.Request, db *gorm.DB, userID uint) (*models.Address, bool) {
+	addressID, err := strconv.Atoi(mux.Vars(r)["addressId"])
+	if err != nil {
+		http.Error(w, "Invalid address ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	var address models.Address
+	if err := db.Where("id = ? AND user_id = ?", addressID, userID).First(&address).Error; err != nil {
+		http.Error(w, "Address not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return &address, true
+}
+
+func addressResponse(address models.Address) map[string]interface{} {
+	return map[string]interface{}{
+		"id":             address.ID,
+		"label":          address.Label,
+		"recipient_name": address.RecipientName,
+		"phone":          address.Phone,
+		"line1":          address.Line1,
+		"line2":          address.Line2,
+		"city":           address.City,
+		"province":       address.Province,
+		"postal_code":    address.PostalCode,
+		"country_code":   address.CountryCode,
+		"is_default":     address.IsDefault,
+		"version":        address.Version,
+		"created_at":     address.CreatedAt.Format(time.RFC3339),
+		"updated_at":     address.UpdatedAt.Format(time.RFC3339),
+	}
+}
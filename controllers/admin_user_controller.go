@@ -0,0 +1,441 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Pijuyy/testing_project4/config"
+	"github.com/Pijuyy/testing_project4/models"
+	"github.com/Pijuyy/testing_project4/service"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ListUsers - List and search users with pagination (requires users:read)
+func ListUsers(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := authorize(w, r, db, models.PermUsersRead); !ok {
+			return
+		}
+
+		page, limit := parsePagination(r)
+		query := db.Model(&models.User{})
+
+		// Search matches either the full name or the email address
+		if search := strings.TrimSpace(r.URL.Query().Get("search")); search != "" {
+			pattern := "%" + search + "%"
+			query = query.Where("full_name ILIKE ? OR email ILIKE ?", pattern, pattern)
+		}
+		if role := r.URL.Query().Get("role"); role != "" {
+			query = query.Where("role = ?", role)
+		}
+		if status := r.URL.Query().Get("status"); status != "" {
+			query = query.Where("status = ?", status)
+		}
+
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var users []models.User
+		if err := query.Order("id").Offset((page - 1) * limit).Limit(limit).Find(&users).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responseUsers := make([]map[string]interface{}, 0, len(users))
+		for _, user := range users {
+			responseUsers = append(responseUsers, userResponse(user))
+		}
+
+		config.SendJSONResponse(w, map[string]interface{}{
+			"users": responseUsers,
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		})
+	}
+}
+
+// GetUser - Get a single user with balance and order statistics (requires users:read)
+func GetUser(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := authorize(w, r, db, models.PermUsersRead); !ok {
+			return
+		}
+
+		userID, err := strconv.Atoi(mux.Vars(r)["userId"])
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		var user models.User
+		if err := db.First(&user, userID).Error; err != nil {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+
+		var stats struct {
+			TransactionCount  int64
+			ItemsPurchased    int64
+			TotalSpent        models.Money
+			LastTransactionAt *time.Time
+		}
+		err = db.Model(&models.TransactionHistory{}).
+			Select("COUNT(*) AS transaction_count, COALESCE(SUM(quantity), 0) AS items_purchased, COALESCE(SUM(total_price), 0) AS total_spent, MAX(created_at) AS last_transaction_at").
+			Where("user_id = ?", user.ID).
+			Scan(&stats).Error
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		orderStats := map[string]interface{}{
+			"transaction_count":   stats.TransactionCount,
+			"items_purchased":     stats.ItemsPurchased,
+			"total_spent":         stats.TotalSpent,
+			"last_transaction_at": formatOptionalTime(stats.LastTransactionAt),
+		}
+
+		response := userResponse(user)
+		response["order_stats"] = orderStats
+		config.SendJSONResponse(w, response)
+	}
+}
+
+// UpdateUserRole - Change the role of a user (requires users:manage)
+func UpdateUserRole(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		admin, ok := authorize(w, r, db, models.PermUsersManage)
+		if !ok {
+			return
+		}
+
+		userID, err := strconv.Atoi(mux.Vars(r)["userId"])
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		var requestBody struct {
+			Role string `json:"role"`
+		}
+		err = json.NewDecoder(r.Body).Decode(&requestBody)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var role models.Role
+		if err := db.Preload("Permissions").Where("name = ?", requestBody.Role).First(&role).Error; err != nil {
+			http.Error(w, "Role not found", http.StatusBadRequest)
+			return
+		}
+
+		// Nobody can hand out permissions they do not hold themselves
+		adminRole, err := config.LoadRole(db, admin)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !holdsPermissions(adminRole, &role) {
+			http.Error(w, "You cannot assign a role with permissions you do not have", http.StatusForbidden)
+			return
+		}
+
+		// Prevent admins from locking themselves out by accident
+		if uint(userID) == admin.ID {
+			http.Error(w, "You cannot change your own role", http.StatusBadRequest)
+			return
+		}
+
+		var user models.User
+		if err := db.First(&user, userID).Error; err != nil {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+
+		if !canManageUser(w, db, adminRole, &user) {
+			return
+		}
+
+		before := user
+		user.Role = requestBody.Role
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if before.Role != user.Role {
+				if err := service.KeepSuperAdmin(tx, &before); err != nil {
+					return err
+				}
+			}
+			if err := tx.Model(&user).Update("role", user.Role).Error; err != nil {
+				return err
+			}
+			return service.RecordAudit(tx, r, admin, "user.change_role", "user", user.ID, before, user)
+		})
+		if errors.Is(err, service.ErrLastSuperAdmin) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		config.SendJSONResponse(w, userResponse(user))
+	}
+}
+
+// SuspendUser - Suspend a user account (requires users:manage)
+func SuspendUser(db *gorm.DB) http.HandlerFunc {
+	return setUserStatus(db, models.UserStatusSuspended, "user.suspend")
+}
+
+// ReactivateUser - Reactivate a suspended user account (requires users:manage)
+func ReactivateUser(db *gorm.DB) http.HandlerFunc {
+	return setUserStatus(db, models.UserStatusActive, "user.reactivate")
+}
+
+func setUserStatus(db *gorm.DB, status, action string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		admin, ok := authorize(w, r, db, models.PermUsersManage)
+		if !ok {
+			return
+		}
+
+		userID, err := strconv.Atoi(mux.Vars(r)["userId"])
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		if uint(userID) == admin.ID {
+			http.Error(w, "You cannot change the status of your own account", http.StatusBadRequest)
+			return
+		}
+
+		var user models.User
+		if err := db.First(&user, userID).Error; err != nil {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+
+		if user.Status == models.UserStatusDeleted {
+			http.Error(w, "Deleted accounts cannot be changed", http.StatusBadRequest)
+			return
+		}
+
+		adminRole, err := config.LoadRole(db, admin)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !canManageUser(w, db, adminRole, &user) {
+			return
+		}
+
+		before := user
+		user.Status = status
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if user.Status != models.UserStatusActive {
+				if err := service.KeepSuperAdmin(tx, &before); err != nil {
+					return err
+				}
+			}
+			if err := tx.Model(&user).Update("status", user.Status).Error; err != nil {
+				return err
+			}
+			return service.RecordAudit(tx, r, admin, action, "user", user.ID, before, user)
+		})
+		if errors.Is(err, service.ErrLastSuperAdmin) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		config.SendJSONResponse(w, userResponse(user))
+	}
+}
+
+// AdjustUserBalance - Manually credit or debit a user's balance with a reason (requires balances:adjust)
+func AdjustUserBalance(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		admin, ok := authorize(w, r, db, models.PermBalancesAdjust)
+		if !ok {
+			return
+		}
+
+		userID, err := strconv.Atoi(mux.Vars(r)["userId"])
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		var requestBody struct {
+			Amount models.Money `json:"amount"`
+			Reason string       `json:"reason"`
+		}
+		err = json.NewDecoder(r.Body).Decode(&requestBody)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		requestBody.Reason = strings.TrimSpace(requestBody.Reason)
+		if requestBody.Amount.Amount == 0 {
+			http.Error(w, "amount must not be zero", http.StatusBadRequest)
+			return
+		}
+		if requestBody.Reason == "" {
+			http.Error(w, "reason is required", http.StatusBadRequest)
+			return
+		}
+
+		var user models.User
+		var adjustment models.BalanceAdjustment
+		errInvalidBalance := errors.New("balance must stay between 0 and 100,000,000")
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			// Lock the row so concurrent purchases or top-ups cannot interleave
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
+				return err
+			}
+
+			// A plain amount is in the currency of the user's wallet
+			if requestBody.Amount.Currency == "" {
+				requestBody.Amount.Currency = user.Balance.Currency
+			}
+			newBalance, err := user.Balance.Add(requestBody.Amount)
+			if err != nil {
+				return err
+			}
+			if newBalance.Amount < 0 || newBalance.Amount > models.MaxBalance {
+				return errInvalidBalance
+			}
+
+			adjustment = models.BalanceAdjustment{
+				UserID:        user.ID,
+				AdminID:       admin.ID,
+				Amount:        requestBody.Amount,
+				BalanceBefore: user.Balance,
+				BalanceAfter:  newBalance,
+				Reason:        requestBody.Reason,
+				Currency:      user.Currency,
+			}
+			if err := tx.Create(&adjustment).Error; err != nil {
+				return err
+			}
+
+			before := user
+			user.Balance = newBalance
+			if err := tx.Model(&user).Update("balance", user.Balance).Error; err != nil {
+				return err
+			}
+			return service.RecordAudit(tx, r, admin, "user.adjust_balance", "user", user.ID, before, user)
+		})
+		if err != nil {
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				http.Error(w, "User not found", http.StatusNotFound)
+			case errors.Is(err, errInvalidBalance), errors.Is(err, models.ErrCurrencyMismatch), errors.Is(err, models.ErrMoneyOverflow):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			default:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		config.SendJSONResponse(w, balanceAdjustmentResponse(adjustment))
+	}
+}
+
+// GetUserBalanceAdjustments - List manual balance adjustments of a user (requires users:read)
+func GetUserBalanceAdjustments(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := authorize(w, r, db, models.PermUsersRead); !ok {
+			return
+		}
+
+		userID, err := strconv.Atoi(mux.Vars(r)["userId"])
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		var adjustments []models.BalanceAdjustment
+		if err := db.Where("user_id = ?", userID).Order("created_at DESC").Find(&adjustments).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		response := make([]map[string]interface{}, 0, len(adjustments))
+		for _, adjustment := range adjustments {
+			response = append(response, balanceAdjustmentResponse(adjustment))
+		}
+
+		config.SendJSONResponse(w, response)
+	}
+}
+
+// canManageUser checks that the actor holds every permission of the user's
+// current role, so nobody can demote or suspend someone who outranks them.
+func canManageUser(w http.ResponseWriter, db *gorm.DB, actorRole *models.Role, user *models.User) bool {
+	userRole, err := config.LoadRole(db, user)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return true
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+
+	if !holdsPermissions(actorRole, userRole) {
+		http.Error(w, "You cannot manage a user with permissions you do not have", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// holdsPermissions reports whether role grants every permission of other.
+func holdsPermissions(role, other *models.Role) bool {
+	for _, permission := range other.PermissionNames() {
+		if !role.HasPermission(permission) {
+			return false
+		}
+	}
+	return true
+}
+
+func userResponse(user models.User) map[string]interface{} {
+	return map[string]interface{}{
+		"id":         user.ID,
+		"full_name":  user.FullName,
+		"email":      user.Email,
+		"role":       user.Role,
+		"status":     user.Status,
+		"balance":    user.Balance,
+		"created_at": user.CreatedAt.Format(time.RFC3339),
+		"updated_at": user.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+func balanceAdjustmentResponse(adjustment models.BalanceAdjustment) map[string]interface{} {
+	return map[string]interface{}{
+		"id":             adjustment.ID,
+		"user_id":        adjustment.UserID,
+		"admin_id":       adjustment.AdminID,
+		"amount":         adjustment.Amount,
+		"balance_before": adjustment.BalanceBefore,
+		"balance_after":  adjustment.BalanceAfter,
+		"reason":         adjustment.Reason,
+		"created_at":     adjustment.CreatedAt.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,348 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Pijuyy/testing_project4/config"
+	"github.com/Pijuyy/testing_project4/models"
+	"github.com/Pijuyy/testing_project4/service"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// CreateMyAPIKey - Mint a new API key for the authenticated user
+func CreateMyAPIKey(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := requireInteractiveUser(w, r, db)
+		if !ok {
+			return
+		}
+
+		mintAPIKey(w, r, db, user, user)
+	}
+}
+
+// GetMyAPIKeys - List the API keys of the authenticated user
+func GetMyAPIKeys(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := requireInteractiveUser(w, r, db)
+		if !ok {
+			return
+		}
+
+		listAPIKeys(w, db, user.ID)
+	}
+}
+
+// RevokeMyAPIKey - Revoke one of the authenticated user's API keys
+func RevokeMyAPIKey(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := requireInteractiveUser(w, r, db)
+		if !ok {
+			return
+		}
+
+		revokeAPIKey(w, r, db, user, user.ID)
+	}
+}
+
+// CreateUserAPIKey - Mint an API key on behalf of another user, e.g. a service account (requires users:manage)
+func CreateUserAPIKey(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		admin, ok := requireInteractiveUser(w, r, db)
+		if !ok || !requirePermission(w, db, admin, models.PermUsersManage) {
+			return
+		}
+
+		owner, ok := findManagedUserFromPath(w, r, db, admin)
+		if !ok {
+			return
+		}
+
+		mintAPIKey(w, r, db, owner, admin)
+	}
+}
+
+// GetUserAPIKeys - List the API keys of a user (requires users:manage)
+func GetUserAPIKeys(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		admin, ok := requireInteractiveUser(w, r, db)
+		if !ok || !requirePermission(w, db, admin, models.PermUsersManage) {
+			return
+		}
+
+		owner, ok := findManagedUserFromPath(w, r, db, admin)
+		if !ok {
+			return
+		}
+
+		listAPIKeys(w, db, owner.ID)
+	}
+}
+
+// RevokeUserAPIKey - Revoke an API key of a user (requires users:manage)
+func RevokeUserAPIKey(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		admin, ok := requireInteractiveUser(w, r, db)
+		if !ok || !requirePermission(w, db, admin, models.PermUsersManage) {
+			return
+		}
+
+		owner, ok := findManagedUserFromPath(w, r, db, admin)
+		if !ok {
+			return
+		}
+
+		revokeAPIKey(w, r, db, admin, owner.ID)
+	}
+}
+
+// requireInteractiveUser authenticates the request and rejects API keys, so a
+// scoped key can never be used to mint a broader one, to take over the
+// account through its credentials or to change what the owner has saved or
+// published.
+func requireInteractiveUser(w http.ResponseWriter, r *http.Request, db *gorm.DB) (*models.User, bool) {
+	claims, err := config.Authenticate(r, db)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return nil, false
+	}
+
+	if claims.APIKeyID != 0 {
+		http.Error(w, "API keys cannot be used to change the account or act in its name", http.StatusForbidden)
+		return nil, false
+	}
+
+	var user models.User
+	if err := db.First(&user, claims.UserID).Error; err != nil {
+		http.Error(w, "User not found", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	return &user, true
+}
+
+// requireScopedUser authenticates the request and, when it is made with an
+// API key, requires the key to have the scope.
+func requireScopedUser(w http.ResponseWriter, r *http.Request, db *gorm.DB, scope string) (*models.User, bool) {
+	claims, err := config.Authenticate(r, db)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return nil, false
+	}
+
+	if claims.APIKeyID != 0 && !slices.Contains(claims.Scopes, scope) {
+		http.Error(w, "API key is missing the "+scope+" scope", http.StatusForbidden)
+		return nil, false
+	}
+
+	var user models.User
+	if err := db.First(&user, claims.UserID).Error; err != nil {
+		http.Error(w, "User not found", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	return &user, true
+}
+
+// requirePermission writes a 403 response when the user lacks the permission.
+func requirePermission(w http.ResponseWriter, db *gorm.DB, user *models.User, permission string) bool {
+	allowed, err := config.HasPermission(db, user, permission)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if !allowed {
+		http.Error(w, config.ErrForbidden.Error(), http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
+
+func findUserFromPath(w http.ResponseWriter, r *http.Request, db *gorm.DB) (*models.User, bool) {
+	userID, err := strconv.Atoi(mux.Vars(r)["userId"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return &user, true
+}
+
+// findManagedUserFromPath loads the user in the path if the admin holds every
+// permission of their role, so nobody can get a key to act as a user who
+// outranks them.
+func findManagedUserFromPath(w http.ResponseWriter, r *http.Request, db *gorm.DB, admin *models.User) (*models.User, bool) {
+	owner, ok := findUserFromPath(w, r, db)
+	if !ok {
+		return nil, false
+	}
+
+	adminRole, err := config.LoadRole(db, admin)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if !canManageUser(w, db, adminRole, owner) {
+		return nil, false
+	}
+
+	return owner, true
+}
+
+func mintAPIKey(w http.ResponseWriter, r *http.Request, db *gorm.DB, owner, creator *models.User) {
+	var requestBody struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&requestBody)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if requestBody.ExpiresAt != nil && !requestBody.ExpiresAt.After(time.Now()) {
+		http.Error(w, "expires_at must be in the future", http.StatusBadRequest)
+		return
+	}
+
+	// Scopes are limited to what both the key owner and its creator may do
+	ownerRole, err := config.LoadRole(db, owner)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	creatorRole, err := config.LoadRole(db, creator)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, scope := range requestBody.Scopes {
+		// Only owners can let a key spend or top up their own balance
+		if models.IsOwnerScope(scope) && owner.ID == creator.ID {
+			continue
+		}
+		if !ownerRole.HasPermission(scope) || !creatorRole.HasPermission(scope) {
+			http.Error(w, "scope not allowed: "+scope, http.StatusBadRequest)
+			return
+		}
+	}
+
+	lookupBytes := make([]byte, 8)
+	if _, err := rand.Read(lookupBytes); err != nil {
+		http.Error(w, "Error while generating API key", http.StatusInternalServerError)
+		return
+	}
+	secret, err := generateToken()
+	if err != nil {
+		http.Error(w, "Error while generating API key", http.StatusInternalServerError)
+		return
+	}
+	lookup := hex.EncodeToString(lookupBytes)
+	key := models.APIKeyPrefix + lookup + "_" + secret
+
+	apiKey := models.APIKey{
+		UserID:      owner.ID,
+		CreatedByID: creator.ID,
+		Name:        strings.TrimSpace(requestBody.Name),
+		Lookup:      lookup,
+		KeyHash:     config.HashToken(key),
+		Scopes:      strings.Join(requestBody.Scopes, " "),
+		ExpiresAt:   requestBody.ExpiresAt,
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&apiKey).Error; err != nil {
+			return err
+		}
+		return service.RecordAudit(tx, r, creator, "api_key.create", "api_key", apiKey.ID, nil, apiKey)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The plain key is only ever shown in this response
+	response := apiKeyResponse(apiKey)
+	response["key"] = key
+
+	w.WriteHeader(http.StatusCreated)
+	config.SendJSONResponse(w, response)
+}
+
+func listAPIKeys(w http.ResponseWriter, db *gorm.DB, userID uint) {
+	var apiKeys []models.APIKey
+	if err := db.Where("user_id = ?", userID).Order("created_at DESC").Find(&apiKeys).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]map[string]interface{}, 0, len(apiKeys))
+	for _, apiKey := range apiKeys {
+		response = append(response, apiKeyResponse(apiKey))
+	}
+
+	config.SendJSONResponse(w, response)
+}
+
+func revokeAPIKey(w http.ResponseWriter, r *http.Request, db *gorm.DB, actor *models.User, userID uint) {
+	keyID, err := strconv.Atoi(mux.Vars(r)["keyId"])
+	if err != nil {
+		http.Error(w, "Invalid API key ID", http.StatusBadRequest)
+		return
+	}
+
+	var apiKey models.APIKey
+	if err := db.Where("id = ? AND user_id = ?", keyID, userID).First(&apiKey).Error; err != nil {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+
+	if apiKey.RevokedAt == nil {
+		before := apiKey
+		now := time.Now()
+		apiKey.RevokedAt = &now
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&apiKey).Update("revoked_at", now).Error; err != nil {
+				return err
+			}
+			return service.RecordAudit(tx, r, actor, "api_key.revoke", "api_key", apiKey.ID, before, apiKey)
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	config.SendJSONResponse(w, map[string]interface{}{
+		"message": "API key has been successfully revoked",
+	})
+}
+
+func apiKeyResponse(apiKey models.APIKey) map[string]interface{} {
+	return map[string]interface{}{
+		"id":           apiKey.ID,
+		"user_id":      apiKey.UserID,
+		"name":         apiKey.Name,
+		"prefix":       models.APIKeyPrefix + apiKey.Lookup,
+		"scopes":       apiKey.ScopeList(),
+		"last_used_at": formatOptionalTime(apiKey.LastUsedAt),
+		"expires_at":   formatOptionalTime(apiKey.ExpiresAt),
+		"revoked_at":   formatOptionalTime(apiKey.RevokedAt),
+		"created_at":   apiKey.CreatedAt.Format(time.RFC3339),
+	}
+}
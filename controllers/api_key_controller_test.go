@@ -0,0 +1,46 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Pijuyy/testing_project4/models"
+	"github.com/gorilla/mux"
+)
+
+func TestCreateUserAPIKeyRequiresOutrankingTheOwner(t *testing.T) {
+	db := testDB(t)
+	admin := createTestUser(t, db, models.RoleAdmin)
+	superAdmin := createTestUser(t, db, models.RoleSuperAdmin)
+	customer := createTestUser(t, db, models.RoleCustomer)
+
+	tests := []struct {
+		owner models.User
+		want  int
+	}{
+		// A key for a super admin would let the admin act as one
+		{superAdmin, http.StatusForbidden},
+		{customer, http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name": "integration"}`))
+		r = mux.SetURLVars(r, map[string]string{"userId": fmt.Sprint(tt.owner.ID)})
+		authenticate(t, r, admin)
+		w := httptest.NewRecorder()
+
+		CreateUserAPIKey(db)(w, r)
+		if w.Code != tt.want {
+			t.Errorf("minting a key for a %s: status %d, want %d: %s", tt.owner.Role, w.Code, tt.want, w.Body)
+		}
+	}
+
+	var keys int64
+	db.Model(&models.APIKey{}).Where("user_id = ?", superAdmin.ID).Count(&keys)
+	if keys != 0 {
+		t.Errorf("the super admin has %d keys, want none", keys)
+	}
+}
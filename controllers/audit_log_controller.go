@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Pijuyy/testing_project4/config"
+	"github.com/Pijuyy/testing_project4/models"
+	"gorm.io/gorm"
+)
+
+// GetAuditLogs - Query the audit log with filters (requires audit:read)
+func GetAuditLogs(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := authorize(w, r, db, models.PermAuditRead); !ok {
+			return
+		}
+
+		page, limit := parsePagination(r)
+		params := r.URL.Query()
+		query := db.Model(&models.AuditLog{})
+
+		if actorID := params.Get("actor_id"); actorID != "" {
+			id, err := strconv.Atoi(actorID)
+			if err != nil {
+				http.Error(w, "Invalid actor ID", http.StatusBadRequest)
+				return
+			}
+			query = query.Where("actor_id = ?", id)
+		}
+		if action := params.Get("action"); action != "" {
+			query = query.Where("action = ?", action)
+		}
+		if entityType := params.Get("entity_type"); entityType != "" {
+			query = query.Where("entity_type = ?", entityType)
+		}
+		if entityID := params.Get("entity_id"); entityID != "" {
+			query = query.Where("entity_id = ?", entityID)
+		}
+		if requestID := params.Get("request_id"); requestID != "" {
+			query = query.Where("request_id = ?", requestID)
+		}
+		if from := params.Get("from"); from != "" {
+			t, err := time.Parse(time.RFC3339, from)
+			if err != nil {
+				http.Error(w, "from must be an RFC 3339 timestamp", http.StatusBadRequest)
+				return
+			}
+			query = query.Where("created_at >= ?", t)
+		}
+		if to := params.Get("to"); to != "" {
+			t, err := time.Parse(time.RFC3339, to)
+			if err != nil {
+				http.Error(w, "to must be an RFC 3339 timestamp", http.StatusBadRequest)
+				return
+			}
+			query = query.Where("created_at < ?", t)
+		}
+
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var entries []models.AuditLog
+		if err := query.Order("id DESC").Offset((page - 1) * limit).Limit(limit).Find(&entries).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responseEntries := make([]map[string]interface{}, 0, len(entries))
+		for _, entry := range entries {
+			responseEntries = append(responseEntries, map[string]interface{}{
+				"id":          entry.ID,
+				"actor_id":    entry.ActorID,
+				"action":      entry.Action,
+				"entity_type": entry.EntityType,
+				"entity_id":   entry.EntityID,
+				"before":      json.RawMessage(entry.Before),
+				"after":       json.RawMessage(entry.After),
+				"changes":     json.RawMessage(entry.Changes),
+				"request_id":  entry.RequestID,
+				"ip":          entry.IP,
+				"created_at":  entry.CreatedAt.Format(time.RFC3339),
+			})
+		}
+
+		config.SendJSONResponse(w, map[string]interface{}{
+			"audit_logs": responseEntries,
+			"page":       page,
+			"limit":      limit,
+			"total":      total,
+		})
+	}
+}
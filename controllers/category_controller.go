@@ -1,209 +1,555 @@
-// controller.go
-package controllers
-
-import (
-	"encoding/json"
-	"net/http"
-	"strconv"
-	"time"
-
-	"github.com/Pijuyy/testing_project4/config"
-	"github.com/Pijuyy/testing_project4/models"
-	"github.com/Pijuyy/testing_project4/repo"
-	"github.com/Pijuyy/testing_project4/service"
-	"github.com/gorilla/mux"
-	"gorm.io/gorm"
-)
-
-type CategoryController struct {
-	Service    *service.CategoryService
-	Repository *repo.CategoryRepository
-}
-
-func NewCategoryController(db *gorm.DB) *CategoryController {
-	return &CategoryController{
-		Service:    service.NewCategoryService(db),
-		Repository: repo.NewCategoryRepository(db),
-	}
-}
-
-// CreateCategory - Create a new category
-func (c *CategoryController) CreateCategory(w http.ResponseWriter, r *http.Request) {
-	user, err := config.ExtractUserFromToken(r, c.Service.DB)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
-		return
-	}
-
-	if user.Role != "admin" {
-		http.Error(w, "Unauthorized access", http.StatusForbidden)
-		return
-	}
-
-	var requestBody struct {
-		Type string `json:"type"`
-	}
-	err = json.NewDecoder(r.Body).Decode(&requestBody)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	category := models.Category{
-		Type:              requestBody.Type,
-		SoldProductAmount: 0,
-		CreatedAt:         time.Now(),
-	}
-
-	err = c.Service.CreateCategory(&category)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	w.WriteHeader(http.StatusCreated)
-	config.SendJSONResponse(w, map[string]interface{}{
-		"id":                  category.ID,
-		"type":                category.Type,
-		"sold_product_amount": category.SoldProductAmount,
-		"created_at":          category.CreatedAt.Format(time.RFC3339),
-	})
-}
-
-// GetCategories - Get all categories
-func (c *CategoryController) GetCategories(w http.ResponseWriter, r *http.Request) {
-	user, err := config.ExtractUserFromToken(r, c.Service.DB)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
-		return
-	}
-
-	if user.Role != "admin" {
-		http.Error(w, "Unauthorized access", http.StatusForbidden)
-		return
-	}
-
-	categories, err := c.Service.GetCategories()
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	// Create a structured response with ordered fields
-	var responseCategories []map[string]interface{}
-	for _, category := range categories {
-		categoryData := map[string]interface{}{
-			"id":                  category.ID,
-			"type":                category.Type,
-			"sold_product_amount": category.SoldProductAmount,
-			"created_at":          category.CreatedAt.Format(time.RFC3339),
-			"updated_at":          category.UpdatedAt.Format(time.RFC3339),
-			"products":            []map[string]interface{}{},
-		}
-
-		// Add product details to the response with ordered fields
-		for _, product := range category.Products {
-			productData := map[string]interface{}{
-				"id":         product.ID,
-				"title":      product.Title,
-				"price":      product.Price,
-				"stock":      product.Stock,
-				"created_at": product.CreatedAt.Format(time.RFC3339),
-				"updated_at": product.UpdatedAt.Format(time.RFC3339),
-			}
-			categoryData["products"] = append(categoryData["products"].([]map[string]interface{}), productData)
-		}
-
-		responseCategories = append(responseCategories, categoryData)
-	}
-
-	// Send the JSON response with ordered fields
-	config.SendJSONResponse(w, responseCategories)
-}
-
-// UpdateCategory - Update category by ID
-func (c *CategoryController) UpdateCategory(w http.ResponseWriter, r *http.Request) {
-	user, err := config.ExtractUserFromToken(r, c.Service.DB)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
-		return
-	}
-
-	if user.Role != "admin" {
-		http.Error(w, "Unauthorized access", http.StatusForbidden)
-		return
-	}
-
-	categoryID, err := strconv.Atoi(mux.Vars(r)["categoryId"])
-	if err != nil {
-		http.Error(w, "Invalid category ID", http.StatusBadRequest)
-		return
-	}
-
-	var requestBody struct {
-		Type string `json:"type"`
-	}
-	err = json.NewDecoder(r.Body).Decode(&requestBody)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	category, err := c.Repository.FindCategoryByID(categoryID)
-	if err != nil {
-		http.Error(w, "Category not found", http.StatusNotFound)
-		return
-	}
-
-	category.Type = requestBody.Type
-	category.UpdatedAt = time.Now()
-
-	err = c.Service.UpdateCategory(category)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	config.SendJSONResponse(w, map[string]interface{}{
-		"id":                  category.ID,
-		"type":                category.Type,
-		"sold_product_amount": category.SoldProductAmount,
-		"updated_at":          category.UpdatedAt.Format(time.RFC3339),
-	})
-}
-
-// DeleteCategory - Delete category by ID
-func (c *CategoryController) DeleteCategory(w http.ResponseWriter, r *http.Request) {
-	user, err := config.ExtractUserFromToken(r, c.Service.DB)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
-		return
-	}
-
-	if user.Role != "admin" {
-		http.Error(w, "Unauthorized access", http.StatusForbidden)
-		return
-	}
-
-	categoryID, err := strconv.Atoi(mux.Vars(r)["categoryId"])
-	if err != nil {
-		http.Error(w, "Invalid category ID", http.StatusBadRequest)
-		return
-	}
-
-	category, err := c.Repository.FindCategoryByID(categoryID)
-	if err != nil {
-		http.Error(w, "Category not found", http.StatusNotFound)
-		return
-	}
-
-	err = c.Service.DeleteCategory(category)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	config.SendJSONResponse(w, map[string]interface{}{
-		"message": "Category has been successfully deleted",
-	})
-}
+// controller.go
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Pijuyy/testing_project4/config"
+	"github.com/Pijuyy/testing_project4/models"
+	"github.com/Pijuyy/testing_project4/repo"
+	"github.com/Pijuyy/testing_project4/service"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+type CategoryController struct {
+	Service    *service.CategoryService
+	Repository *repo.CategoryRepository
+}
+
+func NewCategoryController(db *gorm.DB) *CategoryController {
+	return &CategoryController{
+		Service:    service.NewCategoryService(db),
+		Repository: repo.NewCategoryRepository(db),
+	}
+}
+
+// CreateCategory - Create a new category
+func (c *CategoryController) CreateCategory(w http.ResponseWriter, r *http.Request) {
+	user, ok := authorize(w, r, c.Service.DB, models.PermCatalogWrite)
+	if !ok {
+		return
+	}
+
+	var requestBody struct {
+		Type     string `json:"type"`
+		ParentID *uint  `json:"parent_id"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&requestBody)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Nested categories need an existing parent
+	if requestBody.ParentID != nil {
+		if _, err := c.Repository.FindCategoryByID(int(*requestBody.ParentID)); err != nil {
+			http.Error(w, "Parent category not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	category := models.Category{
+		Type:              requestBody.Type,
+		SoldProductAmount: 0,
+		CreatedAt:         time.Now(),
+		ParentID:          requestBody.ParentID,
+	}
+
+	err = c.Service.DB.Transaction(func(tx *gorm.DB) error {
+		if err := service.NewCategoryService(tx).CreateCategory(&category); err != nil {
+			return err
+		}
+		return service.RecordAudit(tx, r, user, "category.create", "category", category.ID, nil, category)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", etag(category.Version))
+	w.WriteHeader(http.StatusCreated)
+	config.SendJSONResponse(w, map[string]interface{}{
+		"id":                  category.ID,
+		"type":                category.Type,
+		"sold_product_amount": category.SoldProductAmount,
+		"version":             category.Version,
+		"created_at":          category.CreatedAt.Format(time.RFC3339),
+		"parent_id":           category.ParentID,
+		"tax_rate_id":         category.TaxRateID,
+	})
+}
+
+// GetCategories - Get all categories. Pass view=tree to nest subcategories under
+// their parent in "children".
+func (c *CategoryController) GetCategories(w http.ResponseWriter, r *http.Request) {
+	if _, ok := authorize(w, r, c.Service.DB, models.PermCatalogRead); !ok {
+		return
+	}
+
+	view := r.URL.Query().Get("view")
+	if view != "" && view != "flat" && view != "tree" {
+		http.Error(w, "view must be flat or tree", http.StatusBadRequest)
+		return
+	}
+
+	categories, err := c.Service.GetCategories()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Create a structured response with ordered fields
+	var responseCategories []map[string]interface{}
+	for _, category := range categories {
+		categoryData := map[string]interface{}{
+			"id":                  category.ID,
+			"type":                category.Type,
+			"sold_product_amount": category.SoldProductAmount,
+			"version":             category.Version,
+			"created_at":          category.CreatedAt.Format(time.RFC3339),
+			"updated_at":          category.UpdatedAt.Format(time.RFC3339),
+			"products":            []map[string]interface{}{},
+			"parent_id":           category.ParentID,
+		}
+
+		// Add product details to the response with ordered fields
+		for _, product := range category.Products {
+			productData := map[string]interface{}{
+				"id":         product.ID,
+				"title":      product.Title,
+				"price":      product.Price,
+				"stock":      product.Stock,
+				"created_at": product.CreatedAt.Format(time.RFC3339),
+				"updated_at": product.UpdatedAt.Format(time.RFC3339),
+			}
+			categoryData["products"] = append(categoryData["products"].([]map[string]interface{}), productData)
+		}
+
+		responseCategories = append(responseCategories, categoryData)
+	}
+
+	if view == "tree" {
+		config.SendJSONResponse(w, categoryTree(categories, responseCategories))
+		return
+	}
+
+	// Send the JSON response with ordered fields
+	config.SendJSONResponse(w, responseCategories)
+}
+
+// categoryTree nests the category responses under their parent's "children",
+// returning the top-level categories. responses must be in the same order as
+// categories.
+func categoryTree(categories []models.Category, responses []map[string]interface{}) []map[string]interface{} {
+	byID := make(map[uint]map[string]interface{}, len(categories))
+	for i, category := range categories {
+		responses[i]["children"] = []map[string]interface{}{}
+		byID[category.ID] = responses[i]
+	}
+
+	roots := []map[string]interface{}{}
+	for i, category := range categories {
+		var parent map[string]interface{}
+		if category.ParentID != nil {
+			parent = byID[*category.ParentID]
+		}
+		if parent == nil {
+			roots = append(roots, responses[i])
+			continue
+		}
+		parent["children"] = append(parent["children"].([]map[string]interface{}), responses[i])
+	}
+	return roots
+}
+
+// MoveCategory - Move a category and its subcategories under another parent, or to
+// the top level when parent_id is null
+func (c *CategoryController) MoveCategory(w http.ResponseWriter, r *http.Request) {
+	user, ok := authorize(w, r, c.Service.DB, models.PermCatalogWrite)
+	if !ok {
+		return
+	}
+
+	categoryID, err := strconv.Atoi(mux.Vars(r)["categoryId"])
+	if err != nil {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		return
+	}
+
+	var requestBody struct {
+		ParentID *uint `json:"parent_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	category, err := c.Repository.FindCategoryByID(categoryID)
+	if err != nil {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+
+	if !ifMatch(r, category.Version) {
+		http.Error(w, service.ErrVersionConflict.Error(), http.StatusPreconditionFailed)
+		return
+	}
+
+	before := *category
+	category.UpdatedAt = time.Now()
+	err = c.Service.DB.Transaction(func(tx *gorm.DB) error {
+		if err := service.NewCategoryService(tx).MoveCategory(category, requestBody.ParentID); err != nil {
+			return err
+		}
+		return service.RecordAudit(tx, r, user, "category.move", "category", category.ID, before, category)
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Parent category not found", http.StatusNotFound)
+		return
+	} else if errors.Is(err, service.ErrCategoryCycle) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if errors.Is(err, service.ErrVersionConflict) {
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", etag(category.Version))
+	config.SendJSONResponse(w, categoryResponse(*category))
+}
+
+// SetCategoryTaxRate - Set the tax rate of a category and the categories below it that
+// don't have their own; null inherits the parent's rate (requires taxes:manage)
+func (c *CategoryController) SetCategoryTaxRate(w http.ResponseWriter, r *http.Request) {
+	user, ok := authorize(w, r, c.Service.DB, models.PermTaxesManage)
+	if !ok {
+		return
+	}
+
+	categoryID, err := strconv.Atoi(mux.Vars(r)["categoryId"])
+	if err != nil {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		return
+	}
+
+	var requestBody struct {
+		TaxRateID *uint `json:"tax_rate_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	category, err := c.Repository.FindCategoryByID(categoryID)
+	if err != nil {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+
+	if !ifMatch(r, category.Version) {
+		http.Error(w, service.ErrVersionConflict.Error(), http.StatusPreconditionFailed)
+		return
+	}
+
+	if requestBody.TaxRateID != nil {
+		var count int64
+		c.Service.DB.Model(&models.TaxRate{}).Where("id = ?", *requestBody.TaxRateID).Count(&count)
+		if count == 0 {
+			http.Error(w, "Tax rate not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	before := *category
+	category.UpdatedAt = time.Now()
+	err = c.Service.DB.Transaction(func(tx *gorm.DB) error {
+		if err := service.NewCategoryService(tx).SetTaxRate(category, requestBody.TaxRateID); err != nil {
+			return err
+		}
+		return service.RecordAudit(tx, r, user, "category.set_tax_rate", "category", category.ID, before, category)
+	})
+	if errors.Is(err, service.ErrVersionConflict) {
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", etag(category.Version))
+	config.SendJSONResponse(w, categoryResponse(*category))
+}
+
+// UpdateCategory - Partially update category by ID using JSON Merge Patch
+func (c *CategoryController) UpdateCategory(w http.ResponseWriter, r *http.Request) {
+	user, ok := authorize(w, r, c.Service.DB, models.PermCatalogWrite)
+	if !ok {
+		return
+	}
+
+	categoryID, err := strconv.Atoi(mux.Vars(r)["categoryId"])
+	if err != nil {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		return
+	}
+
+	patch, err := decodeMergePatch(r)
+	if errors.Is(err, errUnsupportedPatch) {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	category, err := c.Repository.FindCategoryByID(categoryID)
+	if err != nil {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+
+	if !ifMatch(r, category.Version) {
+		http.Error(w, service.ErrVersionConflict.Error(), http.StatusPreconditionFailed)
+		return
+	}
+
+	// Only the members present in the patch are applied
+	before := *category
+	for field, value := range patch {
+		switch field {
+		case "type":
+			err = decodePatchField(field, value, &category.Type)
+		default:
+			err = fmt.Errorf("unknown field %s", field)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := category.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	category.UpdatedAt = time.Now()
+
+	err = c.Service.DB.Transaction(func(tx *gorm.DB) error {
+		if err := service.NewCategoryService(tx).UpdateCategory(category); err != nil {
+			return err
+		}
+		return service.RecordAudit(tx, r, user, "category.update", "category", category.ID, before, category)
+	})
+	if errors.Is(err, service.ErrVersionConflict) {
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", etag(category.Version))
+	config.SendJSONResponse(w, categoryResponse(*category))
+}
+
+// DeleteCategory - Delete category by ID
+func (c *CategoryController) DeleteCategory(w http.ResponseWriter, r *http.Request) {
+	user, ok := authorize(w, r, c.Service.DB, models.PermCatalogWrite)
+	if !ok {
+		return
+	}
+
+	categoryID, err := strconv.Atoi(mux.Vars(r)["categoryId"])
+	if err != nil {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		return
+	}
+
+	category, err := c.Repository.FindCategoryByID(categoryID)
+	if err != nil {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+
+	if !ifMatch(r, category.Version) {
+		http.Error(w, service.ErrVersionConflict.Error(), http.StatusPreconditionFailed)
+		return
+	}
+
+	// Subcategories would otherwise be left without their parent
+	var children int64
+	if err := c.Service.DB.Model(&models.Category{}).Where("parent_id = ?", category.ID).Count(&children).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if children > 0 {
+		http.Error(w, "Category has subcategories, move or delete them first", http.StatusConflict)
+		return
+	}
+
+	err = c.Service.DB.Transaction(func(tx *gorm.DB) error {
+		if err := service.NewCategoryService(tx).DeleteCategory(category); err != nil {
+			return err
+		}
+		return service.RecordAudit(tx, r, user, "category.delete", "category", category.ID, category, nil)
+	})
+	if errors.Is(err, service.ErrVersionConflict) {
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	config.SendJSONResponse(w, map[string]interface{}{
+		"message": "Category has been successfully deleted",
+	})
+}
+
+// categoryResponse is the full representation of a category without its products.
+func categoryResponse(category models.Category) map[string]interface{} {
+	return map[string]interface{}{
+		"id":                  category.ID,
+		"type":                category.Type,
+		"sold_product_amount": category.SoldProductAmount,
+		"version":             category.Version,
+		"created_at":          category.CreatedAt.Format(time.RFC3339),
+		"updated_at":          category.UpdatedAt.Format(time.RFC3339),
+		"parent_id":           category.ParentID,
+		"tax_rate_id":         category.TaxRateID,
+	}
+}
+
+// taxTotal returns the tax charged on a category's sales, which is zero
+// when it has none.
+func taxTotal(totals map[uint]service.CategoryTax, categoryID uint) service.CategoryTax {
+	if total, ok := totals[categoryID]; ok {
+		return total
+	}
+	return service.CategoryTax{Own: models.Rupiah(0), Total: models.Rupiah(0)}
+}
+
+// categoryPath returns the path from the top-level category down to the
+// category with the given id.
+func categoryPath(categories map[uint]models.Category, categoryID uint) []models.Category {
+	var path []models.Category
+	for id := &categoryID; id != nil && len(path) <= len(categories); {
+		category, ok := categories[*id]
+		if !ok {
+			break
+		}
+		path = append([]models.Category{category}, path...)
+		id = category.ParentID
+	}
+	return path
+}
+
+// breadcrumbs is the representation of a category path, top-level first.
+func breadcrumbs(path []models.Category) []map[string]interface{} {
+	response := make([]map[string]interface{}, 0, len(path))
+	for _, category := range path {
+		response = append(response, map[string]interface{}{
+			"id":   category.ID,
+			"type": category.Type,
+		})
+	}
+	return response
+}
+
+// GetCategory - Get a single category by ID, optionally with its products
+func (c *CategoryController) GetCategory(w http.ResponseWriter, r *http.Request) {
+	if _, ok := authorize(w, r, c.Service.DB, models.PermCatalogRead); !ok {
+		return
+	}
+
+	categoryID, err := strconv.Atoi(mux.Vars(r)["categoryId"])
+	if err != nil {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		return
+	}
+
+	expand, err := parseExpand(r, "products")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var category *models.Category
+	if expand["products"] {
+		category, err = c.Repository.FindCategoryWithProducts(categoryID)
+	} else {
+		category, err = c.Repository.FindCategoryByID(categoryID)
+	}
+	if err != nil {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+
+	response := categoryResponse(*category)
+	if expand["products"] {
+		products := make([]map[string]interface{}, 0, len(category.Products))
+		for _, product := range category.Products {
+			products = append(products, productResponse(product))
+		}
+		response["products"] = products
+	}
+
+	w.Header().Set("ETag", etag(category.Version))
+	config.SendJSONResponse(w, response)
+}
+
+// CategorySalesReport - Sold product amounts and tax per category, with the totals
+// of each category including everything below it (requires reports:read)
+func (c *CategoryController) CategorySalesReport(w http.ResponseWriter, r *http.Request) {
+	if _, ok := authorize(w, r, c.Service.DB, models.PermReportsRead); !ok {
+		return
+	}
+
+	var categories []models.Category
+	if err := c.Service.DB.Order("id").Find(&categories).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	totals, err := c.Service.SoldProductTotals()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	taxTotals, err := c.Service.TaxTotals()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]map[string]interface{}, 0, len(categories))
+	for _, category := range categories {
+		tax := taxTotal(taxTotals, category.ID)
+		response = append(response, map[string]interface{}{
+			"id":                        category.ID,
+			"type":                      category.Type,
+			"parent_id":                 category.ParentID,
+			"sold_product_amount":       category.SoldProductAmount,
+			"total_sold_product_amount": totals[category.ID],
+			"tax_amount":                tax.Own,
+			"total_tax_amount":          tax.Total,
+		})
+	}
+
+	if r.URL.Query().Get("view") == "tree" {
+		config.SendJSONResponse(w, categoryTree(categories, response))
+		return
+	}
+	config.SendJSONResponse(w, response)
+}
@@ -0,0 +1,216 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Pijuyy/testing_project4/config"
+	"github.com/Pijuyy/testing_project4/models"
+	"github.com/Pijuyy/testing_project4/service"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// GetExchangeRates - List the current exchange rates into the base currency (requires catalog:read)
+func GetExchangeRates(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := authorize(w, r, db, models.PermCatalogRead); !ok {
+			return
+		}
+
+		rates, err := service.CurrentExchangeRates(db)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responseRates := make([]map[string]interface{}, 0, len(rates))
+		for _, rate := range rates {
+			responseRates = append(responseRates, exchangeRateResponse(rate))
+		}
+
+		config.SendJSONResponse(w, map[string]interface{}{
+			"base_currency": models.DefaultCurrency,
+			"rates":         responseRates,
+		})
+	}
+}
+
+// SetExchangeRate - Set the current rate of a currency (requires exchange_rates:manage).
+// The rate is the value of one unit of the currency in the base currency.
+func SetExchangeRate(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authorize(w, r, db, models.PermExchangeRatesManage)
+		if !ok {
+			return
+		}
+
+		var requestBody struct {
+			Rate json.Number `json:"rate"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var rate *models.ExchangeRate
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			rate, err = service.SetExchangeRate(tx, mux.Vars(r)["currency"], requestBody.Rate.String(), models.ExchangeRateManual, &user.ID)
+			if err != nil {
+				return err
+			}
+			return service.RecordAudit(tx, r, user, "exchange_rate.set", "exchange_rate", rate.ID, nil, rate)
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		config.SendJSONResponse(w, exchangeRateResponse(*rate))
+	}
+}
+
+// ImportExchangeRates - Set exchange rates from a CSV file with currency and rate
+// columns (requires exchange_rates:manage). The CSV is sent as the request body or
+// as the "file" field of a multipart form. Either every rate is set or none.
+func ImportExchangeRates(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authorize(w, r, db, models.PermExchangeRatesManage)
+		if !ok {
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+		var file io.Reader = r.Body
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+			part, _, err := r.FormFile("file")
+			if err != nil {
+				http.Error(w, "file is required", http.StatusBadRequest)
+				return
+			}
+			defer part.Close()
+			file = part
+		}
+
+		var rates []models.ExchangeRate
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			if rates, err = service.ImportExchangeRates(tx, file, &user.ID); err != nil {
+				return err
+			}
+			return service.RecordAudit(tx, r, user, "exchange_rate.import", "exchange_rate", 0, nil, rates)
+		})
+		if errors.Is(err, service.ErrInvalidCSV) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responseRates := make([]map[string]interface{}, 0, len(rates))
+		for _, rate := range rates {
+			responseRates = append(responseRates, exchangeRateResponse(rate))
+		}
+
+		config.SendJSONResponse(w, map[string]interface{}{
+			"imported": len(rates),
+			"rates":    responseRates,
+		})
+	}
+}
+
+// GetExchangeRateHistory - List the rates a currency has had, newest first (requires exchange_rates:manage)
+func GetExchangeRateHistory(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := authorize(w, r, db, models.PermExchangeRatesManage); !ok {
+			return
+		}
+
+		page, limit := parsePagination(r)
+		query := db.Model(&models.ExchangeRate{}).Where("currency = ?", strings.ToUpper(mux.Vars(r)["currency"]))
+
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var rates []models.ExchangeRate
+		if err := query.Order("id DESC").Offset((page - 1) * limit).Limit(limit).Find(&rates).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responseRates := make([]map[string]interface{}, 0, len(rates))
+		for _, rate := range rates {
+			responseRates = append(responseRates, exchangeRateResponse(rate))
+		}
+
+		config.SendJSONResponse(w, map[string]interface{}{
+			"rates": responseRates,
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		})
+	}
+}
+
+func exchangeRateResponse(rate models.ExchangeRate) map[string]interface{} {
+	return map[string]interface{}{
+		"id":         rate.ID,
+		"currency":   rate.Currency,
+		"rate":       rate.Rate,
+		"source":     rate.Source,
+		"created_by": rate.CreatedBy,
+		"created_at": rate.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// displayRate returns the rate for showing prices in the currency picked with
+// the currency query parameter, or else in the currency of the user's wallet.
+// It is nil when prices are shown in the base currency, which is also what
+// they fall back to when the wallet's currency has no rate.
+func displayRate(w http.ResponseWriter, r *http.Request, db *gorm.DB, user *models.User) (*models.ExchangeRate, bool) {
+	currency := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("currency")))
+	picked := currency != ""
+	if !picked {
+		currency = user.Currency
+	}
+	if currency == "" || currency == models.DefaultCurrency {
+		return nil, true
+	}
+	if !models.ValidCurrency(currency) {
+		http.Error(w, models.ErrUnknownCurrency.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+
+	rate, err := service.ExchangeRateFor(db, currency)
+	if errors.Is(err, service.ErrNoExchangeRate) && !picked {
+		return nil, true
+	} else if errors.Is(err, service.ErrNoExchangeRate) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return rate, true
+}
+
+// displayPrice converts a base currency price for display, or returns nil
+// when it can't be converted.
+func displayPrice(price models.Money, rate *models.ExchangeRate) interface{} {
+	converted, err := service.ConvertForDisplay(price, rate)
+	if err != nil {
+		return nil
+	}
+	return converted
+}
@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Pijuyy/testing_project4/config"
+	"github.com/Pijuyy/testing_project4/models"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// parsePagination reads the page and limit query parameters, falling back to
+// sane defaults when they are missing or out of range.
+func parsePagination(r *http.Request) (page, limit int) {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	limit, err = strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit < 1 {
+		limit = defaultPageLimit
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+
+	return page, limit
+}
+
+// generateToken returns a random hex encoded token suitable for one-time links.
+func generateToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// authorize authenticates the request and checks the permission, writing a
+// 401 or 403 response when either fails.
+func authorize(w http.ResponseWriter, r *http.Request, db *gorm.DB, permission string) (*models.User, bool) {
+	user, err := config.Authorize(r, db, permission)
+	if err != nil {
+		if errors.Is(err, config.ErrForbidden) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+		} else {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		}
+		return nil, false
+	}
+
+	return user, true
+}
+
+// formatOptionalTime formats a nullable timestamp for JSON responses.
+func formatOptionalTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.Format(time.RFC3339)
+}
+
+// requestLocale returns the preferred locale from the Accept-Language
+// header, e.g. "id-ID", or "" when there is none.
+func requestLocale(r *http.Request) string {
+	locale, _, _ := strings.Cut(r.Header.Get("Accept-Language"), ",")
+	locale, _, _ = strings.Cut(locale, ";")
+	return strings.TrimSpace(locale)
+}
+
+// etag builds the entity tag sent for a versioned resource.
+func etag(version uint) string {
+	return `"` + strconv.FormatUint(uint64(version), 10) + `"`
+}
+
+// ifMatch reports whether the request's If-Match header, if any, matches the
+// resource version. A missing header or "*" always matches.
+func ifMatch(r *http.Request, version uint) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return true
+	}
+
+	current := etag(version)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == current {
+			return true
+		}
+	}
+
+	return false
+}
+
+// decodeMergePatch reads a JSON Merge Patch (RFC 7396) document. The body
+// must be a JSON object; its members are returned undecoded.
+func decodeMergePatch(r *http.Request) (map[string]json.RawMessage, error) {
+	contentType := r.Header.Get("Content-Type")
+	if contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || (mediaType != "application/merge-patch+json" && mediaType != "application/json") {
+			return nil, errUnsupportedPatch
+		}
+	}
+
+	var patch map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		return nil, errors.New("request body must be a JSON object")
+	}
+	if patch == nil {
+		return nil, errors.New("request body must be a JSON object")
+	}
+
+	return patch, nil
+}
+
+var errUnsupportedPatch = errors.New("Content-Type must be application/merge-patch+json")
+
+// decodePatchField decodes one member of a merge patch into dest. Fields that
+// are required cannot be removed, so a null value is rejected.
+func decodePatchField(name string, raw json.RawMessage, dest interface{}) error {
+	if string(raw) == "null" {
+		return fmt.Errorf("%s cannot be removed", name)
+	}
+	if err := json.Unmarshal(raw, dest); err != nil {
+		return fmt.Errorf("invalid value for %s", name)
+	}
+
+	return nil
+}
+
+// parseExpand reads the comma separated expand query parameter and checks
+// every entry against the expansions the endpoint supports.
+func parseExpand(r *http.Request, allowed ...string) (map[string]bool, error) {
+	expand := make(map[string]bool)
+	for _, value := range strings.Split(r.URL.Query().Get("expand"), ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if !slices.Contains(allowed, value) {
+			return nil, fmt.Errorf("cannot expand %s", value)
+		}
+		expand[value] = true
+	}
+
+	return expand, nil
+}
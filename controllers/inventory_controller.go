@@ -0,0 +1,359 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Pijuyy/testing_project4/config"
+	"github.com/Pijuyy/testing_project4/models"
+	"github.com/Pijuyy/testing_project4/service"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// CreateStockAdjustment - Restock, return or correct a product's stock (requires inventory:adjust)
+func CreateStockAdjustment(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authorize(w, r, db, models.PermInventoryAdjust)
+		if !ok {
+			return
+		}
+
+		productID, err := strconv.Atoi(mux.Vars(r)["productId"])
+		if err != nil {
+			http.Error(w, "Invalid product ID", http.StatusBadRequest)
+			return
+		}
+
+		var requestBody struct {
+			Type        string `json:"type"`
+			Quantity    int    `json:"quantity"`
+			Reason      string `json:"reason"`
+			WarehouseID uint   `json:"warehouse_id"`
+			VariantID   *uint  `json:"variant_id"`
+		}
+		err = json.NewDecoder(r.Body).Decode(&requestBody)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Sales are only recorded by transactions
+		if requestBody.Type == "" {
+			requestBody.Type = models.MovementAdjustment
+		}
+		if requestBody.Type == models.MovementSale || requestBody.Type == models.MovementTransfer {
+			http.Error(w, "sales and transfers cannot be recorded as stock adjustments", http.StatusBadRequest)
+			return
+		}
+
+		// Reject invalid movements up front; the transaction below only fails
+		// on a lack of stock or a server error
+		requestBody.Reason = strings.TrimSpace(requestBody.Reason)
+		check := models.InventoryMovement{Type: requestBody.Type, Quantity: requestBody.Quantity, Reason: requestBody.Reason}
+		if err := check.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var product models.Product
+		if err := db.First(&product, productID).Error; err != nil {
+			http.Error(w, "Product not found", http.StatusNotFound)
+			return
+		}
+
+		if requestBody.VariantID != nil {
+			var variant models.ProductVariant
+			if err := db.Where("id = ? AND product_id = ?", *requestBody.VariantID, product.ID).First(&variant).Error; err != nil {
+				http.Error(w, "Variant not found", http.StatusNotFound)
+				return
+			}
+		}
+
+		// Adjustments apply to the given warehouse, or the default one
+		warehouse, err := service.FindWarehouse(db, requestBody.WarehouseID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		var movement *models.InventoryMovement
+		var alert *models.StockAlert
+		err = db.Transaction(func(tx *gorm.DB) error {
+			movement, err = service.ApplyStockChange(tx, service.StockChange{
+				ProductID:   product.ID,
+				VariantID:   requestBody.VariantID,
+				WarehouseID: warehouse.ID,
+				Type:        requestBody.Type,
+				Quantity:    requestBody.Quantity,
+				Reason:      requestBody.Reason,
+				ActorID:     &user.ID,
+			})
+			if err != nil {
+				return err
+			}
+			if alert, err = service.RaiseStockAlert(tx, movement); err != nil {
+				return err
+			}
+
+			before := product
+			product.Stock = movement.StockAfter
+			return service.RecordAudit(tx, r, user, "product.adjust_stock", "product", product.ID, before, product)
+		})
+		if errors.Is(err, service.ErrInsufficientStock) {
+			http.Error(w, "stock cannot go below zero", http.StatusBadRequest)
+			return
+		} else if errors.Is(err, service.ErrVariantRequired) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		} else if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Product not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		service.NotifyStockAlerts(alert)
+
+		w.Header().Set("ETag", etag(product.Version))
+		w.WriteHeader(http.StatusCreated)
+		config.SendJSONResponse(w, inventoryMovementResponse(*movement))
+	}
+}
+
+// GetStockMovements - List the inventory movements of a product (requires inventory:read)
+func GetStockMovements(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := authorize(w, r, db, models.PermInventoryRead); !ok {
+			return
+		}
+
+		productID, err := strconv.Atoi(mux.Vars(r)["productId"])
+		if err != nil {
+			http.Error(w, "Invalid product ID", http.StatusBadRequest)
+			return
+		}
+
+		page, limit := parsePagination(r)
+		query := db.Model(&models.InventoryMovement{}).Where("product_id = ?", productID)
+		if movementType := r.URL.Query().Get("type"); movementType != "" {
+			query = query.Where("type = ?", movementType)
+		}
+		if warehouseID := r.URL.Query().Get("warehouse_id"); warehouseID != "" {
+			id, err := strconv.Atoi(warehouseID)
+			if err != nil {
+				http.Error(w, "Invalid warehouse ID", http.StatusBadRequest)
+				return
+			}
+			query = query.Where("warehouse_id = ?", id)
+		}
+
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var movements []models.InventoryMovement
+		if err := query.Order("id DESC").Offset((page - 1) * limit).Limit(limit).Find(&movements).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responseMovements := make([]map[string]interface{}, 0, len(movements))
+		for _, movement := range movements {
+			responseMovements = append(responseMovements, inventoryMovementResponse(movement))
+		}
+
+		config.SendJSONResponse(w, map[string]interface{}{
+			"movements": responseMovements,
+			"page":      page,
+			"limit":     limit,
+			"total":     total,
+		})
+	}
+}
+
+// GetInventoryReconciliation - Compare each product's stock with the sum of its movements and
+// its warehouse levels (requires reports:read)
+func GetInventoryReconciliation(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := authorize(w, r, db, models.PermReportsRead); !ok {
+			return
+		}
+
+		var rows []struct {
+			ProductID      uint
+			Title          string
+			Stock          int
+			MovementTotal  int
+			MovementCount  int
+			WarehouseTotal int
+			LastMovementAt *time.Time
+		}
+		err := db.Table("products AS p").
+			Select("p.id AS product_id, p.title, p.stock, COALESCE(SUM(m.quantity), 0) AS movement_total, " +
+				"COUNT(m.id) AS movement_count, MAX(m.created_at) AS last_movement_at, " +
+				"COALESCE((SELECT SUM(ws.quantity) FROM warehouse_stocks ws WHERE ws.product_id = p.id), 0) AS warehouse_total").
+			Joins("LEFT JOIN inventory_movements m ON m.product_id = p.id").
+			Group("p.id").
+			Order("p.id").
+			Scan(&rows).Error
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		onlyDiscrepancies := r.URL.Query().Get("discrepancies_only") == "true"
+		response := make([]map[string]interface{}, 0, len(rows))
+		discrepancies := 0
+		for _, row := range rows {
+			// Stock should match both its movements and its warehouse levels
+			discrepancy := row.Stock - row.MovementTotal
+			warehouseDiscrepancy := row.Stock - row.WarehouseTotal
+			if discrepancy != 0 || warehouseDiscrepancy != 0 {
+				discrepancies++
+			} else if onlyDiscrepancies {
+				continue
+			}
+
+			response = append(response, map[string]interface{}{
+				"product_id":            row.ProductID,
+				"title":                 row.Title,
+				"stock":                 row.Stock,
+				"movement_total":        row.MovementTotal,
+				"movement_count":        row.MovementCount,
+				"discrepancy":           discrepancy,
+				"warehouse_total":       row.WarehouseTotal,
+				"warehouse_discrepancy": warehouseDiscrepancy,
+				"last_movement_at":      formatOptionalTime(row.LastMovementAt),
+			})
+		}
+
+		config.SendJSONResponse(w, map[string]interface{}{
+			"products":      response,
+			"discrepancies": discrepancies,
+		})
+	}
+}
+
+// GetStockAlerts - List raised stock alerts, newest first (requires inventory:read)
+func GetStockAlerts(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := authorize(w, r, db, models.PermInventoryRead); !ok {
+			return
+		}
+
+		page, limit := parsePagination(r)
+		params := r.URL.Query()
+		query := db.Model(&models.StockAlert{})
+
+		if productID := params.Get("product_id"); productID != "" {
+			id, err := strconv.Atoi(productID)
+			if err != nil {
+				http.Error(w, "Invalid product ID", http.StatusBadRequest)
+				return
+			}
+			query = query.Where("product_id = ?", id)
+		}
+		if alertType := params.Get("type"); alertType != "" {
+			query = query.Where("type = ?", alertType)
+		}
+
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var alerts []models.StockAlert
+		if err := query.Order("id DESC").Offset((page - 1) * limit).Limit(limit).Find(&alerts).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responseAlerts := make([]map[string]interface{}, 0, len(alerts))
+		for _, alert := range alerts {
+			responseAlerts = append(responseAlerts, map[string]interface{}{
+				"id":             alert.ID,
+				"product_id":     alert.ProductID,
+				"product_title":  alert.ProductTitle,
+				"type":           alert.Type,
+				"stock":          alert.Stock,
+				"threshold":      alert.Threshold,
+				"movement_id":    alert.MovementID,
+				"transaction_id": alert.TransactionID,
+				"created_at":     alert.CreatedAt.Format(time.RFC3339),
+			})
+		}
+
+		config.SendJSONResponse(w, map[string]interface{}{
+			"alerts": responseAlerts,
+			"page":   page,
+			"limit":  limit,
+			"total":  total,
+		})
+	}
+}
+
+// GetLowStockProducts - List products at or below their low-stock threshold (requires inventory:read).
+// Pass status=out_of_stock to only list products that have run out.
+func GetLowStockProducts(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := authorize(w, r, db, models.PermInventoryRead); !ok {
+			return
+		}
+
+		query := db.Where("stock <= low_stock_threshold")
+		switch r.URL.Query().Get("status") {
+		case "":
+		case models.StockAlertOutOfStock:
+			query = query.Where("stock = 0")
+		case models.StockAlertLowStock:
+			query = query.Where("stock > 0")
+		default:
+			http.Error(w, "status must be low_stock or out_of_stock", http.StatusBadRequest)
+			return
+		}
+
+		var products []models.Product
+		if err := query.Order("stock, id").Find(&products).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		response := make([]map[string]interface{}, 0, len(products))
+		for _, product := range products {
+			status := models.StockAlertLowStock
+			if product.Stock == 0 {
+				status = models.StockAlertOutOfStock
+			}
+
+			productData := productResponse(product)
+			productData["status"] = status
+			response = append(response, productData)
+		}
+
+		config.SendJSONResponse(w, response)
+	}
+}
+
+func inventoryMovementResponse(movement models.InventoryMovement) map[string]interface{} {
+	return map[string]interface{}{
+		"id":             movement.ID,
+		"product_id":     movement.ProductID,
+		"warehouse_id":   movement.WarehouseID,
+		"variant_id":     movement.VariantID,
+		"type":           movement.Type,
+		"quantity":       movement.Quantity,
+		"stock_after":    movement.StockAfter,
+		"reason":         movement.Reason,
+		"actor_id":       movement.ActorID,
+		"transaction_id": movement.TransactionID,
+		"created_at":     movement.CreatedAt.Format(time.RFC3339),
+	}
+}
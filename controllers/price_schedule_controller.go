@@ -0,0 +1,252 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Pijuyy/testing_project4/config"
+	"github.com/Pijuyy/testing_project4/models"
+	"github.com/Pijuyy/testing_project4/service"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// CreatePriceSchedule - Schedule a sale price for a product (requires catalog:write)
+func CreatePriceSchedule(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authorize(w, r, db, models.PermCatalogWrite)
+		if !ok {
+			return
+		}
+
+		product, ok := findProductFromPath(w, r, db)
+		if !ok {
+			return
+		}
+
+		var requestBody struct {
+			Name        string       `json:"name"`
+			SalePrice   models.Money `json:"sale_price"`
+			StartsAt    time.Time    `json:"starts_at"`
+			EndsAt      time.Time    `json:"ends_at"`
+			QuantityCap *int         `json:"quantity_cap"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		schedule := models.PriceSchedule{
+			ProductID:   product.ID,
+			Name:        strings.TrimSpace(requestBody.Name),
+			SalePrice:   requestBody.SalePrice,
+			StartsAt:    requestBody.StartsAt,
+			EndsAt:      requestBody.EndsAt,
+			QuantityCap: requestBody.QuantityCap,
+			Active:      true,
+			CreatedBy:   &user.ID,
+		}
+		if err := schedule.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !schedule.EndsAt.After(time.Now()) {
+			http.Error(w, "ends_at must be in the future", http.StatusBadRequest)
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := service.CreatePriceSchedule(tx, *product, &schedule); err != nil {
+				return err
+			}
+			return service.RecordAudit(tx, r, user, "price_schedule.create", "price_schedule", schedule.ID, nil, schedule)
+		})
+		if errors.Is(err, service.ErrScheduleOverlap) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		config.SendJSONResponse(w, priceScheduleResponse(schedule))
+	}
+}
+
+// GetPriceSchedules - List a product's sales, latest first (requires catalog:read).
+// Pass include_inactive=true to include cancelled sales.
+func GetPriceSchedules(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := authorize(w, r, db, models.PermCatalogRead); !ok {
+			return
+		}
+
+		product, ok := findProductFromPath(w, r, db)
+		if !ok {
+			return
+		}
+
+		query := db.Where("product_id = ?", product.ID)
+		if r.URL.Query().Get("include_inactive") != "true" {
+			query = query.Where("active = ?", true)
+		}
+
+		var schedules []models.PriceSchedule
+		if err := query.Order("starts_at DESC, id DESC").Find(&schedules).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responseSchedules := make([]map[string]interface{}, 0, len(schedules))
+		for _, schedule := range schedules {
+			responseSchedules = append(responseSchedules, priceScheduleResponse(schedule))
+		}
+
+		config.SendJSONResponse(w, map[string]interface{}{
+			"price_schedules": responseSchedules,
+		})
+	}
+}
+
+// CancelPriceSchedule - Cancel a scheduled or running sale (requires catalog:write)
+func CancelPriceSchedule(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authorize(w, r, db, models.PermCatalogWrite)
+		if !ok {
+			return
+		}
+
+		product, ok := findProductFromPath(w, r, db)
+		if !ok {
+			return
+		}
+
+		scheduleID, err := strconv.Atoi(mux.Vars(r)["scheduleId"])
+		if err != nil {
+			http.Error(w, "Invalid price schedule ID", http.StatusBadRequest)
+			return
+		}
+
+		var schedule models.PriceSchedule
+		if err := db.Where("id = ? AND product_id = ?", scheduleID, product.ID).First(&schedule).Error; err != nil {
+			http.Error(w, "Price schedule not found", http.StatusNotFound)
+			return
+		}
+		if !schedule.Active {
+			http.Error(w, "The sale has already been cancelled", http.StatusConflict)
+			return
+		}
+
+		before := schedule
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := service.CancelPriceSchedule(tx, *product, &schedule, &user.ID); err != nil {
+				return err
+			}
+			return service.RecordAudit(tx, r, user, "price_schedule.cancel", "price_schedule", schedule.ID, before, schedule)
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		config.SendJSONResponse(w, priceScheduleResponse(schedule))
+	}
+}
+
+// GetPriceHistory - List a product's price changes, newest first (requires catalog:write)
+func GetPriceHistory(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := authorize(w, r, db, models.PermCatalogWrite); !ok {
+			return
+		}
+
+		product, ok := findProductFromPath(w, r, db)
+		if !ok {
+			return
+		}
+
+		page, limit := parsePagination(r)
+		query := db.Model(&models.PriceChange{}).Where("product_id = ?", product.ID)
+
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var changes []models.PriceChange
+		if err := query.Order("id DESC").Offset((page - 1) * limit).Limit(limit).Find(&changes).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responseChanges := make([]map[string]interface{}, 0, len(changes))
+		for _, change := range changes {
+			responseChanges = append(responseChanges, map[string]interface{}{
+				"id":                change.ID,
+				"source":            change.Source,
+				"old_price":         change.OldPrice,
+				"new_price":         change.NewPrice,
+				"price_schedule_id": change.PriceScheduleID,
+				"effective_from":    formatOptionalTime(change.EffectiveFrom),
+				"effective_until":   formatOptionalTime(change.EffectiveUntil),
+				"actor_id":          change.ActorID,
+				"created_at":        change.CreatedAt.Format(time.RFC3339),
+			})
+		}
+
+		config.SendJSONResponse(w, map[string]interface{}{
+			"product_id": product.ID,
+			"price":      product.Price,
+			"changes":    responseChanges,
+			"page":       page,
+			"limit":      limit,
+			"total":      total,
+		})
+	}
+}
+
+func priceScheduleResponse(schedule models.PriceSchedule) map[string]interface{} {
+	return map[string]interface{}{
+		"id":            schedule.ID,
+		"product_id":    schedule.ProductID,
+		"name":          schedule.Name,
+		"sale_price":    schedule.SalePrice,
+		"starts_at":     schedule.StartsAt.Format(time.RFC3339),
+		"ends_at":       schedule.EndsAt.Format(time.RFC3339),
+		"quantity_cap":  schedule.QuantityCap,
+		"sold_quantity": schedule.SoldQuantity,
+		"remaining":     schedule.Remaining(),
+		"active":        schedule.Active,
+		"created_by":    schedule.CreatedBy,
+		"created_at":    schedule.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// salePriced returns the product with its price set to what it sells for
+// during the sale, if there is one.
+func salePriced(product models.Product, sale *models.PriceSchedule) models.Product {
+	if sale != nil {
+		product.Price = sale.SalePrice
+	}
+	return product
+}
+
+// saleResponse describes the sale running on a product, or nil.
+func saleResponse(sale *models.PriceSchedule) interface{} {
+	if sale == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"id":         sale.ID,
+		"name":       sale.Name,
+		"sale_price": sale.SalePrice,
+		"ends_at":    sale.EndsAt.Format(time.RFC3339),
+		"remaining":  sale.Remaining(),
+	}
+}
@@ -1,202 +1,617 @@
-package controllers
-
-import (
-	"encoding/json"
-	"net/http"
-	"strconv"
-	"time"
-
-	"github.com/Pijuyy/testing_project4/config"
-	"github.com/Pijuyy/testing_project4/models"
-	"github.com/gorilla/mux"
-	"gorm.io/gorm"
-)
-
-// CreateProduct - Create a new product
-func CreateProduct(db *gorm.DB) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// Authenticate and authorize the user
-		_, err := config.AuthenticateAndAuthorize(r, db)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
-
-		var requestBody struct {
-			Title      string `json:"title"`
-			Price      int    `json:"price"`
-			Stock      int    `json:"stock"`
-			CategoryID int    `json:"category_id"`
-		}
-		err = json.NewDecoder(r.Body).Decode(&requestBody)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-
-		// Check if the specified category exists
-		var category models.Category
-		result := db.First(&category, requestBody.CategoryID)
-		if result.Error != nil {
-			http.Error(w, "Category not found", http.StatusNotFound)
-			return
-		}
-
-		product := models.Product{
-			Title:      requestBody.Title,
-			Price:      requestBody.Price,
-			Stock:      requestBody.Stock,
-			CategoryID: uint(requestBody.CategoryID),
-			CreatedAt:  time.Now(),
-		}
-
-		result = db.Create(&product)
-		if result.Error != nil {
-			http.Error(w, result.Error.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		w.WriteHeader(http.StatusCreated)
-		config.SendJSONResponse(w, map[string]interface{}{
-			"id":          product.ID,
-			"title":       product.Title,
-			"price":       product.Price,
-			"stock":       product.Stock,
-			"category_id": product.CategoryID,
-			"created_at":  product.CreatedAt.Format(time.RFC3339),
-		})
-	}
-}
-
-// GetProducts - Get all products
-func GetProducts(db *gorm.DB) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// Authenticate and authorize the user
-		_, err := config.AuthenticateAndAuthorize(r, db)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
-
-		var products []models.Product
-		result := db.Find(&products)
-		if result.Error != nil {
-			http.Error(w, result.Error.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		// Create a structured response with ordered fields
-		var responseProducts []map[string]interface{}
-		for _, product := range products {
-			productData := map[string]interface{}{
-				"id":          product.ID,
-				"title":       product.Title,
-				"price":       product.Price,
-				"stock":       product.Stock,
-				"category_id": product.CategoryID,
-				"created_at":  product.CreatedAt.Format(time.RFC3339),
-			}
-
-			responseProducts = append(responseProducts, productData)
-		}
-
-		// Send the JSON response with ordered fields
-		config.SendJSONResponse(w, responseProducts)
-	}
-}
-
-// UpdateProduct - Update product by ID
-func UpdateProduct(db *gorm.DB) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// Authenticate and authorize the user
-		_, err := config.AuthenticateAndAuthorize(r, db)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
-
-		productID, err := strconv.Atoi(mux.Vars(r)["productId"])
-		if err != nil {
-			http.Error(w, "Invalid product ID", http.StatusBadRequest)
-			return
-		}
-
-		var requestBody struct {
-			Title      string `json:"title"`
-			Price      int    `json:"price"`
-			Stock      int    `json:"stock"`
-			CategoryID int    `json:"category_id"`
-		}
-		err = json.NewDecoder(r.Body).Decode(&requestBody)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-
-		// Check if the specified category exists
-		var category models.Category
-		result := db.First(&category, requestBody.CategoryID)
-		if result.Error != nil {
-			http.Error(w, "Category not found", http.StatusNotFound)
-			return
-		}
-
-		var product models.Product
-		result = db.First(&product, productID)
-		if result.Error != nil {
-			http.Error(w, "Product not found", http.StatusNotFound)
-			return
-		}
-
-		product.Title = requestBody.Title
-		product.Price = requestBody.Price
-		product.Stock = requestBody.Stock
-		product.CategoryID = uint(requestBody.CategoryID)
-		product.UpdatedAt = time.Now()
-
-		db.Save(&product)
-
-		config.SendJSONResponse(w, map[string]interface{}{
-			"Products": map[string]interface{}{
-				"id":          product.ID,
-				"title":       product.Title,
-				"price":       product.Price,
-				"stock":       product.Stock,
-				"category_id": product.CategoryID,
-				"created_at":  product.CreatedAt.Format(time.RFC3339),
-				"updated_at":  product.UpdatedAt.Format(time.RFC3339),
-			},
-		})
-	}
-}
-
-// DeleteProduct - Delete product by ID
-func DeleteProduct(db *gorm.DB) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// Authenticate and authorize the user
-		_, err := config.AuthenticateAndAuthorize(r, db)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
-
-		productID, err := strconv.Atoi(mux.Vars(r)["productId"])
-		if err != nil {
-			http.Error(w, "Invalid product ID", http.StatusBadRequest)
-			return
-		}
-
-		var product models.Product
-		result := db.First(&product, productID)
-		if result.Error != nil {
-			http.Error(w, "Product not found", http.StatusNotFound)
-			return
-		}
-
-		db.Delete(&product)
-
-		config.SendJSONResponse(w, map[string]interface{}{
-			"message": "Product has been successfully deleted",
-		})
-	}
-}
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Pijuyy/testing_project4/config"
+	"github.com/Pijuyy/testing_project4/models"
+	"github.com/Pijuyy/testing_project4/service"
+	"github.com/Pijuyy/testing_project4/storage"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// errStockReadOnly is returned when a patch tries to change the stock, which
+// only moves through recorded stock adjustments.
+var errStockReadOnly = errors.New("stock cannot be edited directly, use POST /products/{productId}/stock-adjustments")
+
+// defaultLowStockThreshold is used when a new product does not specify one.
+const defaultLowStockThreshold = 5
+
+// CreateProduct - Create a new product
+func CreateProduct(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authenticate and authorize the user
+		user, ok := authorize(w, r, db, models.PermCatalogWrite)
+		if !ok {
+			return
+		}
+
+		var requestBody struct {
+			Title      string       `json:"title"`
+			Price      models.Money `json:"price"`
+			Stock      int          `json:"stock"`
+			CategoryID int          `json:"category_id"`
+
+			LowStockThreshold *int   `json:"low_stock_threshold"`
+			WarehouseID       uint   `json:"warehouse_id"`
+			SKU               string `json:"sku"`
+			Description       string `json:"description"`
+			WeightGrams       int    `json:"weight_grams"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&requestBody)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// The initial stock goes to the given warehouse, or the default one
+		warehouse, err := service.FindWarehouse(db, requestBody.WarehouseID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		// Check if the specified category exists
+		var category models.Category
+		result := db.First(&category, requestBody.CategoryID)
+		if result.Error != nil {
+			http.Error(w, "Category not found", http.StatusNotFound)
+			return
+		}
+
+		product := models.Product{
+			Title:      requestBody.Title,
+			Price:      requestBody.Price,
+			Stock:      requestBody.Stock,
+			CategoryID: uint(requestBody.CategoryID),
+			CreatedAt:  time.Now(),
+
+			LowStockThreshold: defaultLowStockThreshold,
+			SKU:               models.NormalizeSKU(requestBody.SKU),
+			Description:       requestBody.Description,
+			WeightGrams:       requestBody.WeightGrams,
+		}
+		if requestBody.LowStockThreshold != nil {
+			product.LowStockThreshold = *requestBody.LowStockThreshold
+		}
+
+		if taken, err := service.SKUTaken(db, product.SKU, 0); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		} else if taken {
+			http.Error(w, "SKU already exists", http.StatusConflict)
+			return
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := service.CreateProduct(tx, &product, warehouse.ID, &user.ID); err != nil {
+				return err
+			}
+			return service.RecordAudit(tx, r, user, "product.create", "product", product.ID, nil, product)
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("ETag", etag(product.Version))
+		w.WriteHeader(http.StatusCreated)
+		config.SendJSONResponse(w, map[string]interface{}{
+			"id":          product.ID,
+			"title":       product.Title,
+			"price":       product.Price,
+			"stock":       product.Stock,
+			"category_id": product.CategoryID,
+			"version":     product.Version,
+			"created_at":  product.CreatedAt.Format(time.RFC3339),
+
+			"low_stock_threshold": product.LowStockThreshold,
+			"sku":                 product.SKU,
+			"description":         product.Description,
+			"weight_grams":        product.WeightGrams,
+		})
+	}
+}
+
+// GetProducts - Get all products
+func GetProducts(db *gorm.DB, store storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authenticate and authorize the user
+		user, ok := authorize(w, r, db, models.PermCatalogRead)
+		if !ok {
+			return
+		}
+
+		rate, ok := displayRate(w, r, db, user)
+		if !ok {
+			return
+		}
+
+		// Filtering by category includes the products of its subcategories
+		filters, err := parseCatalogueFilters(r, db)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Pass sort=rating to list the best rated products first
+		order := "id"
+		switch r.URL.Query().Get("sort") {
+		case "":
+		case "rating":
+			order = "rating_average DESC, rating_count DESC, id"
+		default:
+			http.Error(w, "sort must be rating", http.StatusBadRequest)
+			return
+		}
+
+		var products []models.Product
+		result := filters.Apply(db.Preload("Variants", func(db *gorm.DB) *gorm.DB {
+			return db.Order("id")
+		}).Preload("Images", orderImages)).Order(order).Find(&products)
+		if result.Error != nil {
+			http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var categories []models.Category
+		if err := db.Find(&categories).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		categoriesByID := make(map[uint]models.Category, len(categories))
+		for _, category := range categories {
+			categoriesByID[category.ID] = category
+		}
+
+		productIDs := make([]uint, 0, len(products))
+		for _, product := range products {
+			productIDs = append(productIDs, product.ID)
+		}
+		sales, err := service.ActivePriceSchedules(db, productIDs)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Create a structured response with ordered fields
+		var responseProducts []map[string]interface{}
+		for _, product := range products {
+			var sale *models.PriceSchedule
+			if schedule, ok := sales[product.ID]; ok {
+				sale = &schedule
+			}
+
+			productData := map[string]interface{}{
+				"id":          product.ID,
+				"title":       product.Title,
+				"price":       product.Price,
+				"stock":       product.Stock,
+				"category_id": product.CategoryID,
+				"version":     product.Version,
+				"created_at":  product.CreatedAt.Format(time.RFC3339),
+
+				"low_stock_threshold": product.LowStockThreshold,
+				"sku":                 product.SKU,
+				"reserved":            product.Reserved,
+				"available":           product.Available(),
+				"description":         product.Description,
+				"rating_average":      product.RatingAverage,
+				"rating_count":        product.RatingCount,
+				"weight_grams":        product.WeightGrams,
+				"variants":            variantResponses(product.Variants, salePriced(product, sale)),
+				"images":              productImageResponses(product.Images, store),
+				"primary_image_url":   primaryImageURL(product.Images, store),
+				"breadcrumbs":         breadcrumbs(categoryPath(categoriesByID, product.CategoryID)),
+				"effective_price":     salePriced(product, sale).Price,
+				"sale":                saleResponse(sale),
+				"display_price":       displayPrice(salePriced(product, sale).Price, rate),
+			}
+
+			responseProducts = append(responseProducts, productData)
+		}
+
+		// Send the JSON response with ordered fields
+		config.SendJSONResponse(w, responseProducts)
+	}
+}
+
+// UpdateProduct - Update product by ID
+func UpdateProduct(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authenticate and authorize the user
+		user, ok := authorize(w, r, db, models.PermCatalogWrite)
+		if !ok {
+			return
+		}
+
+		productID, err := strconv.Atoi(mux.Vars(r)["productId"])
+		if err != nil {
+			http.Error(w, "Invalid product ID", http.StatusBadRequest)
+			return
+		}
+
+		// A stock sent along, e.g. from a product read earlier, is ignored;
+		// stock only changes through stock adjustments
+		var requestBody struct {
+			Title      string       `json:"title"`
+			Price      models.Money `json:"price"`
+			CategoryID int          `json:"category_id"`
+
+			LowStockThreshold *int    `json:"low_stock_threshold"`
+			SKU               *string `json:"sku"`
+			Description       *string `json:"description"`
+			WeightGrams       *int    `json:"weight_grams"`
+		}
+		err = json.NewDecoder(r.Body).Decode(&requestBody)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Check if the specified category exists
+		var category models.Category
+		result := db.First(&category, requestBody.CategoryID)
+		if result.Error != nil {
+			http.Error(w, "Category not found", http.StatusNotFound)
+			return
+		}
+
+		var product models.Product
+		result = db.First(&product, productID)
+		if result.Error != nil {
+			http.Error(w, "Product not found", http.StatusNotFound)
+			return
+		}
+
+		if !ifMatch(r, product.Version) {
+			http.Error(w, service.ErrVersionConflict.Error(), http.StatusPreconditionFailed)
+			return
+		}
+
+		before := product
+		product.Title = requestBody.Title
+		product.Price = requestBody.Price
+		product.CategoryID = uint(requestBody.CategoryID)
+		if requestBody.LowStockThreshold != nil {
+			product.LowStockThreshold = *requestBody.LowStockThreshold
+		}
+		if requestBody.SKU != nil {
+			product.SKU = models.NormalizeSKU(*requestBody.SKU)
+		}
+		if requestBody.Description != nil {
+			product.Description = *requestBody.Description
+		}
+		if requestBody.WeightGrams != nil {
+			product.WeightGrams = *requestBody.WeightGrams
+		}
+		product.UpdatedAt = time.Now()
+
+		if err := product.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if taken, err := service.SKUTaken(db, product.SKU, product.ID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		} else if taken {
+			http.Error(w, "SKU already exists", http.StatusConflict)
+			return
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := service.UpdateProduct(tx, &product); err != nil {
+				return err
+			}
+			if err := service.RecordManualPriceChange(tx, before, product, models.PriceChangeManual, &user.ID); err != nil {
+				return err
+			}
+			return service.RecordAudit(tx, r, user, "product.update", "product", product.ID, before, product)
+		})
+		if errors.Is(err, service.ErrVersionConflict) {
+			http.Error(w, err.Error(), http.StatusPreconditionFailed)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("ETag", etag(product.Version))
+
+		config.SendJSONResponse(w, map[string]interface{}{
+			"Products": productResponse(product),
+		})
+	}
+}
+
+// DeleteProduct - Delete product by ID
+func DeleteProduct(db *gorm.DB, store storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authenticate and authorize the user
+		user, ok := authorize(w, r, db, models.PermCatalogWrite)
+		if !ok {
+			return
+		}
+
+		productID, err := strconv.Atoi(mux.Vars(r)["productId"])
+		if err != nil {
+			http.Error(w, "Invalid product ID", http.StatusBadRequest)
+			return
+		}
+
+		var product models.Product
+		result := db.First(&product, productID)
+		if result.Error != nil {
+			http.Error(w, "Product not found", http.StatusNotFound)
+			return
+		}
+
+		if !ifMatch(r, product.Version) {
+			http.Error(w, service.ErrVersionConflict.Error(), http.StatusPreconditionFailed)
+			return
+		}
+
+		var images []models.ProductImage
+		err = db.Transaction(func(tx *gorm.DB) error {
+			// Variants, images and wishlist entries reference the product, so they go first
+			if err := tx.Where("product_id = ?", product.ID).Delete(&models.ProductVariant{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("product_id = ?", product.ID).Delete(&models.WishlistItem{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("product_id = ?", product.ID).Find(&images).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("product_id = ?", product.ID).Delete(&models.ProductImage{}).Error; err != nil {
+				return err
+			}
+			result := tx.Where("version = ?", product.Version).Delete(&product)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return service.ErrVersionConflict
+			}
+			if err := tx.Where("product_id = ?", product.ID).Delete(&models.WarehouseStock{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("product_id = ?", product.ID).Delete(&models.Review{}).Error; err != nil {
+				return err
+			}
+			return service.RecordAudit(tx, r, user, "product.delete", "product", product.ID, product, nil)
+		})
+		if errors.Is(err, service.ErrVersionConflict) {
+			http.Error(w, err.Error(), http.StatusPreconditionFailed)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// The files are only removed once the images are gone from the database
+		for _, image := range images {
+			service.DeleteImageFiles(store, image)
+		}
+
+		config.SendJSONResponse(w, map[string]interface{}{
+			"message": "Product has been successfully deleted",
+		})
+	}
+}
+
+// PatchProduct - Partially update a product using JSON Merge Patch
+func PatchProduct(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authenticate and authorize the user
+		user, ok := authorize(w, r, db, models.PermCatalogWrite)
+		if !ok {
+			return
+		}
+
+		productID, err := strconv.Atoi(mux.Vars(r)["productId"])
+		if err != nil {
+			http.Error(w, "Invalid product ID", http.StatusBadRequest)
+			return
+		}
+
+		patch, err := decodeMergePatch(r)
+		if errors.Is(err, errUnsupportedPatch) {
+			http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var product models.Product
+		result := db.First(&product, productID)
+		if result.Error != nil {
+			http.Error(w, "Product not found", http.StatusNotFound)
+			return
+		}
+
+		if !ifMatch(r, product.Version) {
+			http.Error(w, service.ErrVersionConflict.Error(), http.StatusPreconditionFailed)
+			return
+		}
+
+		// Only the members present in the patch are applied
+		before := product
+		for field, value := range patch {
+			switch field {
+			case "title":
+				err = decodePatchField(field, value, &product.Title)
+			case "price":
+				err = decodePatchField(field, value, &product.Price)
+			case "stock":
+				err = decodePatchField(field, value, &product.Stock)
+				if err == nil && product.Stock != before.Stock {
+					err = errStockReadOnly
+				}
+			case "category_id":
+				err = decodePatchField(field, value, &product.CategoryID)
+			case "low_stock_threshold":
+				err = decodePatchField(field, value, &product.LowStockThreshold)
+			case "sku":
+				// The SKU is optional, so null removes it
+				var sku string
+				if string(value) != "null" {
+					err = decodePatchField(field, value, &sku)
+				}
+				product.SKU = models.NormalizeSKU(sku)
+			case "description":
+				err = decodePatchField(field, value, &product.Description)
+			case "weight_grams":
+				err = decodePatchField(field, value, &product.WeightGrams)
+			default:
+				err = fmt.Errorf("unknown field %s", field)
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		if err := product.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if taken, err := service.SKUTaken(db, product.SKU, product.ID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		} else if taken {
+			http.Error(w, "SKU already exists", http.StatusConflict)
+			return
+		}
+
+		// Check if the specified category exists
+		if product.CategoryID != before.CategoryID {
+			var category models.Category
+			if err := db.First(&category, product.CategoryID).Error; err != nil {
+				http.Error(w, "Category not found", http.StatusNotFound)
+				return
+			}
+		}
+
+		product.UpdatedAt = time.Now()
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := service.UpdateProduct(tx, &product); err != nil {
+				return err
+			}
+			if err := service.RecordManualPriceChange(tx, before, product, models.PriceChangeManual, &user.ID); err != nil {
+				return err
+			}
+			return service.RecordAudit(tx, r, user, "product.update", "product", product.ID, before, product)
+		})
+		if errors.Is(err, service.ErrVersionConflict) {
+			http.Error(w, err.Error(), http.StatusPreconditionFailed)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("ETag", etag(product.Version))
+		config.SendJSONResponse(w, productResponse(product))
+	}
+}
+
+// productResponse is the full representation of a product.
+func productResponse(product models.Product) map[string]interface{} {
+	return map[string]interface{}{
+		"id":          product.ID,
+		"title":       product.Title,
+		"price":       product.Price,
+		"stock":       product.Stock,
+		"category_id": product.CategoryID,
+		"version":     product.Version,
+		"created_at":  product.CreatedAt.Format(time.RFC3339),
+		"updated_at":  product.UpdatedAt.Format(time.RFC3339),
+
+		"low_stock_threshold": product.LowStockThreshold,
+		"sku":                 product.SKU,
+		"reserved":            product.Reserved,
+		"available":           product.Available(),
+		"description":         product.Description,
+		"rating_average":      product.RatingAverage,
+		"rating_count":        product.RatingCount,
+		"weight_grams":        product.WeightGrams,
+	}
+}
+
+// GetProduct - Get a single product by ID, optionally with its category
+func GetProduct(db *gorm.DB, store storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authenticate and authorize the user
+		user, ok := authorize(w, r, db, models.PermCatalogRead)
+		if !ok {
+			return
+		}
+
+		rate, ok := displayRate(w, r, db, user)
+		if !ok {
+			return
+		}
+
+		productID, err := strconv.Atoi(mux.Vars(r)["productId"])
+		if err != nil {
+			http.Error(w, "Invalid product ID", http.StatusBadRequest)
+			return
+		}
+
+		expand, err := parseExpand(r, "category")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		query := db.Preload("Variants", func(db *gorm.DB) *gorm.DB {
+			return db.Order("id")
+		}).Preload("Images", orderImages)
+		if expand["category"] {
+			query = query.Preload("Category")
+		}
+
+		var product models.Product
+		if err := query.First(&product, productID).Error; err != nil {
+			http.Error(w, "Product not found", http.StatusNotFound)
+			return
+		}
+
+		_, sale, err := service.EffectivePrice(db, product)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		response := productResponse(product)
+		response["variants"] = variantResponses(product.Variants, salePriced(product, sale))
+		response["effective_price"] = salePriced(product, sale).Price
+		response["sale"] = saleResponse(sale)
+		response["display_price"] = displayPrice(salePriced(product, sale).Price, rate)
+		response["images"] = productImageResponses(product.Images, store)
+		response["primary_image_url"] = primaryImageURL(product.Images, store)
+
+		path, err := service.NewCategoryService(db).Ancestors(product.CategoryID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		response["breadcrumbs"] = breadcrumbs(path)
+		if expand["category"] {
+			response["category"] = categoryResponse(product.Category)
+		}
+
+		w.Header().Set("ETag", etag(product.Version))
+		config.SendJSONResponse(w, response)
+	}
+}
@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Pijuyy/testing_project4/models"
+	"github.com/Pijuyy/testing_project4/service"
+)
+
+func TestCustomerListsProductsInDisplayCurrency(t *testing.T) {
+	db := testDB(t)
+	customer := createTestUser(t, db, models.RoleCustomer)
+
+	category := models.Category{Type: fmt.Sprintf("%s %d", t.Name(), time.Now().UnixNano())}
+	if err := db.Create(&category).Error; err != nil {
+		t.Fatal(err)
+	}
+	product := models.Product{Title: category.Type, Price: models.Rupiah(25000), Stock: 5, CategoryID: category.ID}
+	if err := db.Create(&product).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.SetExchangeRate(db, "USD", "12500", models.ExchangeRateManual, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/products?category_id=%d&currency=USD", category.ID), nil)
+	authenticate(t, r, customer)
+	w := httptest.NewRecorder()
+
+	GetProducts(db, nil)(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", w.Code, w.Body)
+	}
+
+	var products []struct {
+		ID           uint
+		DisplayPrice struct {
+			Amount   int64
+			Currency string
+		} `json:"display_price"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &products); err != nil {
+		t.Fatal(err)
+	}
+	// Rp25.000 at Rp12.500 to the dollar
+	if len(products) != 1 || products[0].ID != product.ID ||
+		products[0].DisplayPrice.Amount != 200 || products[0].DisplayPrice.Currency != "USD" {
+		t.Errorf("products = %+v, want %d at $2.00", products, product.ID)
+	}
+}
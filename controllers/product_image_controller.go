@@ -0,0 +1,262 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Pijuyy/testing_project4/config"
+	"github.com/Pijuyy/testing_project4/models"
+	"github.com/Pijuyy/testing_project4/service"
+	"github.com/Pijuyy/testing_project4/storage"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// UploadProductImage - Upload an image of a product as the multipart field "image" (requires catalog:write)
+func UploadProductImage(db *gorm.DB, store storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authorize(w, r, db, models.PermCatalogWrite)
+		if !ok {
+			return
+		}
+
+		product, ok := findProductFromPath(w, r, db)
+		if !ok {
+			return
+		}
+
+		// Leave some room for the multipart headers around the file
+		r.Body = http.MaxBytesReader(w, r.Body, service.MaxImageSize+64<<10)
+		if err := r.ParseMultipartForm(service.MaxImageSize); err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				http.Error(w, "image must not be larger than 5MB", http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer r.MultipartForm.RemoveAll()
+
+		file, header, err := r.FormFile("image")
+		if err != nil {
+			http.Error(w, "image file is required", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		if header.Size > service.MaxImageSize {
+			http.Error(w, "image must not be larger than 5MB", http.StatusRequestEntityTooLarge)
+			return
+		}
+		data, err := io.ReadAll(file)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		image, err := service.SaveProductImage(db, store, product.ID, data, func(tx *gorm.DB, image *models.ProductImage) error {
+			return service.RecordAudit(tx, r, user, "product_image.create", "product_image", image.ID, nil, image)
+		})
+		if errors.Is(err, service.ErrUnsupportedImage) {
+			http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		config.SendJSONResponse(w, productImageResponse(*image, store))
+	}
+}
+
+// GetProductImages - List the images of a product in order (requires catalog:read)
+func GetProductImages(db *gorm.DB, store storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := authorize(w, r, db, models.PermCatalogRead); !ok {
+			return
+		}
+
+		product, ok := findProductFromPath(w, r, db)
+		if !ok {
+			return
+		}
+
+		var images []models.ProductImage
+		if err := orderImages(db.Where("product_id = ?", product.ID)).Find(&images).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		config.SendJSONResponse(w, productImageResponses(images, store))
+	}
+}
+
+// ReorderProductImages - Set the order of a product's images (requires catalog:write)
+func ReorderProductImages(db *gorm.DB, store storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authorize(w, r, db, models.PermCatalogWrite)
+		if !ok {
+			return
+		}
+
+		product, ok := findProductFromPath(w, r, db)
+		if !ok {
+			return
+		}
+
+		var requestBody struct {
+			ImageIDs []uint `json:"image_ids"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var images []models.ProductImage
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := service.ReorderProductImages(tx, product.ID, requestBody.ImageIDs); err != nil {
+				return err
+			}
+			if err := orderImages(tx.Where("product_id = ?", product.ID)).Find(&images).Error; err != nil {
+				return err
+			}
+			return service.RecordAudit(tx, r, user, "product_image.reorder", "product", product.ID, nil, requestBody)
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		config.SendJSONResponse(w, productImageResponses(images, store))
+	}
+}
+
+// SetPrimaryProductImage - Make an image the product's primary image (requires catalog:write)
+func SetPrimaryProductImage(db *gorm.DB, store storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authorize(w, r, db, models.PermCatalogWrite)
+		if !ok {
+			return
+		}
+
+		image, ok := findProductImageFromPath(w, r, db)
+		if !ok {
+			return
+		}
+
+		before := *image
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := service.SetPrimaryImage(tx, image); err != nil {
+				return err
+			}
+			return service.RecordAudit(tx, r, user, "product_image.set_primary", "product_image", image.ID, before, image)
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		config.SendJSONResponse(w, productImageResponse(*image, store))
+	}
+}
+
+// DeleteProductImage - Delete an image of a product (requires catalog:write)
+func DeleteProductImage(db *gorm.DB, store storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authorize(w, r, db, models.PermCatalogWrite)
+		if !ok {
+			return
+		}
+
+		image, ok := findProductImageFromPath(w, r, db)
+		if !ok {
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := service.DeleteProductImage(tx, image); err != nil {
+				return err
+			}
+			return service.RecordAudit(tx, r, user, "product_image.delete", "product_image", image.ID, image, nil)
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// The files are only removed once the image is gone from the database
+		service.DeleteImageFiles(store, *image)
+
+		config.SendJSONResponse(w, map[string]interface{}{
+			"message": "Image has been successfully deleted",
+		})
+	}
+}
+
+func findProductImageFromPath(w http.ResponseWriter, r *http.Request, db *gorm.DB) (*models.ProductImage, bool) {
+	vars := mux.Vars(r)
+	productID, err := strconv.Atoi(vars["productId"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return nil, false
+	}
+	imageID, err := strconv.Atoi(vars["imageId"])
+	if err != nil {
+		http.Error(w, "Invalid image ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	var image models.ProductImage
+	if err := db.Where("id = ? AND product_id = ?", imageID, productID).First(&image).Error; err != nil {
+		http.Error(w, "Image not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return &image, true
+}
+
+// orderImages sorts images by their position.
+func orderImages(db *gorm.DB) *gorm.DB {
+	return db.Order("position, id")
+}
+
+func productImageResponse(image models.ProductImage, store storage.Storage) map[string]interface{} {
+	return map[string]interface{}{
+		"id":            image.ID,
+		"product_id":    image.ProductID,
+		"url":           store.URL(image.Key),
+		"thumbnail_url": store.URL(image.ThumbnailKey),
+		"content_type":  image.ContentType,
+		"size":          image.Size,
+		"width":         image.Width,
+		"height":        image.Height,
+		"position":      image.Position,
+		"is_primary":    image.IsPrimary,
+		"created_at":    image.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+func productImageResponses(images []models.ProductImage, store storage.Storage) []map[string]interface{} {
+	response := make([]map[string]interface{}, 0, len(images))
+	for _, image := range images {
+		response = append(response, productImageResponse(image, store))
+	}
+	return response
+}
+
+// primaryImageURL returns the URL of the primary image, or nil when the
+// product has no images.
+func primaryImageURL(images []models.ProductImage, store storage.Storage) interface{} {
+	for _, image := range images {
+		if image.IsPrimary {
+			return store.URL(image.Key)
+		}
+	}
+	return nil
+}
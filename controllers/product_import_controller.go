@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/Pijuyy/testing_project4/config"
+	"github.com/Pijuyy/testing_project4/models"
+	"github.com/Pijuyy/testing_project4/service"
+	"gorm.io/gorm"
+)
+
+// maxImportSize limits the size of an uploaded CSV file.
+const maxImportSize = 10 << 20
+
+// ImportProducts - Create or update products from a CSV file (requires catalog:write).
+// The CSV is sent as the request body or as the "file" field of a multipart form.
+// Query parameters: dry_run=true validates without saving, mode=atomic|best_effort.
+func ImportProducts(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authorize(w, r, db, models.PermCatalogWrite)
+		if !ok {
+			return
+		}
+
+		canAdjustStock, err := config.HasPermission(db, user, models.PermInventoryAdjust)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+		var file io.Reader = r.Body
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+			part, _, err := r.FormFile("file")
+			if err != nil {
+				http.Error(w, "file is required", http.StatusBadRequest)
+				return
+			}
+			defer part.Close()
+			file = part
+		}
+
+		result, err := service.ImportProducts(db, file, service.ImportOptions{
+			Mode:           r.URL.Query().Get("mode"),
+			DryRun:         r.URL.Query().Get("dry_run") == "true",
+			Actor:          user,
+			Request:        r,
+			CanAdjustStock: canAdjustStock,
+		})
+		if errors.Is(err, service.ErrInvalidCSV) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// An atomic import with invalid rows saved nothing
+		if !result.Committed && !result.DryRun {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+		}
+		config.SendJSONResponse(w, result)
+	}
+}
+
+// ExportProducts - Download the whole catalogue as CSV (requires catalog:read)
+func ExportProducts(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := authorize(w, r, db, models.PermCatalogRead); !ok {
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="products.csv"`)
+		if err := service.ExportProducts(db, w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
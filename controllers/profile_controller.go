@@ -0,0 +1,379 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Pijuyy/testing_project4/config"
+	"github.com/Pijuyy/testing_project4/models"
+	"github.com/Pijuyy/testing_project4/service"
+	"github.com/asaskevich/govalidator"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// emailVerificationTTL is how long an email change link stays valid.
+const emailVerificationTTL = 24 * time.Hour
+
+var errEmailInUse = errors.New("Email is already in use")
+
+// GetProfile - Get the profile of the authenticated user
+func GetProfile(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := config.ExtractUserFromToken(r, db)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		config.SendJSONResponse(w, profileResponse(*user))
+	}
+}
+
+// UpdateProfile - Update the full name of the authenticated user
+func UpdateProfile(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := requireInteractiveUser(w, r, db)
+		if !ok {
+			return
+		}
+
+		var requestBody struct {
+			FullName string `json:"full_name"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&requestBody)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		requestBody.FullName = strings.TrimSpace(requestBody.FullName)
+		if requestBody.FullName == "" {
+			http.Error(w, "full name is required", http.StatusBadRequest)
+			return
+		}
+
+		before := *user
+		user.FullName = requestBody.FullName
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(user).Update("full_name", user.FullName).Error; err != nil {
+				return err
+			}
+			return service.RecordAudit(tx, r, user, "user.update_profile", "user", user.ID, before, user)
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		config.SendJSONResponse(w, profileResponse(*user))
+	}
+}
+
+// ChangePassword - Change the password of the authenticated user
+func ChangePassword(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := requireInteractiveUser(w, r, db)
+		if !ok {
+			return
+		}
+
+		var requestBody struct {
+			CurrentPassword string `json:"current_password"`
+			NewPassword     string `json:"new_password"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&requestBody)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(requestBody.CurrentPassword)); err != nil {
+			http.Error(w, "Invalid password", http.StatusUnauthorized)
+			return
+		}
+
+		if len(requestBody.NewPassword) < 6 {
+			http.Error(w, "password must be at least 6 characters long", http.StatusBadRequest)
+			return
+		}
+
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(requestBody.NewPassword), bcrypt.DefaultCost)
+		if err != nil {
+			http.Error(w, "Error while hashing password", http.StatusInternalServerError)
+			return
+		}
+
+		before := *user
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(user).Update("password", string(hashedPassword)).Error; err != nil {
+				return err
+			}
+			return service.RecordAudit(tx, r, user, "user.change_password", "user", user.ID, before, user)
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		config.SendJSONResponse(w, map[string]interface{}{
+			"message": "Your password has been successfully changed",
+		})
+	}
+}
+
+// RequestEmailChange - Start an email change; the new address has to be verified
+func RequestEmailChange(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := requireInteractiveUser(w, r, db)
+		if !ok {
+			return
+		}
+
+		var requestBody struct {
+			Email    string `json:"email"`
+			Password string `json:"password"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&requestBody)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(requestBody.Password)); err != nil {
+			http.Error(w, "Invalid password", http.StatusUnauthorized)
+			return
+		}
+
+		newEmail := strings.TrimSpace(requestBody.Email)
+		if !govalidator.IsEmail(newEmail) {
+			http.Error(w, "invalid email", http.StatusBadRequest)
+			return
+		}
+		if strings.EqualFold(newEmail, user.Email) {
+			http.Error(w, "The new email is the same as the current one", http.StatusBadRequest)
+			return
+		}
+
+		var count int64
+		db.Model(&models.User{}).Where("email = ?", newEmail).Count(&count)
+		if count > 0 {
+			http.Error(w, "Email is already in use", http.StatusConflict)
+			return
+		}
+
+		token, err := generateToken()
+		if err != nil {
+			http.Error(w, "Error while generating verification token", http.StatusInternalServerError)
+			return
+		}
+
+		before := *user
+		expiresAt := time.Now().Add(emailVerificationTTL)
+		user.PendingEmail = newEmail
+		user.EmailVerificationExpiresAt = &expiresAt
+		err = db.Transaction(func(tx *gorm.DB) error {
+			err := tx.Model(user).Updates(map[string]interface{}{
+				"pending_email":                 newEmail,
+				"email_verification_hash":       config.HashToken(token),
+				"email_verification_expires_at": expiresAt,
+			}).Error
+			if err != nil {
+				return err
+			}
+			return service.RecordAudit(tx, r, user, "user.request_email_change", "user", user.ID, before, user)
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		body := fmt.Sprintf("Use this token to confirm your new email address: %s\nIt expires at %s.", token, expiresAt.Format(time.RFC3339))
+		if err := service.DefaultMailer.Send(newEmail, "Confirm your new email address", body); err != nil {
+			http.Error(w, "Error while sending verification email", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		config.SendJSONResponse(w, map[string]interface{}{
+			"message":       "A verification token has been sent to " + newEmail,
+			"pending_email": newEmail,
+			"expires_at":    expiresAt.Format(time.RFC3339),
+		})
+	}
+}
+
+// VerifyEmailChange - Confirm a pending email change with the emailed token
+func VerifyEmailChange(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := requireInteractiveUser(w, r, db)
+		if !ok {
+			return
+		}
+
+		var requestBody struct {
+			Token string `json:"token"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&requestBody)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if user.PendingEmail == "" || user.EmailVerificationExpiresAt == nil {
+			http.Error(w, "There is no pending email change", http.StatusBadRequest)
+			return
+		}
+		if time.Now().After(*user.EmailVerificationExpiresAt) {
+			http.Error(w, "Verification token has expired", http.StatusBadRequest)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(config.HashToken(requestBody.Token)), []byte(user.EmailVerificationHash)) != 1 {
+			http.Error(w, "Invalid verification token", http.StatusBadRequest)
+			return
+		}
+
+		// The unique index on email guards against the address being taken in the meantime
+		before := *user
+		user.Email = user.PendingEmail
+		user.PendingEmail = ""
+		user.EmailVerificationExpiresAt = nil
+		err = db.Transaction(func(tx *gorm.DB) error {
+			err := tx.Model(user).Updates(map[string]interface{}{
+				"email":                         user.Email,
+				"pending_email":                 "",
+				"email_verification_hash":       "",
+				"email_verification_expires_at": nil,
+			}).Error
+			if service.IsUniqueViolation(err) {
+				return errEmailInUse
+			} else if err != nil {
+				return err
+			}
+			return service.RecordAudit(tx, r, user, "user.change_email", "user", user.ID, before, user)
+		})
+		if errors.Is(err, errEmailInUse) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		config.SendJSONResponse(w, profileResponse(*user))
+	}
+}
+
+// DeleteAccount - Delete the authenticated user's account.
+// Personal data is anonymized while transaction history is kept for accounting.
+func DeleteAccount(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := requireInteractiveUser(w, r, db)
+		if !ok {
+			return
+		}
+
+		var requestBody struct {
+			Password string `json:"password"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&requestBody)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(requestBody.Password)); err != nil {
+			http.Error(w, "Invalid password", http.StatusUnauthorized)
+			return
+		}
+
+		// Replace the password with a hash of a random secret nobody knows
+		secret, err := generateToken()
+		if err != nil {
+			http.Error(w, "Error while generating password", http.StatusInternalServerError)
+			return
+		}
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+		if err != nil {
+			http.Error(w, "Error while hashing password", http.StatusInternalServerError)
+			return
+		}
+
+		before := *user
+		user.FullName = "Deleted User"
+		user.Email = fmt.Sprintf("deleted-user-%d@deleted.invalid", user.ID)
+		user.Status = models.UserStatusDeleted
+		user.PendingEmail = ""
+		user.EmailVerificationExpiresAt = nil
+		err = db.Transaction(func(tx *gorm.DB) error {
+			err := tx.Model(user).Updates(map[string]interface{}{
+				"full_name":                     user.FullName,
+				"email":                         user.Email,
+				"password":                      string(hashedPassword),
+				"status":                        user.Status,
+				"pending_email":                 "",
+				"email_verification_hash":       "",
+				"email_verification_expires_at": nil,
+			}).Error
+			if err != nil {
+				return err
+			}
+
+			// Revoke API keys so integrations stop working along with the account
+			err = tx.Model(&models.APIKey{}).Where("user_id = ? AND revoked_at IS NULL", user.ID).Update("revoked_at", time.Now()).Error
+			if err != nil {
+				return err
+			}
+
+			// A deleted account no longer wants back-in-stock notifications
+			if err := tx.Where("user_id = ?", user.ID).Delete(&models.WishlistItem{}).Error; err != nil {
+				return err
+			}
+
+			// Saved addresses are personal data; past orders keep the address they shipped to
+			if err := tx.Where("user_id = ?", user.ID).Delete(&models.Address{}).Error; err != nil {
+				return err
+			}
+
+			// Earlier entries about the account hold its name and email addresses
+			if err := service.ScrubUserAudit(tx, user.ID); err != nil {
+				return err
+			}
+
+			// Only the status is recorded so the entry does not keep the erased personal data
+			beforeStatus := map[string]interface{}{"Status": before.Status}
+			afterStatus := map[string]interface{}{"Status": user.Status}
+			return service.RecordAudit(tx, r, user, "user.delete_account", "user", user.ID, beforeStatus, afterStatus)
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		config.SendJSONResponse(w, map[string]interface{}{
+			"message": "Your account has been successfully deleted",
+		})
+	}
+}
+
+func profileResponse(user models.User) map[string]interface{} {
+	response := map[string]interface{}{
+		"id":            user.ID,
+		"full_name":     user.FullName,
+		"email":         user.Email,
+		"role":          user.Role,
+		"balance":       user.Balance,
+		"pending_email": nil,
+		"created_at":    user.CreatedAt.Format(time.RFC3339),
+		"updated_at":    user.UpdatedAt.Format(time.RFC3339),
+	}
+	if user.PendingEmail != "" {
+		response["pending_email"] = user.PendingEmail
+	}
+	return response
+}
@@ -0,0 +1,386 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Pijuyy/testing_project4/config"
+	"github.com/Pijuyy/testing_project4/models"
+	"github.com/Pijuyy/testing_project4/service"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// CreatePromotion - Create a promo code (requires promotions:manage)
+func CreatePromotion(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authorize(w, r, db, models.PermPromotionsManage)
+		if !ok {
+			return
+		}
+
+		var requestBody struct {
+			Code         string       `json:"code"`
+			Description  string       `json:"description"`
+			Type         string       `json:"type"`
+			Value        int          `json:"value"`
+			MinSpend     models.Money `json:"min_spend"`
+			CategoryID   *uint        `json:"category_id"`
+			ProductID    *uint        `json:"product_id"`
+			StartsAt     *time.Time   `json:"starts_at"`
+			EndsAt       *time.Time   `json:"ends_at"`
+			UsageLimit   *int         `json:"usage_limit"`
+			PerUserLimit *int         `json:"per_user_limit"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&requestBody)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		promotion := models.Promotion{
+			Code:         service.NormalizePromoCode(requestBody.Code),
+			Description:  strings.TrimSpace(requestBody.Description),
+			Type:         requestBody.Type,
+			Value:        requestBody.Value,
+			MinSpend:     requestBody.MinSpend,
+			CategoryID:   requestBody.CategoryID,
+			ProductID:    requestBody.ProductID,
+			StartsAt:     requestBody.StartsAt,
+			EndsAt:       requestBody.EndsAt,
+			UsageLimit:   requestBody.UsageLimit,
+			PerUserLimit: requestBody.PerUserLimit,
+			Active:       true,
+		}
+		if err := promotion.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !checkPromotionTargets(w, db, &promotion) {
+			return
+		}
+
+		var count int64
+		db.Model(&models.Promotion{}).Where("code = ?", promotion.Code).Count(&count)
+		if count > 0 {
+			http.Error(w, "Promo code already exists", http.StatusConflict)
+			return
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&promotion).Error; err != nil {
+				return err
+			}
+			return service.RecordAudit(tx, r, user, "promotion.create", "promotion", promotion.ID, nil, promotion)
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("ETag", etag(promotion.Version))
+		w.WriteHeader(http.StatusCreated)
+		config.SendJSONResponse(w, promotionResponse(promotion))
+	}
+}
+
+// GetPromotions - List promo codes, newest first (requires promotions:manage).
+// Pass active=true or active=false to filter.
+func GetPromotions(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := authorize(w, r, db, models.PermPromotionsManage); !ok {
+			return
+		}
+
+		page, limit := parsePagination(r)
+		query := db.Model(&models.Promotion{})
+		if active := r.URL.Query().Get("active"); active != "" {
+			value, err := strconv.ParseBool(active)
+			if err != nil {
+				http.Error(w, "active must be true or false", http.StatusBadRequest)
+				return
+			}
+			query = query.Where("active = ?", value)
+		}
+
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var promotions []models.Promotion
+		if err := query.Order("id DESC").Offset((page - 1) * limit).Limit(limit).Find(&promotions).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responsePromotions := make([]map[string]interface{}, 0, len(promotions))
+		for _, promotion := range promotions {
+			responsePromotions = append(responsePromotions, promotionResponse(promotion))
+		}
+
+		config.SendJSONResponse(w, map[string]interface{}{
+			"promotions": responsePromotions,
+			"page":       page,
+			"limit":      limit,
+			"total":      total,
+		})
+	}
+}
+
+// GetPromotion - Get a promo code with its redemption totals (requires promotions:manage)
+func GetPromotion(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := authorize(w, r, db, models.PermPromotionsManage); !ok {
+			return
+		}
+
+		promotion, ok := findPromotionFromPath(w, r, db)
+		if !ok {
+			return
+		}
+
+		var totals struct {
+			Redemptions   int
+			TotalDiscount models.Money
+			Customers     int
+		}
+		err := db.Model(&models.PromotionRedemption{}).
+			Select("COUNT(*) AS redemptions, COALESCE(SUM(discount), 0) AS total_discount, COUNT(DISTINCT user_id) AS customers").
+			Where("promotion_id = ?", promotion.ID).
+			Scan(&totals).Error
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		response := promotionResponse(*promotion)
+		response["redemptions"] = totals.Redemptions
+		response["total_discount"] = totals.TotalDiscount
+		response["customers"] = totals.Customers
+
+		w.Header().Set("ETag", etag(promotion.Version))
+		config.SendJSONResponse(w, response)
+	}
+}
+
+// PatchPromotion - Partially update a promo code using JSON Merge Patch (requires
+// promotions:manage). The code itself cannot be changed.
+func PatchPromotion(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authorize(w, r, db, models.PermPromotionsManage)
+		if !ok {
+			return
+		}
+
+		patch, err := decodeMergePatch(r)
+		if errors.Is(err, errUnsupportedPatch) {
+			http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		promotion, ok := findPromotionFromPath(w, r, db)
+		if !ok {
+			return
+		}
+
+		if !ifMatch(r, promotion.Version) {
+			http.Error(w, service.ErrVersionConflict.Error(), http.StatusPreconditionFailed)
+			return
+		}
+
+		// Only the members present in the patch are applied; null removes an
+		// optional restriction
+		before := *promotion
+		for field, value := range patch {
+			null := string(value) == "null"
+			switch field {
+			case "description":
+				err = decodePatchField(field, value, &promotion.Description)
+			case "type":
+				err = decodePatchField(field, value, &promotion.Type)
+			case "value":
+				err = decodePatchField(field, value, &promotion.Value)
+			case "min_spend":
+				err = decodePatchField(field, value, &promotion.MinSpend)
+			case "active":
+				err = decodePatchField(field, value, &promotion.Active)
+			case "category_id":
+				promotion.CategoryID = nil
+				if !null {
+					err = decodePatchField(field, value, &promotion.CategoryID)
+				}
+			case "product_id":
+				promotion.ProductID = nil
+				if !null {
+					err = decodePatchField(field, value, &promotion.ProductID)
+				}
+			case "starts_at":
+				promotion.StartsAt = nil
+				if !null {
+					err = decodePatchField(field, value, &promotion.StartsAt)
+				}
+			case "ends_at":
+				promotion.EndsAt = nil
+				if !null {
+					err = decodePatchField(field, value, &promotion.EndsAt)
+				}
+			case "usage_limit":
+				promotion.UsageLimit = nil
+				if !null {
+					err = decodePatchField(field, value, &promotion.UsageLimit)
+				}
+			case "per_user_limit":
+				promotion.PerUserLimit = nil
+				if !null {
+					err = decodePatchField(field, value, &promotion.PerUserLimit)
+				}
+			default:
+				err = fmt.Errorf("unknown field %s", field)
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		if err := promotion.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !checkPromotionTargets(w, db, promotion) {
+			return
+		}
+
+		promotion.UpdatedAt = time.Now()
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := service.UpdatePromotion(tx, promotion); err != nil {
+				return err
+			}
+			return service.RecordAudit(tx, r, user, "promotion.update", "promotion", promotion.ID, before, promotion)
+		})
+		if errors.Is(err, service.ErrVersionConflict) {
+			http.Error(w, err.Error(), http.StatusPreconditionFailed)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("ETag", etag(promotion.Version))
+		config.SendJSONResponse(w, promotionResponse(*promotion))
+	}
+}
+
+// DeletePromotion - Delete a promo code that has never been used (requires
+// promotions:manage). Used codes can be deactivated instead.
+func DeletePromotion(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authorize(w, r, db, models.PermPromotionsManage)
+		if !ok {
+			return
+		}
+
+		promotion, ok := findPromotionFromPath(w, r, db)
+		if !ok {
+			return
+		}
+
+		if !ifMatch(r, promotion.Version) {
+			http.Error(w, service.ErrVersionConflict.Error(), http.StatusPreconditionFailed)
+			return
+		}
+
+		if promotion.UsedCount > 0 {
+			http.Error(w, "Promo code has been used, deactivate it instead", http.StatusConflict)
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			result := tx.Where("version = ? AND used_count = 0", promotion.Version).Delete(promotion)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return service.ErrVersionConflict
+			}
+			return service.RecordAudit(tx, r, user, "promotion.delete", "promotion", promotion.ID, promotion, nil)
+		})
+		if errors.Is(err, service.ErrVersionConflict) {
+			http.Error(w, err.Error(), http.StatusPreconditionFailed)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		config.SendJSONResponse(w, map[string]interface{}{
+			"message": "Promo code has been successfully deleted",
+		})
+	}
+}
+
+// checkPromotionTargets makes sure the category and product a promotion is
+// restricted to exist, writing a 404 response when they don't.
+func checkPromotionTargets(w http.ResponseWriter, db *gorm.DB, promotion *models.Promotion) bool {
+	if promotion.CategoryID != nil {
+		if err := db.First(&models.Category{}, *promotion.CategoryID).Error; err != nil {
+			http.Error(w, "Category not found", http.StatusNotFound)
+			return false
+		}
+	}
+	if promotion.ProductID != nil {
+		if err := db.First(&models.Product{}, *promotion.ProductID).Error; err != nil {
+			http.Error(w, "Product not found", http.StatusNotFound)
+			return false
+		}
+	}
+	return true
+}
+
+func findPromotionFromPath(w http.ResponseWriter, r *http.Request, db *gorm.DB) (*models.Promotion, bool) {
+	promotionID, err := strconv.Atoi(mux.Vars(r)["promotionId"])
+	if err != nil {
+		http.Error(w, "Invalid promotion ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	var promotion models.Promotion
+	if err := db.First(&promotion, promotionID).Error; err != nil {
+		http.Error(w, "Promotion not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return &promotion, true
+}
+
+func promotionResponse(promotion models.Promotion) map[string]interface{} {
+	return map[string]interface{}{
+		"id":             promotion.ID,
+		"code":           promotion.Code,
+		"description":    promotion.Description,
+		"type":           promotion.Type,
+		"value":          promotion.Value,
+		"min_spend":      promotion.MinSpend,
+		"category_id":    promotion.CategoryID,
+		"product_id":     promotion.ProductID,
+		"starts_at":      formatOptionalTime(promotion.StartsAt),
+		"ends_at":        formatOptionalTime(promotion.EndsAt),
+		"usage_limit":    promotion.UsageLimit,
+		"per_user_limit": promotion.PerUserLimit,
+		"used_count":     promotion.UsedCount,
+		"active":         promotion.Active,
+		"version":        promotion.Version,
+		"created_at":     promotion.CreatedAt.Format(time.RFC3339),
+		"updated_at":     promotion.UpdatedAt.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Pijuyy/testing_project4/config"
+	"github.com/Pijuyy/testing_project4/models"
+	"github.com/Pijuyy/testing_project4/service"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// CreateReservation - Hold stock of a product while the user checks out
+func CreateReservation(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := requireScopedUser(w, r, db, models.ScopeOrdersCreate)
+		if !ok {
+			return
+		}
+
+		var requestBody struct {
+			ProductID uint  `json:"product_id"`
+			VariantID *uint `json:"variant_id"`
+			Quantity  int   `json:"quantity"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&requestBody)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var product models.Product
+		if err := db.First(&product, requestBody.ProductID).Error; err != nil {
+			http.Error(w, "Product not found", http.StatusNotFound)
+			return
+		}
+
+		if _, ok := findPurchasableVariant(w, db, product, requestBody.VariantID); !ok {
+			return
+		}
+
+		var reservation *models.Reservation
+		err = db.Transaction(func(tx *gorm.DB) error {
+			reservation, err = service.ReserveStock(tx, user.ID, product.ID, requestBody.VariantID, requestBody.Quantity)
+			if err != nil {
+				return err
+			}
+			return service.RecordAudit(tx, r, user, "reservation.create", "reservation", reservation.ID, nil, reservation)
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		config.SendJSONResponse(w, reservationResponse(*reservation))
+	}
+}
+
+// GetMyReservations - List the authenticated user's reservations, newest first.
+// Pass status to filter, e.g. status=active.
+func GetMyReservations(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := config.ExtractUserFromToken(r, db)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		query := db.Where("user_id = ?", user.ID)
+		if status := r.URL.Query().Get("status"); status != "" {
+			query = query.Where("status = ?", status)
+		}
+
+		var reservations []models.Reservation
+		if err := query.Order("id DESC").Find(&reservations).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		response := make([]map[string]interface{}, 0, len(reservations))
+		for _, reservation := range reservations {
+			response = append(response, reservationResponse(reservation))
+		}
+
+		config.SendJSONResponse(w, response)
+	}
+}
+
+// ReleaseReservation - Give up one of the authenticated user's reservations
+func ReleaseReservation(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := requireScopedUser(w, r, db, models.ScopeOrdersCreate)
+		if !ok {
+			return
+		}
+
+		reservationID, err := strconv.Atoi(mux.Vars(r)["reservationId"])
+		if err != nil {
+			http.Error(w, "Invalid reservation ID", http.StatusBadRequest)
+			return
+		}
+
+		var reservation models.Reservation
+		if err := db.Where("id = ? AND user_id = ?", reservationID, user.ID).First(&reservation).Error; err != nil {
+			http.Error(w, "Reservation not found", http.StatusNotFound)
+			return
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			before := reservation
+			if err := service.ReleaseReservation(tx, &reservation, models.ReservationReleased, nil); err != nil {
+				return err
+			}
+			return service.RecordAudit(tx, r, user, "reservation.release", "reservation", reservation.ID, before, reservation)
+		})
+		if errors.Is(err, service.ErrReservationUnavailable) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		config.SendJSONResponse(w, map[string]interface{}{
+			"message": "Reservation has been successfully released",
+		})
+	}
+}
+
+func reservationResponse(reservation models.Reservation) map[string]interface{} {
+	return map[string]interface{}{
+		"id":             reservation.ID,
+		"product_id":     reservation.ProductID,
+		"variant_id":     reservation.VariantID,
+		"quantity":       reservation.Quantity,
+		"status":         reservation.Status,
+		"expires_at":     reservation.ExpiresAt.Format(time.RFC3339),
+		"transaction_id": reservation.TransactionID,
+		"created_at":     reservation.CreatedAt.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,396 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Pijuyy/testing_project4/config"
+	"github.com/Pijuyy/testing_project4/models"
+	"github.com/Pijuyy/testing_project4/service"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// reviewSorts maps the accepted review sort orders to their SQL.
+var reviewSorts = map[string]string{
+	"newest":      "created_at DESC, id DESC",
+	"oldest":      "created_at, id",
+	"rating_desc": "rating DESC, created_at DESC, id DESC",
+	"rating_asc":  "rating, created_at DESC, id DESC",
+}
+
+// CreateReview - Rate and review a product the authenticated user has bought
+func CreateReview(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := requireInteractiveUser(w, r, db)
+		if !ok {
+			return
+		}
+
+		product, ok := findProductFromPath(w, r, db)
+		if !ok {
+			return
+		}
+
+		var requestBody struct {
+			Rating int    `json:"rating"`
+			Title  string `json:"title"`
+			Body   string `json:"body"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		review := models.Review{
+			ProductID: product.ID,
+			UserID:    user.ID,
+			Rating:    requestBody.Rating,
+			Title:     strings.TrimSpace(requestBody.Title),
+			Body:      strings.TrimSpace(requestBody.Body),
+		}
+		if err := review.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := service.CreateReview(tx, &review); err != nil {
+				return err
+			}
+			return service.RecordAudit(tx, r, user, "review.create", "review", review.ID, nil, review)
+		})
+		if errors.Is(err, service.ErrNotVerifiedBuyer) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		} else if errors.Is(err, service.ErrAlreadyReviewed) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("ETag", etag(review.Version))
+		w.WriteHeader(http.StatusCreated)
+		config.SendJSONResponse(w, reviewResponse(review, true))
+	}
+}
+
+// GetProductReviews - List the visible reviews of a product with its rating. Pass sort
+// (newest, oldest, rating_desc or rating_asc) to order them; moderators can pass
+// include_hidden=true to see hidden reviews too.
+func GetProductReviews(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := config.ExtractUserFromToken(r, db)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		product, ok := findProductFromPath(w, r, db)
+		if !ok {
+			return
+		}
+
+		params := r.URL.Query()
+		sort := params.Get("sort")
+		if sort == "" {
+			sort = "newest"
+		}
+		order, ok := reviewSorts[sort]
+		if !ok {
+			http.Error(w, "sort must be newest, oldest, rating_desc or rating_asc", http.StatusBadRequest)
+			return
+		}
+
+		moderator, err := config.HasPermission(db, user, models.PermReviewsModerate)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		query := db.Model(&models.Review{}).Where("product_id = ?", product.ID)
+		if params.Get("include_hidden") == "true" {
+			if !moderator {
+				http.Error(w, config.ErrForbidden.Error(), http.StatusForbidden)
+				return
+			}
+		} else {
+			query = query.Where("hidden = ?", false)
+		}
+		if rating := params.Get("rating"); rating != "" {
+			value, err := strconv.Atoi(rating)
+			if err != nil {
+				http.Error(w, "rating must be a whole number", http.StatusBadRequest)
+				return
+			}
+			query = query.Where("rating = ?", value)
+		}
+
+		page, limit := parsePagination(r)
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var reviews []models.Review
+		if err := query.Order(order).Offset((page - 1) * limit).Limit(limit).Find(&reviews).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responseReviews := make([]map[string]interface{}, 0, len(reviews))
+		for _, review := range reviews {
+			responseReviews = append(responseReviews, reviewResponse(review, moderator))
+		}
+
+		config.SendJSONResponse(w, map[string]interface{}{
+			"reviews":        responseReviews,
+			"rating_average": product.RatingAverage,
+			"rating_count":   product.RatingCount,
+			"page":           page,
+			"limit":          limit,
+			"total":          total,
+		})
+	}
+}
+
+// PatchReview - Edit the authenticated user's review using JSON Merge Patch
+func PatchReview(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := requireInteractiveUser(w, r, db)
+		if !ok {
+			return
+		}
+
+		patch, err := decodeMergePatch(r)
+		if errors.Is(err, errUnsupportedPatch) {
+			http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		review, ok := findReviewFromPath(w, r, db)
+		if !ok {
+			return
+		}
+		if review.UserID != user.ID {
+			http.Error(w, "You can only edit your own review", http.StatusForbidden)
+			return
+		}
+
+		if !ifMatch(r, review.Version) {
+			http.Error(w, service.ErrVersionConflict.Error(), http.StatusPreconditionFailed)
+			return
+		}
+
+		// Only the members present in the patch are applied
+		before := *review
+		for field, value := range patch {
+			switch field {
+			case "rating":
+				err = decodePatchField(field, value, &review.Rating)
+			case "title":
+				err = decodePatchField(field, value, &review.Title)
+				review.Title = strings.TrimSpace(review.Title)
+			case "body":
+				err = decodePatchField(field, value, &review.Body)
+				review.Body = strings.TrimSpace(review.Body)
+			default:
+				err = fmt.Errorf("unknown field %s", field)
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		if err := review.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		review.UpdatedAt = time.Now()
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := service.UpdateReview(tx, review); err != nil {
+				return err
+			}
+			return service.RecordAudit(tx, r, user, "review.update", "review", review.ID, before, review)
+		})
+		if errors.Is(err, service.ErrVersionConflict) {
+			http.Error(w, err.Error(), http.StatusPreconditionFailed)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("ETag", etag(review.Version))
+		config.SendJSONResponse(w, reviewResponse(*review, true))
+	}
+}
+
+// DeleteReview - Delete a review. Users can delete their own reviews, moderators any review.
+func DeleteReview(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := requireInteractiveUser(w, r, db)
+		if !ok {
+			return
+		}
+
+		review, ok := findReviewFromPath(w, r, db)
+		if !ok {
+			return
+		}
+		if review.UserID != user.ID {
+			moderator, err := config.HasPermission(db, user, models.PermReviewsModerate)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if !moderator {
+				http.Error(w, "You can only delete your own review", http.StatusForbidden)
+				return
+			}
+		}
+
+		if !ifMatch(r, review.Version) {
+			http.Error(w, service.ErrVersionConflict.Error(), http.StatusPreconditionFailed)
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := service.DeleteReview(tx, review); err != nil {
+				return err
+			}
+			return service.RecordAudit(tx, r, user, "review.delete", "review", review.ID, review, nil)
+		})
+		if errors.Is(err, service.ErrVersionConflict) {
+			http.Error(w, err.Error(), http.StatusPreconditionFailed)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		config.SendJSONResponse(w, map[string]interface{}{
+			"message": "Review has been successfully deleted",
+		})
+	}
+}
+
+// HideReview - Hide a review from listings and the product's rating (requires reviews:moderate)
+func HideReview(db *gorm.DB) http.HandlerFunc {
+	return moderateReview(db, true)
+}
+
+// UnhideReview - Show a hidden review again (requires reviews:moderate)
+func UnhideReview(db *gorm.DB) http.HandlerFunc {
+	return moderateReview(db, false)
+}
+
+func moderateReview(db *gorm.DB, hide bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authorize(w, r, db, models.PermReviewsModerate)
+		if !ok {
+			return
+		}
+
+		var requestBody struct {
+			Reason string `json:"reason"`
+		}
+		if hide {
+			if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			requestBody.Reason = strings.TrimSpace(requestBody.Reason)
+			if requestBody.Reason == "" {
+				http.Error(w, "reason is required", http.StatusBadRequest)
+				return
+			}
+		}
+
+		review, ok := findReviewFromPath(w, r, db)
+		if !ok {
+			return
+		}
+
+		action := "review.unhide"
+		if hide {
+			action = "review.hide"
+		}
+
+		before := *review
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := service.SetReviewHidden(tx, review, hide, requestBody.Reason, user.ID); err != nil {
+				return err
+			}
+			return service.RecordAudit(tx, r, user, action, "review", review.ID, before, review)
+		})
+		if errors.Is(err, service.ErrVersionConflict) {
+			http.Error(w, err.Error(), http.StatusPreconditionFailed)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("ETag", etag(review.Version))
+		config.SendJSONResponse(w, reviewResponse(*review, true))
+	}
+}
+
+func findReviewFromPath(w http.ResponseWriter, r *http.Request, db *gorm.DB) (*models.Review, bool) {
+	vars := mux.Vars(r)
+	productID, err := strconv.Atoi(vars["productId"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return nil, false
+	}
+	reviewID, err := strconv.Atoi(vars["reviewId"])
+	if err != nil {
+		http.Error(w, "Invalid review ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	var review models.Review
+	if err := db.Where("id = ? AND product_id = ?", reviewID, productID).First(&review).Error; err != nil {
+		http.Error(w, "Review not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return &review, true
+}
+
+// reviewResponse represents a review. The moderation details are only
+// included when withModeration is set.
+func reviewResponse(review models.Review, withModeration bool) map[string]interface{} {
+	response := map[string]interface{}{
+		"id":         review.ID,
+		"product_id": review.ProductID,
+		"user_id":    review.UserID,
+		"rating":     review.Rating,
+		"title":      review.Title,
+		"body":       review.Body,
+		"version":    review.Version,
+		"created_at": review.CreatedAt.Format(time.RFC3339),
+		"updated_at": review.UpdatedAt.Format(time.RFC3339),
+	}
+	if withModeration {
+		response["hidden"] = review.Hidden
+		response["hidden_reason"] = review.HiddenReason
+		response["hidden_by"] = review.HiddenBy
+		response["hidden_at"] = formatOptionalTime(review.HiddenAt)
+	}
+	return response
+}
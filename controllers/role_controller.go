@@ -0,0 +1,276 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Pijuyy/testing_project4/config"
+	"github.com/Pijuyy/testing_project4/models"
+	"github.com/Pijuyy/testing_project4/service"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// GetPermissions - List every permission that can be granted to a role
+func GetPermissions(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := authorize(w, r, db, models.PermRolesManage); !ok {
+			return
+		}
+
+		var permissions []models.Permission
+		if err := db.Order("name").Find(&permissions).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		response := make([]map[string]interface{}, 0, len(permissions))
+		for _, permission := range permissions {
+			response = append(response, map[string]interface{}{
+				"name":        permission.Name,
+				"description": permission.Description,
+			})
+		}
+
+		config.SendJSONResponse(w, response)
+	}
+}
+
+// GetRoles - List all roles with their permissions
+func GetRoles(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := authorize(w, r, db, models.PermRolesManage); !ok {
+			return
+		}
+
+		var roles []models.Role
+		if err := db.Preload("Permissions").Order("name").Find(&roles).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		response := make([]map[string]interface{}, 0, len(roles))
+		for _, role := range roles {
+			response = append(response, roleResponse(role))
+		}
+
+		config.SendJSONResponse(w, response)
+	}
+}
+
+// CreateRole - Create a new role with a set of permissions
+func CreateRole(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authorize(w, r, db, models.PermRolesManage)
+		if !ok {
+			return
+		}
+
+		var requestBody struct {
+			Name        string   `json:"name"`
+			Description string   `json:"description"`
+			Permissions []string `json:"permissions"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&requestBody)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		permissions, err := findPermissions(db, requestBody.Permissions)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		role := models.Role{
+			Name:        strings.TrimSpace(requestBody.Name),
+			Description: requestBody.Description,
+			Permissions: permissions,
+		}
+
+		var count int64
+		db.Model(&models.Role{}).Where("name = ?", role.Name).Count(&count)
+		if count > 0 {
+			http.Error(w, "Role already exists", http.StatusConflict)
+			return
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&role).Error; err != nil {
+				return err
+			}
+			return service.RecordAudit(tx, r, user, "role.create", "role", role.ID, nil, roleSnapshot(role))
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		config.SendJSONResponse(w, roleResponse(role))
+	}
+}
+
+// UpdateRole - Replace the description and permissions of a role
+func UpdateRole(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authorize(w, r, db, models.PermRolesManage)
+		if !ok {
+			return
+		}
+
+		roleID, err := strconv.Atoi(mux.Vars(r)["roleId"])
+		if err != nil {
+			http.Error(w, "Invalid role ID", http.StatusBadRequest)
+			return
+		}
+
+		var requestBody struct {
+			Description string   `json:"description"`
+			Permissions []string `json:"permissions"`
+		}
+		err = json.NewDecoder(r.Body).Decode(&requestBody)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var role models.Role
+		if err := db.Preload("Permissions").First(&role, roleID).Error; err != nil {
+			http.Error(w, "Role not found", http.StatusNotFound)
+			return
+		}
+
+		// The super admin must keep every permission so roles can always be managed
+		if role.Name == models.RoleSuperAdmin {
+			http.Error(w, "The super admin role cannot be changed", http.StatusBadRequest)
+			return
+		}
+
+		permissions, err := findPermissions(db, requestBody.Permissions)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		before := roleSnapshot(role)
+		role.Description = requestBody.Description
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&role).Update("description", role.Description).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&role).Association("Permissions").Replace(permissions); err != nil {
+				return err
+			}
+			role.Permissions = permissions
+			return service.RecordAudit(tx, r, user, "role.update", "role", role.ID, before, roleSnapshot(role))
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		config.SendJSONResponse(w, roleResponse(role))
+	}
+}
+
+// DeleteRole - Delete a role that is no longer assigned to any user
+func DeleteRole(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authorize(w, r, db, models.PermRolesManage)
+		if !ok {
+			return
+		}
+
+		roleID, err := strconv.Atoi(mux.Vars(r)["roleId"])
+		if err != nil {
+			http.Error(w, "Invalid role ID", http.StatusBadRequest)
+			return
+		}
+
+		var role models.Role
+		if err := db.Preload("Permissions").First(&role, roleID).Error; err != nil {
+			http.Error(w, "Role not found", http.StatusNotFound)
+			return
+		}
+
+		if role.Name == models.RoleSuperAdmin || role.Name == models.RoleCustomer {
+			http.Error(w, "Built-in role "+role.Name+" cannot be deleted", http.StatusBadRequest)
+			return
+		}
+
+		var count int64
+		db.Model(&models.User{}).Where("role = ?", role.Name).Count(&count)
+		if count > 0 {
+			http.Error(w, "Role is still assigned to users", http.StatusConflict)
+			return
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			before := roleSnapshot(role)
+			if err := tx.Model(&role).Association("Permissions").Clear(); err != nil {
+				return err
+			}
+			if err := tx.Delete(&role).Error; err != nil {
+				return err
+			}
+			return service.RecordAudit(tx, r, user, "role.delete", "role", role.ID, before, nil)
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		config.SendJSONResponse(w, map[string]interface{}{
+			"message": "Role has been successfully deleted",
+		})
+	}
+}
+
+// findPermissions looks up permissions by name, failing on unknown names.
+func findPermissions(db *gorm.DB, names []string) ([]models.Permission, error) {
+	permissions := []models.Permission{}
+	if len(names) == 0 {
+		return permissions, nil
+	}
+
+	if err := db.Where("name IN ?", names).Find(&permissions).Error; err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]bool, len(permissions))
+	for _, permission := range permissions {
+		found[permission.Name] = true
+	}
+	for _, name := range names {
+		if !found[name] {
+			return nil, errors.New("unknown permission: " + name)
+		}
+	}
+
+	return permissions, nil
+}
+
+// roleSnapshot describes a role for the audit log, including its permissions.
+func roleSnapshot(role models.Role) map[string]interface{} {
+	return map[string]interface{}{
+		"Name":        role.Name,
+		"Description": role.Description,
+		"Permissions": role.PermissionNames(),
+	}
+}
+
+func roleResponse(role models.Role) map[string]interface{} {
+	return map[string]interface{}{
+		"id":          role.ID,
+		"name":        role.Name,
+		"description": role.Description,
+		"permissions": role.PermissionNames(),
+		"created_at":  role.CreatedAt.Format(time.RFC3339),
+		"updated_at":  role.UpdatedAt.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,177 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Pijuyy/testing_project4/config"
+	"github.com/Pijuyy/testing_project4/models"
+	"github.com/Pijuyy/testing_project4/service"
+	"github.com/Pijuyy/testing_project4/storage"
+	"gorm.io/gorm"
+)
+
+// maxSuggestions limits the number of autocomplete suggestions.
+const maxSuggestions = 20
+
+// SearchProducts - Full-text search over product titles and descriptions, best matches
+// first (requires catalog:read). Accepts the catalogue filters.
+func SearchProducts(db *gorm.DB, store storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authorize(w, r, db, models.PermCatalogRead)
+		if !ok {
+			return
+		}
+
+		rate, ok := displayRate(w, r, db, user)
+		if !ok {
+			return
+		}
+
+		terms := strings.TrimSpace(r.URL.Query().Get("q"))
+		if terms == "" {
+			http.Error(w, "q is required", http.StatusBadRequest)
+			return
+		}
+
+		filters, err := parseCatalogueFilters(r, db)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		page, limit := parsePagination(r)
+		hits, total, err := service.SearchProducts(db, terms, filters, (page-1)*limit, limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		ids := make([]uint, 0, len(hits))
+		for _, hit := range hits {
+			ids = append(ids, hit.ProductID)
+		}
+		var products []models.Product
+		if err := db.Preload("Images", orderImages).Where("id IN ?", ids).Find(&products).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		productsByID := make(map[uint]models.Product, len(products))
+		for _, product := range products {
+			productsByID[product.ID] = product
+		}
+		sales, err := service.ActivePriceSchedules(db, ids)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Keep the order of the hits, which are sorted by relevance
+		results := make([]map[string]interface{}, 0, len(hits))
+		for _, hit := range hits {
+			product, ok := productsByID[hit.ProductID]
+			if !ok {
+				continue
+			}
+			result := productResponse(product)
+			result["primary_image_url"] = primaryImageURL(product.Images, store)
+			price := product.Price
+			if sale, ok := sales[product.ID]; ok {
+				price = sale.SalePrice
+			}
+			result["display_price"] = displayPrice(price, rate)
+			result["rank"] = hit.Rank
+			result["highlights"] = map[string]interface{}{
+				"title":       hit.TitleHighlight,
+				"description": hit.DescriptionHighlight,
+			}
+			results = append(results, result)
+		}
+
+		config.SendJSONResponse(w, map[string]interface{}{
+			"products": results,
+			"page":     page,
+			"limit":    limit,
+			"total":    total,
+		})
+	}
+}
+
+// SuggestProducts - Autocomplete product titles for a partial search (requires catalog:read).
+// Accepts the catalogue filters.
+func SuggestProducts(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := authorize(w, r, db, models.PermCatalogRead); !ok {
+			return
+		}
+
+		prefix := strings.TrimSpace(r.URL.Query().Get("q"))
+		if prefix == "" {
+			http.Error(w, "q is required", http.StatusBadRequest)
+			return
+		}
+
+		filters, err := parseCatalogueFilters(r, db)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+		if err != nil || limit < 1 || limit > maxSuggestions {
+			limit = 10
+		}
+
+		suggestions, err := service.SuggestProducts(db, prefix, filters, limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if suggestions == nil {
+			suggestions = []service.Suggestion{}
+		}
+
+		config.SendJSONResponse(w, map[string]interface{}{
+			"suggestions": suggestions,
+		})
+	}
+}
+
+// parseCatalogueFilters reads the catalogue filters from the query string:
+// category_id, which includes its subcategories, min_price and max_price.
+func parseCatalogueFilters(r *http.Request, db *gorm.DB) (service.CatalogueFilters, error) {
+	var filters service.CatalogueFilters
+	params := r.URL.Query()
+
+	if categoryID := params.Get("category_id"); categoryID != "" {
+		id, err := strconv.Atoi(categoryID)
+		if err != nil {
+			return filters, errors.New("Invalid category ID")
+		}
+		ids, err := service.NewCategoryService(db).DescendantIDs(uint(id))
+		if err != nil {
+			return filters, err
+		}
+		// An unknown category matches nothing rather than everything
+		filters.CategoryIDs = append([]uint{}, ids...)
+	}
+
+	if minPrice := params.Get("min_price"); minPrice != "" {
+		price, err := strconv.Atoi(minPrice)
+		if err != nil {
+			return filters, errors.New("min_price must be a whole number")
+		}
+		filters.MinPrice = &price
+	}
+	if maxPrice := params.Get("max_price"); maxPrice != "" {
+		price, err := strconv.Atoi(maxPrice)
+		if err != nil {
+			return filters, errors.New("max_price must be a whole number")
+		}
+		filters.MaxPrice = &price
+	}
+
+	return filters, nil
+}
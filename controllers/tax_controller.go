@@ -0,0 +1,308 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Pijuyy/testing_project4/config"
+	"github.com/Pijuyy/testing_project4/models"
+	"github.com/Pijuyy/testing_project4/service"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// CreateTaxRate - Create a tax rate (requires taxes:manage)
+func CreateTaxRate(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authorize(w, r, db, models.PermTaxesManage)
+		if !ok {
+			return
+		}
+
+		var requestBody struct {
+			Name        string `json:"name"`
+			BasisPoints int    `json:"basis_points"`
+			IsDefault   bool   `json:"is_default"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		rate := models.TaxRate{
+			Name:        requestBody.Name,
+			BasisPoints: requestBody.BasisPoints,
+			IsDefault:   requestBody.IsDefault,
+		}
+		if err := rate.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var count int64
+		db.Model(&models.TaxRate{}).Where("name = ?", rate.Name).Count(&count)
+		if count > 0 {
+			http.Error(w, "Tax rate already exists", http.StatusConflict)
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := service.SaveTaxRate(tx, &rate); err != nil {
+				return err
+			}
+			return service.RecordAudit(tx, r, user, "tax_rate.create", "tax_rate", rate.ID, nil, rate)
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("ETag", etag(rate.Version))
+		w.WriteHeader(http.StatusCreated)
+		config.SendJSONResponse(w, taxRateResponse(rate))
+	}
+}
+
+// GetTaxRates - List the tax rates and the pricing mode (requires catalog:read)
+func GetTaxRates(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := authorize(w, r, db, models.PermCatalogRead); !ok {
+			return
+		}
+
+		var rates []models.TaxRate
+		if err := db.Order("id").Find(&rates).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responseRates := make([]map[string]interface{}, 0, len(rates))
+		for _, rate := range rates {
+			responseRates = append(responseRates, taxRateResponse(rate))
+		}
+
+		config.SendJSONResponse(w, map[string]interface{}{
+			"pricing_mode": service.TaxPricingMode,
+			"tax_rates":    responseRates,
+		})
+	}
+}
+
+// PatchTaxRate - Partially update a tax rate using JSON Merge Patch (requires
+// taxes:manage). Past transactions keep the rate they were charged.
+func PatchTaxRate(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authorize(w, r, db, models.PermTaxesManage)
+		if !ok {
+			return
+		}
+
+		patch, err := decodeMergePatch(r)
+		if errors.Is(err, errUnsupportedPatch) {
+			http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		rate, ok := findTaxRateFromPath(w, r, db)
+		if !ok {
+			return
+		}
+
+		if !ifMatch(r, rate.Version) {
+			http.Error(w, service.ErrVersionConflict.Error(), http.StatusPreconditionFailed)
+			return
+		}
+
+		before := *rate
+		for field, value := range patch {
+			switch field {
+			case "name":
+				err = decodePatchField(field, value, &rate.Name)
+			case "basis_points":
+				err = decodePatchField(field, value, &rate.BasisPoints)
+			case "is_default":
+				err = decodePatchField(field, value, &rate.IsDefault)
+			default:
+				err = fmt.Errorf("unknown field %s", field)
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		if err := rate.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if rate.Name != before.Name {
+			var count int64
+			db.Model(&models.TaxRate{}).Where("name = ? AND id <> ?", rate.Name, rate.ID).Count(&count)
+			if count > 0 {
+				http.Error(w, "Tax rate already exists", http.StatusConflict)
+				return
+			}
+		}
+
+		rate.UpdatedAt = time.Now()
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := service.SaveTaxRate(tx, rate); err != nil {
+				return err
+			}
+			return service.RecordAudit(tx, r, user, "tax_rate.update", "tax_rate", rate.ID, before, rate)
+		})
+		if errors.Is(err, service.ErrVersionConflict) {
+			http.Error(w, err.Error(), http.StatusPreconditionFailed)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("ETag", etag(rate.Version))
+		config.SendJSONResponse(w, taxRateResponse(*rate))
+	}
+}
+
+// DeleteTaxRate - Delete a tax rate no category uses (requires taxes:manage)
+func DeleteTaxRate(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authorize(w, r, db, models.PermTaxesManage)
+		if !ok {
+			return
+		}
+
+		rate, ok := findTaxRateFromPath(w, r, db)
+		if !ok {
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := service.DeleteTaxRate(tx, rate); err != nil {
+				return err
+			}
+			return service.RecordAudit(tx, r, user, "tax_rate.delete", "tax_rate", rate.ID, rate, nil)
+		})
+		if errors.Is(err, service.ErrTaxRateInUse) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		config.SendJSONResponse(w, map[string]interface{}{
+			"message": "Tax rate has been successfully deleted",
+		})
+	}
+}
+
+// TaxReport - Tax charged per rate, with the net sales it was charged on (requires
+// reports:read). Pass from and to as RFC 3339 timestamps to limit the period.
+func TaxReport(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := authorize(w, r, db, models.PermReportsRead); !ok {
+			return
+		}
+
+		query := db.Model(&models.TransactionHistory{})
+		params := r.URL.Query()
+		if from := params.Get("from"); from != "" {
+			t, err := time.Parse(time.RFC3339, from)
+			if err != nil {
+				http.Error(w, "from must be an RFC 3339 timestamp", http.StatusBadRequest)
+				return
+			}
+			query = query.Where("created_at >= ?", t)
+		}
+		if to := params.Get("to"); to != "" {
+			t, err := time.Parse(time.RFC3339, to)
+			if err != nil {
+				http.Error(w, "to must be an RFC 3339 timestamp", http.StatusBadRequest)
+				return
+			}
+			query = query.Where("created_at < ?", t)
+		}
+
+		var rows []struct {
+			TaxName        string
+			TaxBasisPoints int
+			TaxExclusive   bool
+			Transactions   int64
+			NetSales       models.Money
+			TaxAmount      models.Money
+			TotalSales     models.Money
+		}
+		err := query.
+			Select("tax_name, tax_basis_points, tax_exclusive, COUNT(*) AS transactions, " +
+				"CAST(COALESCE(SUM(subtotal - discount), 0) AS bigint) AS net_sales, " +
+				"CAST(COALESCE(SUM(tax_amount), 0) AS bigint) AS tax_amount, " +
+				"CAST(COALESCE(SUM(total_price), 0) AS bigint) AS total_sales").
+			Group("tax_name, tax_basis_points, tax_exclusive").
+			Order("tax_name, tax_basis_points, tax_exclusive").
+			Scan(&rows).Error
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		totalTax := models.Rupiah(0)
+		response := make([]map[string]interface{}, 0, len(rows))
+		for _, row := range rows {
+			if totalTax, err = totalTax.Add(row.TaxAmount); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			response = append(response, map[string]interface{}{
+				"tax_name":         row.TaxName,
+				"tax_basis_points": row.TaxBasisPoints,
+				"tax_exclusive":    row.TaxExclusive,
+				"transactions":     row.Transactions,
+				"net_sales":        row.NetSales,
+				"tax_amount":       row.TaxAmount,
+				"total_sales":      row.TotalSales,
+			})
+		}
+
+		config.SendJSONResponse(w, map[string]interface{}{
+			"rates":     response,
+			"total_tax": totalTax,
+		})
+	}
+}
+
+func findTaxRateFromPath(w http.ResponseWriter, r *http.Request, db *gorm.DB) (*models.TaxRate, bool) {
+	rateID, err := strconv.Atoi(mux.Vars(r)["taxRateId"])
+	if err != nil {
+		http.Error(w, "Invalid tax rate ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	var rate models.TaxRate
+	if err := db.First(&rate, rateID).Error; err != nil {
+		http.Error(w, "Tax rate not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return &rate, true
+}
+
+func taxRateResponse(rate models.TaxRate) map[string]interface{} {
+	return map[string]interface{}{
+		"id":           rate.ID,
+		"name":         rate.Name,
+		"basis_points": rate.BasisPoints,
+		"is_default":   rate.IsDefault,
+		"version":      rate.Version,
+		"created_at":   rate.CreatedAt.Format(time.RFC3339),
+		"updated_at":   rate.UpdatedAt.Format(time.RFC3339),
+	}
+}
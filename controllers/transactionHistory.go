@@ -1,183 +1,615 @@
-package controllers
-
-import (
-	"encoding/json"
-	"net/http"
-	"time"
-
-	"github.com/Pijuyy/testing_project4/config"
-	"github.com/Pijuyy/testing_project4/models"
-	"gorm.io/gorm"
-)
-
-// CreateTransaction - Create a new transaction
-func CreateTransaction(db *gorm.DB) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// Authenticate user
-		user, err := config.ExtractUserFromToken(r, db)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
-
-		// Parse request body
-		var requestBody struct {
-			ProductID uint `json:"product_id"`
-			Quantity  int  `json:"quantity"`
-		}
-		err = json.NewDecoder(r.Body).Decode(&requestBody)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-
-		// Check if the specified product exists
-		var product models.Product
-		result := db.First(&product, requestBody.ProductID)
-		if result.Error != nil {
-			http.Error(w, "Product not found", http.StatusNotFound)
-			return
-		}
-
-		// Check if the quantity is available in stock
-		if requestBody.Quantity > product.Stock {
-			http.Error(w, "Not enough stock available", http.StatusBadRequest)
-			return
-		}
-
-		// Check if user has enough balance
-		totalPrice := product.Price * requestBody.Quantity
-		if user.Balance < int64(totalPrice) {
-			http.Error(w, "Insufficient balance", http.StatusBadRequest)
-			return
-		}
-
-		// Deduct stock from the product
-		product.Stock -= requestBody.Quantity
-		db.Save(&product)
-
-		// Deduct balance from the user
-		user.Balance -= int64(totalPrice)
-		db.Save(&user)
-
-		// Update sold_product_amount in category
-		var category models.Category
-		db.First(&category, product.CategoryID)
-		category.SoldProductAmount += requestBody.Quantity
-		db.Save(&category)
-
-		// Create a new transaction history record
-		transactionHistory := models.TransactionHistory{
-			ProductID:  requestBody.ProductID,
-			UserID:     user.ID,
-			Quantity:   requestBody.Quantity,
-			TotalPrice: totalPrice,
-			CreatedAt:  time.Now(),
-		}
-		db.Create(&transactionHistory)
-
-		// Prepare the response
-		response := map[string]interface{}{
-			"message": "You have successfully purchased the product",
-			"transaction_bill": map[string]interface{}{
-				"total_price":   totalPrice,
-				"quantity":      requestBody.Quantity,
-				"product_title": product.Title,
-			},
-		}
-
-		// Send the JSON response
-		w.WriteHeader(http.StatusCreated)
-		config.SendJSONResponse(w, response)
-	}
-}
-
-// GetMyTransactions - Get transactions of the authenticated user
-func GetMyTransactions(db *gorm.DB) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// Authenticate user
-		user, err := config.ExtractUserFromToken(r, db)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
-
-		// Retrieve user's transactions
-		var transactions []models.TransactionHistory
-		db.Preload("Product").Where("user_id = ?", user.ID).Find(&transactions)
-
-		// Prepare the response
-		response := make([]map[string]interface{}, 0)
-		for _, transaction := range transactions {
-			transactionData := map[string]interface{}{
-				"id":          transaction.ID,
-				"product_id":  transaction.ProductID,
-				"user_id":     transaction.UserID,
-				"quantity":    transaction.Quantity,
-				"total_price": transaction.TotalPrice,
-				"Product": map[string]interface{}{
-					"id":          transaction.Product.ID,
-					"title":       transaction.Product.Title,
-					"price":       transaction.Product.Price,
-					"stock":       transaction.Product.Stock,
-					"category_id": transaction.Product.CategoryID,
-					"created_at":  transaction.Product.CreatedAt,
-					"updated_at":  transaction.Product.UpdatedAt,
-				},
-			}
-			response = append(response, transactionData)
-		}
-
-		// Send the JSON response
-		config.SendJSONResponse(w, response)
-	}
-}
-
-// GetUserTransactions - Get all transactions for admin
-func GetUserTransactions(db *gorm.DB) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// Authenticate and authorize user
-		authorized, err := config.AuthenticateAndAuthorize(r, db)
-		if err != nil || !authorized {
-			http.Error(w, "Unauthorized access", http.StatusUnauthorized)
-			return
-		}
-
-		// Retrieve all transactions
-		var transactions []models.TransactionHistory
-		db.Preload("Product").Preload("User").Find(&transactions)
-
-		// Prepare the response
-		response := make([]map[string]interface{}, 0)
-		for _, transaction := range transactions {
-			transactionData := map[string]interface{}{
-				"id":          transaction.ID,
-				"product_id":  transaction.ProductID,
-				"user_id":     transaction.UserID,
-				"quantity":    transaction.Quantity,
-				"total_price": transaction.TotalPrice,
-				"Product": map[string]interface{}{
-					"id":          transaction.Product.ID,
-					"title":       transaction.Product.Title,
-					"price":       transaction.Product.Price,
-					"stock":       transaction.Product.Stock,
-					"category_id": transaction.Product.CategoryID,
-					"created_at":  transaction.Product.CreatedAt,
-					"updated_at":  transaction.Product.UpdatedAt,
-				},
-				"User": map[string]interface{}{
-					"id":         transaction.User.ID,
-					"email":      transaction.User.Email,
-					"full_name":  transaction.User.FullName,
-					"balance":    transaction.User.Balance,
-					"created_at": transaction.User.CreatedAt,
-					"updated_at": transaction.User.UpdatedAt,
-				},
-			}
-			response = append(response, transactionData)
-		}
-
-		// Send the JSON response
-		config.SendJSONResponse(w, response)
-	}
-}
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Pijuyy/testing_project4/config"
+	"github.com/Pijuyy/testing_project4/models"
+	"github.com/Pijuyy/testing_project4/service"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// CreateTransaction - Create a new transaction
+func CreateTransaction(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authenticate user; API keys need the orders:create scope
+		user, ok := requireScopedUser(w, r, db, models.ScopeOrdersCreate)
+		if !ok {
+			return
+		}
+
+		// Parse request body
+		var requestBody struct {
+			ProductID     uint  `json:"product_id"`
+			VariantID     *uint `json:"variant_id"`
+			Quantity      int   `json:"quantity"`
+			ReservationID uint  `json:"reservation_id"`
+
+			PromoCode string `json:"promo_code"`
+			AddressID *uint  `json:"address_id"`
+			Pickup    bool   `json:"pickup"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&requestBody)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Paying for a reservation buys exactly what it holds
+		var reservation *models.Reservation
+		if requestBody.ReservationID != 0 {
+			reservation = &models.Reservation{}
+			result := db.Where("id = ? AND user_id = ?", requestBody.ReservationID, user.ID).First(reservation)
+			if result.Error != nil {
+				http.Error(w, "Reservation not found", http.StatusNotFound)
+				return
+			}
+			if reservation.Status != models.ReservationActive || reservation.IsExpired() {
+				http.Error(w, service.ErrReservationUnavailable.Error(), http.StatusConflict)
+				return
+			}
+			if requestBody.ProductID != 0 && requestBody.ProductID != reservation.ProductID ||
+				requestBody.VariantID != nil && !sameVariant(requestBody.VariantID, reservation.VariantID) ||
+				requestBody.Quantity != 0 && requestBody.Quantity != reservation.Quantity {
+				http.Error(w, "product_id, variant_id and quantity must match the reservation", http.StatusBadRequest)
+				return
+			}
+			requestBody.ProductID = reservation.ProductID
+			requestBody.VariantID = reservation.VariantID
+			requestBody.Quantity = reservation.Quantity
+		}
+
+		if requestBody.Quantity <= 0 {
+			http.Error(w, "quantity is required and must be greater than 0", http.StatusBadRequest)
+			return
+		}
+
+		// Check if the specified product exists
+		var product models.Product
+		result := db.First(&product, requestBody.ProductID)
+		if result.Error != nil {
+			http.Error(w, "Product not found", http.StatusNotFound)
+			return
+		}
+
+		variant, ok := findPurchasableVariant(w, db, product, requestBody.VariantID)
+		if !ok {
+			return
+		}
+
+		// A running sale replaces the product's price, but not a variant's own price
+		price, schedule, err := service.EffectivePrice(db, product)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if variant != nil && variant.PriceOverride != nil {
+			price, schedule = *variant.PriceOverride, nil
+		}
+		if schedule != nil && schedule.QuantityCap != nil && requestBody.Quantity > *schedule.Remaining() {
+			http.Error(w, fmt.Sprintf("only %d items are left at the sale price", *schedule.Remaining()), http.StatusConflict)
+			return
+		}
+
+		// Check if the quantity is available in stock, counting the stock held
+		// by the reservation being paid for
+		available := product.Available()
+		if variant != nil {
+			available = variant.Available()
+		}
+		if reservation != nil {
+			available += reservation.Quantity
+		}
+		if requestBody.Quantity > available {
+			http.Error(w, "Not enough stock available", http.StatusBadRequest)
+			return
+		}
+
+		subtotal, err := price.Mul(int64(requestBody.Quantity))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		transactionHistory := models.TransactionHistory{
+			ProductID: requestBody.ProductID,
+			VariantID: requestBody.VariantID,
+			UserID:    user.ID,
+			Quantity:  requestBody.Quantity,
+			CreatedAt: time.Now(),
+			Subtotal:  subtotal,
+
+			PriceScheduleID: scheduleID(schedule),
+			CategoryID:      product.CategoryID,
+			Currency:        user.Currency,
+		}
+
+		// Check the promo code early for a clear error. It is checked again
+		// under lock when it is redeemed below.
+		if requestBody.PromoCode != "" {
+			promotion, err := service.FindPromotion(db, requestBody.PromoCode)
+			if errors.Is(err, service.ErrPromotionNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			} else if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			discount, err := service.CheckPromotion(db, promotion, user.ID, product, subtotal)
+			if errors.Is(err, service.ErrPromotionNotApplicable) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			} else if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			transactionHistory.Discount = discount
+		}
+
+		// The order ships to the chosen address, or the user's default one. It
+		// is picked up when asked for or when the user has no address.
+		var address *models.Address
+		if requestBody.Pickup && requestBody.AddressID != nil {
+			http.Error(w, "address_id cannot be used with pickup", http.StatusBadRequest)
+			return
+		} else if !requestBody.Pickup {
+			address, err = service.ShippingAddressFor(db, user.ID, requestBody.AddressID)
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				http.Error(w, "Address not found", http.StatusNotFound)
+				return
+			} else if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		weightGrams := product.WeightGrams
+		if variant != nil {
+			weightGrams = variant.WeightGrams(product)
+		}
+		weightGrams *= requestBody.Quantity
+		if err := service.ApplyShipping(&transactionHistory, address, weightGrams); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Tax is worked out at the rate of the product's category
+		taxRate, err := service.TaxRateFor(db, product.CategoryID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := service.ApplyTax(&transactionHistory, taxRate); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// The wallet is charged in its own currency at the current rate
+		rate, err := service.ExchangeRateFor(db, user.Currency)
+		if errors.Is(err, service.ErrNoExchangeRate) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		transactionHistory.ExchangeRate = rate.Rate
+		if transactionHistory.ChargedAmount, err = rate.Convert(transactionHistory.TotalPrice); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Check if user has enough balance
+		if user.Balance.Amount < transactionHistory.ChargedAmount.Amount {
+			http.Error(w, "Insufficient balance", http.StatusBadRequest)
+			return
+		}
+
+		// The checks above are repeated atomically in the updates below, so
+		// concurrent purchases can neither oversell nor overdraw
+		var alerts []*models.StockAlert
+		var promotion *models.Promotion
+		err = db.Transaction(func(tx *gorm.DB) error {
+			// Count the quantity against the sale's cap; the sale may have
+			// ended or sold out since the price was looked up
+			if schedule != nil {
+				if err := service.ClaimSaleQuantity(tx, schedule, requestBody.Quantity); err != nil {
+					return err
+				}
+			}
+
+			// Redeem the promo code first; the promotion stays locked until
+			// commit so its usage limits cannot be exceeded
+			if requestBody.PromoCode != "" {
+				redeemed, discount, err := service.RedeemPromotion(tx, requestBody.PromoCode, user.ID, product, subtotal)
+				if err != nil {
+					return err
+				}
+				promotion = redeemed
+				transactionHistory.PromotionID = &redeemed.ID
+				transactionHistory.Discount = discount
+				if err := service.ApplyShipping(&transactionHistory, address, weightGrams); err != nil {
+					return err
+				}
+				if err := service.ApplyTax(&transactionHistory, taxRate); err != nil {
+					return err
+				}
+				if transactionHistory.ChargedAmount, err = rate.Convert(transactionHistory.TotalPrice); err != nil {
+					return err
+				}
+			}
+
+			// Deduct balance from the user
+			if err := service.DebitBalance(tx, user.ID, transactionHistory.ChargedAmount); err != nil {
+				return err
+			}
+
+			// Update sold_product_amount in category
+			if err := service.NewCategoryService(tx).AddSoldProducts(product.CategoryID, requestBody.Quantity); err != nil {
+				return err
+			}
+
+			// Create a new transaction history record
+			if err := tx.Create(&transactionHistory).Error; err != nil {
+				return err
+			}
+			if promotion != nil {
+				if err := service.RecordRedemption(tx, promotion, &transactionHistory); err != nil {
+					return err
+				}
+			}
+
+			// Convert the reservation first so its stock becomes available to this sale
+			if reservation != nil {
+				locked, err := service.LockReservation(tx, reservation.ID)
+				if err != nil {
+					return err
+				}
+				if locked.IsExpired() {
+					return service.ErrReservationUnavailable
+				}
+				err = service.ReleaseReservation(tx, locked, models.ReservationConverted, &transactionHistory.ID)
+				if err != nil {
+					return err
+				}
+			}
+
+			// Allocate the quantity from the warehouses and record a sale
+			// movement for each of them
+			allocations, err := service.AllocateStock(tx, product.ID, requestBody.VariantID, requestBody.Quantity, service.AllocationStrategy)
+			if err != nil {
+				return err
+			}
+			for _, allocation := range allocations {
+				movement, err := service.ApplyStockChange(tx, service.StockChange{
+					ProductID:     product.ID,
+					VariantID:     requestBody.VariantID,
+					WarehouseID:   allocation.WarehouseID,
+					Type:          models.MovementSale,
+					Quantity:      -allocation.Quantity,
+					Reason:        "sale",
+					ActorID:       &user.ID,
+					TransactionID: &transactionHistory.ID,
+				})
+				if err != nil {
+					return err
+				}
+				alert, err := service.RaiseStockAlert(tx, movement)
+				if err != nil {
+					return err
+				}
+				if alert != nil {
+					alerts = append(alerts, alert)
+				}
+			}
+
+			return service.RecordAudit(tx, r, user, "transaction.create", "transaction", transactionHistory.ID, nil, transactionHistory)
+		})
+		if errors.Is(err, service.ErrInsufficientStock) || errors.Is(err, service.ErrInsufficientBalance) ||
+			errors.Is(err, service.ErrVariantRequired) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		} else if errors.Is(err, service.ErrReservationUnavailable) || errors.Is(err, service.ErrSaleUnavailable) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		} else if errors.Is(err, service.ErrPromotionNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if errors.Is(err, service.ErrPromotionNotApplicable) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		service.NotifyStockAlerts(alerts...)
+
+		// Prepare the response
+		response := map[string]interface{}{
+			"message": "You have successfully purchased the product",
+			"transaction_bill": map[string]interface{}{
+				"total_price":   transactionHistory.TotalPrice,
+				"quantity":      requestBody.Quantity,
+				"product_title": product.Title,
+				"variant_id":    requestBody.VariantID,
+
+				"subtotal":     transactionHistory.Subtotal,
+				"discount":     transactionHistory.Discount,
+				"promotion_id": transactionHistory.PromotionID,
+
+				"unit_price":        price,
+				"price_schedule_id": transactionHistory.PriceScheduleID,
+				"charged_amount":    transactionHistory.ChargedAmount,
+				"exchange_rate":     transactionHistory.ExchangeRate,
+				"tax":               taxResponse(transactionHistory),
+				"shipping":          shippingResponse(transactionHistory),
+			},
+		}
+
+		// Send the JSON response
+		w.WriteHeader(http.StatusCreated)
+		config.SendJSONResponse(w, response)
+	}
+}
+
+// GetMyTransactions - Get transactions of the authenticated user
+func GetMyTransactions(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authenticate user
+		user, err := config.ExtractUserFromToken(r, db)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		// Retrieve user's transactions
+		var transactions []models.TransactionHistory
+		db.Preload("Product").Where("user_id = ?", user.ID).Find(&transactions)
+
+		// Prepare the response
+		response := make([]map[string]interface{}, 0)
+		for _, transaction := range transactions {
+			transactionData := map[string]interface{}{
+				"id":          transaction.ID,
+				"product_id":  transaction.ProductID,
+				"variant_id":  transaction.VariantID,
+				"user_id":     transaction.UserID,
+				"quantity":    transaction.Quantity,
+				"total_price": transaction.TotalPrice,
+				"Product": map[string]interface{}{
+					"id":          transaction.Product.ID,
+					"title":       transaction.Product.Title,
+					"price":       transaction.Product.Price,
+					"stock":       transaction.Product.Stock,
+					"category_id": transaction.Product.CategoryID,
+					"created_at":  transaction.Product.CreatedAt,
+					"updated_at":  transaction.Product.UpdatedAt,
+				},
+
+				"subtotal":     transaction.Subtotal,
+				"discount":     transaction.Discount,
+				"promotion_id": transaction.PromotionID,
+
+				"price_schedule_id": transaction.PriceScheduleID,
+				"charged_amount":    transaction.ChargedAmount,
+				"exchange_rate":     transaction.ExchangeRate,
+				"tax":               taxResponse(transaction),
+				"shipping":          shippingResponse(transaction),
+			}
+			response = append(response, transactionData)
+		}
+
+		// Send the JSON response
+		config.SendJSONResponse(w, response)
+	}
+}
+
+// GetUserTransactions - Get all transactions for admin
+func GetUserTransactions(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authenticate and authorize user
+		if _, ok := authorize(w, r, db, models.PermOrdersReadAll); !ok {
+			return
+		}
+
+		// Retrieve all transactions
+		var transactions []models.TransactionHistory
+		db.Preload("Product").Preload("User").Find(&transactions)
+
+		// Prepare the response
+		response := make([]map[string]interface{}, 0)
+		for _, transaction := range transactions {
+			transactionData := map[string]interface{}{
+				"id":          transaction.ID,
+				"product_id":  transaction.ProductID,
+				"variant_id":  transaction.VariantID,
+				"user_id":     transaction.UserID,
+				"quantity":    transaction.Quantity,
+				"total_price": transaction.TotalPrice,
+				"Product": map[string]interface{}{
+					"id":          transaction.Product.ID,
+					"title":       transaction.Product.Title,
+					"price":       transaction.Product.Price,
+					"stock":       transaction.Product.Stock,
+					"category_id": transaction.Product.CategoryID,
+					"created_at":  transaction.Product.CreatedAt,
+					"updated_at":  transaction.Product.UpdatedAt,
+				},
+				"User": map[string]interface{}{
+					"id":         transaction.User.ID,
+					"email":      transaction.User.Email,
+					"full_name":  transaction.User.FullName,
+					"balance":    transaction.User.Balance,
+					"created_at": transaction.User.CreatedAt,
+					"updated_at": transaction.User.UpdatedAt,
+				},
+
+				"subtotal":     transaction.Subtotal,
+				"discount":     transaction.Discount,
+				"promotion_id": transaction.PromotionID,
+
+				"price_schedule_id": transaction.PriceScheduleID,
+				"charged_amount":    transaction.ChargedAmount,
+				"exchange_rate":     transaction.ExchangeRate,
+				"tax":               taxResponse(transaction),
+				"shipping":          shippingResponse(transaction),
+			}
+			response = append(response, transactionData)
+		}
+
+		// Send the JSON response
+		config.SendJSONResponse(w, response)
+	}
+}
+
+// GetTransaction - Get a single transaction. Customers only see their own,
+// users with orders:read_all see every transaction.
+func GetTransaction(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authenticate user
+		user, err := config.ExtractUserFromToken(r, db)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		transactionID, err := strconv.Atoi(mux.Vars(r)["transactionId"])
+		if err != nil {
+			http.Error(w, "Invalid transaction ID", http.StatusBadRequest)
+			return
+		}
+
+		expand, err := parseExpand(r, "product", "product.category", "user")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		query := db
+		if expand["product"] || expand["product.category"] {
+			query = query.Preload("Product")
+		}
+		if expand["product.category"] {
+			query = query.Preload("Product.Category")
+		}
+		if expand["user"] {
+			query = query.Preload("User")
+		}
+
+		var transaction models.TransactionHistory
+		if err := query.First(&transaction, transactionID).Error; err != nil {
+			http.Error(w, "Transaction not found", http.StatusNotFound)
+			return
+		}
+
+		// Other users' transactions are reported as missing rather than forbidden
+		if transaction.UserID != user.ID {
+			canReadAll, err := config.HasPermission(db, user, models.PermOrdersReadAll)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if !canReadAll {
+				http.Error(w, "Transaction not found", http.StatusNotFound)
+				return
+			}
+		}
+
+		response := map[string]interface{}{
+			"id":          transaction.ID,
+			"product_id":  transaction.ProductID,
+			"variant_id":  transaction.VariantID,
+			"user_id":     transaction.UserID,
+			"quantity":    transaction.Quantity,
+			"total_price": transaction.TotalPrice,
+			"created_at":  transaction.CreatedAt.Format(time.RFC3339),
+
+			"subtotal":     transaction.Subtotal,
+			"discount":     transaction.Discount,
+			"promotion_id": transaction.PromotionID,
+
+			"price_schedule_id": transaction.PriceScheduleID,
+			"charged_amount":    transaction.ChargedAmount,
+			"exchange_rate":     transaction.ExchangeRate,
+			"tax":               taxResponse(transaction),
+			"shipping":          shippingResponse(transaction),
+		}
+		if expand["product"] || expand["product.category"] {
+			product := productResponse(transaction.Product)
+			if expand["product.category"] {
+				product["category"] = categoryResponse(transaction.Product.Category)
+			}
+			response["product"] = product
+		}
+		if expand["user"] {
+			response["user"] = map[string]interface{}{
+				"id":        transaction.User.ID,
+				"email":     transaction.User.Email,
+				"full_name": transaction.User.FullName,
+			}
+		}
+
+		config.SendJSONResponse(w, response)
+	}
+}
+
+// findPurchasableVariant loads the variant being bought. Products with
+// variants can only be bought through one of them. It returns nil for
+// products without variants and writes an error response when it fails.
+func findPurchasableVariant(w http.ResponseWriter, db *gorm.DB, product models.Product, variantID *uint) (*models.ProductVariant, bool) {
+	if variantID == nil {
+		var count int64
+		db.Model(&models.ProductVariant{}).Where("product_id = ?", product.ID).Count(&count)
+		if count > 0 {
+			http.Error(w, "variant_id is required for products with variants", http.StatusBadRequest)
+			return nil, false
+		}
+		return nil, true
+	}
+
+	var variant models.ProductVariant
+	if err := db.Where("id = ? AND product_id = ?", *variantID, product.ID).First(&variant).Error; err != nil {
+		http.Error(w, "Variant not found", http.StatusNotFound)
+		return nil, false
+	}
+	return &variant, true
+}
+
+func scheduleID(schedule *models.PriceSchedule) *uint {
+	if schedule == nil {
+		return nil
+	}
+	return &schedule.ID
+}
+
+func sameVariant(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// taxResponse describes the tax charged on a transaction.
+func taxResponse(transaction models.TransactionHistory) map[string]interface{} {
+	return map[string]interface{}{
+		"tax_rate_id":  transaction.TaxRateID,
+		"name":         transaction.TaxName,
+		"basis_points": transaction.TaxBasisPoints,
+		"amount":       transaction.TaxAmount,
+		"exclusive":    transaction.TaxExclusive,
+	}
+}
+
+// shippingResponse describes where a transaction ships to and what it costs.
+func shippingResponse(transaction models.TransactionHistory) map[string]interface{} {
+	return map[string]interface{}{
+		"address_id": transaction.ShippingAddressID,
+		"address":    transaction.ShippingAddress,
+		"method":     transaction.ShippingMethod,
+		"cost":       transaction.ShippingCost,
+	}
+}
@@ -0,0 +1,361 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Pijuyy/testing_project4/config"
+	"github.com/Pijuyy/testing_project4/models"
+	"github.com/Pijuyy/testing_project4/service"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// CreateVariant - Add a variant to a product (requires catalog:write)
+func CreateVariant(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authorize(w, r, db, models.PermCatalogWrite)
+		if !ok {
+			return
+		}
+
+		product, ok := findProductFromPath(w, r, db)
+		if !ok {
+			return
+		}
+
+		var requestBody struct {
+			SKU                 string            `json:"sku"`
+			Options             map[string]string `json:"options"`
+			PriceOverride       *models.Money     `json:"price_override"`
+			WeightGramsOverride *int              `json:"weight_grams_override"`
+			Stock               int               `json:"stock"`
+			WarehouseID         uint              `json:"warehouse_id"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&requestBody)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if requestBody.Stock < 0 {
+			http.Error(w, "stock must not be negative", http.StatusBadRequest)
+			return
+		}
+
+		variant := models.ProductVariant{
+			ProductID:           product.ID,
+			SKU:                 strings.TrimSpace(requestBody.SKU),
+			PriceOverride:       requestBody.PriceOverride,
+			WeightGramsOverride: requestBody.WeightGramsOverride,
+		}
+		variant.SetOptions(requestBody.Options)
+		if err := variant.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if taken, err := service.VariantSKUTaken(db, variant.SKU, 0); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		} else if taken {
+			http.Error(w, "SKU already exists", http.StatusConflict)
+			return
+		}
+
+		// The initial stock goes to the given warehouse, or the default one
+		warehouse, err := service.FindWarehouse(db, requestBody.WarehouseID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		// The first variant takes over the product's own stock
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := service.CreateVariant(tx, &variant, &user.ID); err != nil {
+				return err
+			}
+			if requestBody.Stock > 0 {
+				_, err := service.ApplyStockChange(tx, service.StockChange{
+					ProductID:   product.ID,
+					VariantID:   &variant.ID,
+					WarehouseID: warehouse.ID,
+					Type:        models.MovementRestock,
+					Quantity:    requestBody.Stock,
+					Reason:      "initial stock",
+					ActorID:     &user.ID,
+				})
+				if err != nil {
+					return err
+				}
+				variant.Stock += requestBody.Stock
+			}
+			return service.RecordAudit(tx, r, user, "variant.create", "variant", variant.ID, nil, variant)
+		})
+		if service.IsUniqueViolation(err) {
+			http.Error(w, "SKU already exists", http.StatusConflict)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("ETag", etag(variant.Version))
+		w.WriteHeader(http.StatusCreated)
+		config.SendJSONResponse(w, variantResponse(variant, *product))
+	}
+}
+
+// GetVariants - List the variants of a product (requires catalog:read)
+func GetVariants(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := authorize(w, r, db, models.PermCatalogRead); !ok {
+			return
+		}
+
+		product, ok := findProductFromPath(w, r, db)
+		if !ok {
+			return
+		}
+
+		var variants []models.ProductVariant
+		if err := db.Where("product_id = ?", product.ID).Order("id").Find(&variants).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		config.SendJSONResponse(w, variantResponses(variants, *product))
+	}
+}
+
+// PatchVariant - Partially update a variant using JSON Merge Patch (requires catalog:write)
+func PatchVariant(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authorize(w, r, db, models.PermCatalogWrite)
+		if !ok {
+			return
+		}
+
+		product, ok := findProductFromPath(w, r, db)
+		if !ok {
+			return
+		}
+
+		patch, err := decodeMergePatch(r)
+		if errors.Is(err, errUnsupportedPatch) {
+			http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		variant, ok := findVariantFromPath(w, r, db, product.ID)
+		if !ok {
+			return
+		}
+
+		if !ifMatch(r, variant.Version) {
+			http.Error(w, service.ErrVersionConflict.Error(), http.StatusPreconditionFailed)
+			return
+		}
+
+		// Only the members present in the patch are applied
+		before := *variant
+		for field, value := range patch {
+			switch field {
+			case "sku":
+				err = decodePatchField(field, value, &variant.SKU)
+				variant.SKU = strings.TrimSpace(variant.SKU)
+			case "options":
+				// Options are merged in; a null option removes it
+				var changes map[string]*string
+				if err = decodePatchField(field, value, &changes); err == nil {
+					options := variant.OptionMap()
+					for name, option := range changes {
+						if option == nil {
+							delete(options, name)
+						} else {
+							options[name] = *option
+						}
+					}
+					variant.SetOptions(options)
+				}
+			case "price_override":
+				// Removing the override makes the variant use the product's price
+				variant.PriceOverride = nil
+				if string(value) != "null" {
+					err = decodePatchField(field, value, &variant.PriceOverride)
+				}
+			case "weight_grams_override":
+				// Removing the override makes the variant use the product's weight
+				variant.WeightGramsOverride = nil
+				if string(value) != "null" {
+					err = decodePatchField(field, value, &variant.WeightGramsOverride)
+				}
+			case "stock":
+				err = decodePatchField(field, value, &variant.Stock)
+				if err == nil && variant.Stock != before.Stock {
+					err = errStockReadOnly
+				}
+			default:
+				err = fmt.Errorf("unknown field %s", field)
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		if err := variant.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if taken, err := service.VariantSKUTaken(db, variant.SKU, variant.ID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		} else if taken {
+			http.Error(w, "SKU already exists", http.StatusConflict)
+			return
+		}
+
+		variant.UpdatedAt = time.Now()
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := service.UpdateVariant(tx, variant); err != nil {
+				return err
+			}
+			return service.RecordAudit(tx, r, user, "variant.update", "variant", variant.ID, before, variant)
+		})
+		if errors.Is(err, service.ErrVersionConflict) {
+			http.Error(w, err.Error(), http.StatusPreconditionFailed)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("ETag", etag(variant.Version))
+		config.SendJSONResponse(w, variantResponse(*variant, *product))
+	}
+}
+
+// DeleteVariant - Delete a variant that no longer holds stock (requires catalog:write)
+func DeleteVariant(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authorize(w, r, db, models.PermCatalogWrite)
+		if !ok {
+			return
+		}
+
+		product, ok := findProductFromPath(w, r, db)
+		if !ok {
+			return
+		}
+
+		variant, ok := findVariantFromPath(w, r, db, product.ID)
+		if !ok {
+			return
+		}
+
+		if !ifMatch(r, variant.Version) {
+			http.Error(w, service.ErrVersionConflict.Error(), http.StatusPreconditionFailed)
+			return
+		}
+
+		// Stock would otherwise be left in the product's total with no way to sell it
+		if variant.Stock != 0 || variant.Reserved != 0 {
+			http.Error(w, "Variant still holds stock, adjust it to zero before deleting", http.StatusConflict)
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			result := tx.Where("version = ? AND stock = 0 AND reserved = 0", variant.Version).Delete(variant)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return service.ErrVersionConflict
+			}
+			if err := tx.Where("variant_id = ?", variant.ID).Delete(&models.WarehouseStock{}).Error; err != nil {
+				return err
+			}
+			return service.RecordAudit(tx, r, user, "variant.delete", "variant", variant.ID, variant, nil)
+		})
+		if errors.Is(err, service.ErrVersionConflict) {
+			http.Error(w, err.Error(), http.StatusPreconditionFailed)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		config.SendJSONResponse(w, map[string]interface{}{
+			"message": "Variant has been successfully deleted",
+		})
+	}
+}
+
+func findProductFromPath(w http.ResponseWriter, r *http.Request, db *gorm.DB) (*models.Product, bool) {
+	productID, err := strconv.Atoi(mux.Vars(r)["productId"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	var product models.Product
+	if err := db.First(&product, productID).Error; err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return &product, true
+}
+
+func findVariantFromPath(w http.ResponseWriter, r *http.Request, db *gorm.DB, productID uint) (*models.ProductVariant, bool) {
+	variantID, err := strconv.Atoi(mux.Vars(r)["variantId"])
+	if err != nil {
+		http.Error(w, "Invalid variant ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	var variant models.ProductVariant
+	if err := db.Where("id = ? AND product_id = ?", variantID, productID).First(&variant).Error; err != nil {
+		http.Error(w, "Variant not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return &variant, true
+}
+
+func variantResponse(variant models.ProductVariant, product models.Product) map[string]interface{} {
+	return map[string]interface{}{
+		"id":                    variant.ID,
+		"product_id":            variant.ProductID,
+		"sku":                   variant.SKU,
+		"options":               variant.OptionMap(),
+		"price_override":        variant.PriceOverride,
+		"price":                 variant.Price(product),
+		"weight_grams_override": variant.WeightGramsOverride,
+		"weight_grams":          variant.WeightGrams(product),
+		"stock":                 variant.Stock,
+		"reserved":              variant.Reserved,
+		"available":             variant.Available(),
+		"version":               variant.Version,
+		"created_at":            variant.CreatedAt.Format(time.RFC3339),
+		"updated_at":            variant.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+func variantResponses(variants []models.ProductVariant, product models.Product) []map[string]interface{} {
+	response := make([]map[string]interface{}, 0, len(variants))
+	for _, variant := range variants {
+		response = append(response, variantResponse(variant, product))
+	}
+	return response
+}
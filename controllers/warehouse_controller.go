@@ -0,0 +1,406 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Pijuyy/testing_project4/config"
+	"github.com/Pijuyy/testing_project4/models"
+	"github.com/Pijuyy/testing_project4/service"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// CreateWarehouse - Create a new warehouse (requires inventory:adjust)
+func CreateWarehouse(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authorize(w, r, db, models.PermInventoryAdjust)
+		if !ok {
+			return
+		}
+
+		var requestBody struct {
+			Code     string `json:"code"`
+			Name     string `json:"name"`
+			Priority int    `json:"priority"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&requestBody)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		warehouse := models.Warehouse{
+			Code:     strings.ToUpper(strings.TrimSpace(requestBody.Code)),
+			Name:     strings.TrimSpace(requestBody.Name),
+			Priority: requestBody.Priority,
+			Active:   true,
+		}
+
+		var count int64
+		db.Model(&models.Warehouse{}).Where("code = ?", warehouse.Code).Count(&count)
+		if count > 0 {
+			http.Error(w, "Warehouse code already exists", http.StatusConflict)
+			return
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&warehouse).Error; err != nil {
+				return err
+			}
+			return service.RecordAudit(tx, r, user, "warehouse.create", "warehouse", warehouse.ID, nil, warehouse)
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		config.SendJSONResponse(w, warehouseResponse(warehouse))
+	}
+}
+
+// GetWarehouses - List all warehouses in allocation order (requires inventory:read)
+func GetWarehouses(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := authorize(w, r, db, models.PermInventoryRead); !ok {
+			return
+		}
+
+		var warehouses []models.Warehouse
+		if err := db.Order("priority, id").Find(&warehouses).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		response := make([]map[string]interface{}, 0, len(warehouses))
+		for _, warehouse := range warehouses {
+			response = append(response, warehouseResponse(warehouse))
+		}
+
+		config.SendJSONResponse(w, response)
+	}
+}
+
+// UpdateWarehouse - Rename, reprioritize or (de)activate a warehouse using JSON Merge Patch (requires inventory:adjust)
+func UpdateWarehouse(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authorize(w, r, db, models.PermInventoryAdjust)
+		if !ok {
+			return
+		}
+
+		warehouseID, err := strconv.Atoi(mux.Vars(r)["warehouseId"])
+		if err != nil {
+			http.Error(w, "Invalid warehouse ID", http.StatusBadRequest)
+			return
+		}
+
+		patch, err := decodeMergePatch(r)
+		if errors.Is(err, errUnsupportedPatch) {
+			http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var warehouse models.Warehouse
+		if err := db.First(&warehouse, warehouseID).Error; err != nil {
+			http.Error(w, "Warehouse not found", http.StatusNotFound)
+			return
+		}
+
+		before := warehouse
+		for field, value := range patch {
+			switch field {
+			case "name":
+				err = decodePatchField(field, value, &warehouse.Name)
+			case "priority":
+				err = decodePatchField(field, value, &warehouse.Priority)
+			case "active":
+				err = decodePatchField(field, value, &warehouse.Active)
+			default:
+				err = fmt.Errorf("unknown field %s", field)
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		warehouse.Name = strings.TrimSpace(warehouse.Name)
+		if err := warehouse.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Stock in an inactive warehouse could not be sold, so it has to be
+		// transferred out first
+		if before.Active && !warehouse.Active {
+			var stock int64
+			db.Model(&models.WarehouseStock{}).Where("warehouse_id = ? AND quantity > 0", warehouse.ID).Count(&stock)
+			if stock > 0 {
+				http.Error(w, "Warehouse still holds stock, transfer it before deactivating", http.StatusConflict)
+				return
+			}
+		}
+
+		warehouse.UpdatedAt = time.Now()
+		err = db.Transaction(func(tx *gorm.DB) error {
+			err := tx.Model(&warehouse).Updates(map[string]interface{}{
+				"name":       warehouse.Name,
+				"priority":   warehouse.Priority,
+				"active":     warehouse.Active,
+				"updated_at": warehouse.UpdatedAt,
+			}).Error
+			if err != nil {
+				return err
+			}
+			return service.RecordAudit(tx, r, user, "warehouse.update", "warehouse", warehouse.ID, before, warehouse)
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		config.SendJSONResponse(w, warehouseResponse(warehouse))
+	}
+}
+
+// GetWarehouseStock - List the stock levels held by a warehouse (requires inventory:read)
+func GetWarehouseStock(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := authorize(w, r, db, models.PermInventoryRead); !ok {
+			return
+		}
+
+		warehouseID, err := strconv.Atoi(mux.Vars(r)["warehouseId"])
+		if err != nil {
+			http.Error(w, "Invalid warehouse ID", http.StatusBadRequest)
+			return
+		}
+
+		var warehouse models.Warehouse
+		if err := db.First(&warehouse, warehouseID).Error; err != nil {
+			http.Error(w, "Warehouse not found", http.StatusNotFound)
+			return
+		}
+
+		var levels []models.WarehouseStock
+		if err := db.Where("warehouse_id = ?", warehouse.ID).Order("product_id").Find(&levels).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		response := make([]map[string]interface{}, 0, len(levels))
+		for _, level := range levels {
+			response = append(response, warehouseStockResponse(level))
+		}
+
+		config.SendJSONResponse(w, response)
+	}
+}
+
+// GetProductStockLevels - List a product's stock per warehouse (requires inventory:read)
+func GetProductStockLevels(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := authorize(w, r, db, models.PermInventoryRead); !ok {
+			return
+		}
+
+		productID, err := strconv.Atoi(mux.Vars(r)["productId"])
+		if err != nil {
+			http.Error(w, "Invalid product ID", http.StatusBadRequest)
+			return
+		}
+
+		var product models.Product
+		if err := db.First(&product, productID).Error; err != nil {
+			http.Error(w, "Product not found", http.StatusNotFound)
+			return
+		}
+
+		var levels []models.WarehouseStock
+		if err := db.Where("product_id = ?", product.ID).Order("warehouse_id").Find(&levels).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responseLevels := make([]map[string]interface{}, 0, len(levels))
+		for _, level := range levels {
+			responseLevels = append(responseLevels, warehouseStockResponse(level))
+		}
+
+		config.SendJSONResponse(w, map[string]interface{}{
+			"product_id": product.ID,
+			"stock":      product.Stock,
+			"warehouses": responseLevels,
+		})
+	}
+}
+
+// CreateStockTransfer - Move stock of a product between warehouses (requires inventory:adjust)
+func CreateStockTransfer(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authorize(w, r, db, models.PermInventoryAdjust)
+		if !ok {
+			return
+		}
+
+		var requestBody struct {
+			ProductID       uint   `json:"product_id"`
+			VariantID       *uint  `json:"variant_id"`
+			FromWarehouseID uint   `json:"from_warehouse_id"`
+			ToWarehouseID   uint   `json:"to_warehouse_id"`
+			Quantity        int    `json:"quantity"`
+			Reason          string `json:"reason"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&requestBody)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if requestBody.FromWarehouseID == 0 || requestBody.ToWarehouseID == 0 {
+			http.Error(w, "from_warehouse_id and to_warehouse_id are required", http.StatusBadRequest)
+			return
+		}
+
+		var product models.Product
+		if err := db.First(&product, requestBody.ProductID).Error; err != nil {
+			http.Error(w, "Product not found", http.StatusNotFound)
+			return
+		}
+
+		if requestBody.VariantID != nil {
+			var variant models.ProductVariant
+			if err := db.Where("id = ? AND product_id = ?", *requestBody.VariantID, product.ID).First(&variant).Error; err != nil {
+				http.Error(w, "Variant not found", http.StatusNotFound)
+				return
+			}
+		}
+
+		transfer := models.StockTransfer{
+			ProductID:       product.ID,
+			VariantID:       requestBody.VariantID,
+			FromWarehouseID: requestBody.FromWarehouseID,
+			ToWarehouseID:   requestBody.ToWarehouseID,
+			Quantity:        requestBody.Quantity,
+			Reason:          strings.TrimSpace(requestBody.Reason),
+			ActorID:         user.ID,
+		}
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := service.TransferStock(tx, &transfer); err != nil {
+				return err
+			}
+			return service.RecordAudit(tx, r, user, "stock_transfer.create", "stock_transfer", transfer.ID, nil, transfer)
+		})
+		if errors.Is(err, service.ErrWarehouseNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if errors.Is(err, service.ErrInsufficientStock) {
+			http.Error(w, "Not enough stock in the source warehouse", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		config.SendJSONResponse(w, stockTransferResponse(transfer))
+	}
+}
+
+// GetStockTransfers - List stock transfers, newest first (requires inventory:read)
+func GetStockTransfers(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := authorize(w, r, db, models.PermInventoryRead); !ok {
+			return
+		}
+
+		page, limit := parsePagination(r)
+		query := db.Model(&models.StockTransfer{})
+		if productID := r.URL.Query().Get("product_id"); productID != "" {
+			id, err := strconv.Atoi(productID)
+			if err != nil {
+				http.Error(w, "Invalid product ID", http.StatusBadRequest)
+				return
+			}
+			query = query.Where("product_id = ?", id)
+		}
+		if warehouseID := r.URL.Query().Get("warehouse_id"); warehouseID != "" {
+			id, err := strconv.Atoi(warehouseID)
+			if err != nil {
+				http.Error(w, "Invalid warehouse ID", http.StatusBadRequest)
+				return
+			}
+			query = query.Where("from_warehouse_id = ? OR to_warehouse_id = ?", id, id)
+		}
+
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var transfers []models.StockTransfer
+		if err := query.Order("id DESC").Offset((page - 1) * limit).Limit(limit).Find(&transfers).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responseTransfers := make([]map[string]interface{}, 0, len(transfers))
+		for _, transfer := range transfers {
+			responseTransfers = append(responseTransfers, stockTransferResponse(transfer))
+		}
+
+		config.SendJSONResponse(w, map[string]interface{}{
+			"transfers": responseTransfers,
+			"page":      page,
+			"limit":     limit,
+			"total":     total,
+		})
+	}
+}
+
+func warehouseResponse(warehouse models.Warehouse) map[string]interface{} {
+	return map[string]interface{}{
+		"id":         warehouse.ID,
+		"code":       warehouse.Code,
+		"name":       warehouse.Name,
+		"priority":   warehouse.Priority,
+		"active":     warehouse.Active,
+		"created_at": warehouse.CreatedAt.Format(time.RFC3339),
+		"updated_at": warehouse.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+func warehouseStockResponse(level models.WarehouseStock) map[string]interface{} {
+	return map[string]interface{}{
+		"warehouse_id": level.WarehouseID,
+		"product_id":   level.ProductID,
+		"variant_id":   level.VariantID,
+		"quantity":     level.Quantity,
+		"updated_at":   level.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+func stockTransferResponse(transfer models.StockTransfer) map[string]interface{} {
+	return map[string]interface{}{
+		"id":                transfer.ID,
+		"product_id":        transfer.ProductID,
+		"variant_id":        transfer.VariantID,
+		"from_warehouse_id": transfer.FromWarehouseID,
+		"to_warehouse_id":   transfer.ToWarehouseID,
+		"quantity":          transfer.Quantity,
+		"reason":            transfer.Reason,
+		"actor_id":          transfer.ActorID,
+		"created_at":        transfer.CreatedAt.Format(time.RFC3339),
+	}
+}
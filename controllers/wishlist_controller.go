@@ -0,0 +1,235 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Pijuyy/testing_project4/config"
+	"github.com/Pijuyy/testing_project4/models"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AddToWishlist - Save a product to the authenticated user's wishlist
+func AddToWishlist(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := requireInteractiveUser(w, r, db)
+		if !ok {
+			return
+		}
+
+		var requestBody struct {
+			ProductID uint `json:"product_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var product models.Product
+		if err := db.First(&product, requestBody.ProductID).Error; err != nil {
+			http.Error(w, "Product not found", http.StatusNotFound)
+			return
+		}
+
+		// Adding a product twice keeps the original entry
+		item := models.WishlistItem{UserID: user.ID, ProductID: product.ID}
+		err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&item).Error
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := db.Where("user_id = ? AND product_id = ?", user.ID, product.ID).First(&item).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		item.Product = product
+
+		w.WriteHeader(http.StatusCreated)
+		config.SendJSONResponse(w, wishlistItemResponse(item))
+	}
+}
+
+// GetWishlist - List the authenticated user's wishlist, most recently added first
+func GetWishlist(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := config.ExtractUserFromToken(r, db)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var items []models.WishlistItem
+		if err := db.Preload("Product").Where("user_id = ?", user.ID).Order("id DESC").Find(&items).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		response := make([]map[string]interface{}, 0, len(items))
+		for _, item := range items {
+			response = append(response, wishlistItemResponse(item))
+		}
+
+		config.SendJSONResponse(w, response)
+	}
+}
+
+// RemoveFromWishlist - Remove a product from the authenticated user's wishlist
+func RemoveFromWishlist(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := requireInteractiveUser(w, r, db)
+		if !ok {
+			return
+		}
+
+		productID, err := strconv.Atoi(mux.Vars(r)["productId"])
+		if err != nil {
+			http.Error(w, "Invalid product ID", http.StatusBadRequest)
+			return
+		}
+
+		result := db.Where("user_id = ? AND product_id = ?", user.ID, productID).Delete(&models.WishlistItem{})
+		if result.Error != nil {
+			http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+		if result.RowsAffected == 0 {
+			http.Error(w, "Product is not in your wishlist", http.StatusNotFound)
+			return
+		}
+
+		config.SendJSONResponse(w, map[string]interface{}{
+			"message": "Product has been removed from your wishlist",
+		})
+	}
+}
+
+// GetMyNotifications - List the authenticated user's notifications, newest first.
+// Pass unread=true to only list unread ones.
+func GetMyNotifications(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := config.ExtractUserFromToken(r, db)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		page, limit := parsePagination(r)
+		query := db.Model(&models.Notification{}).Where("user_id = ?", user.ID)
+		if r.URL.Query().Get("unread") == "true" {
+			query = query.Where("read_at IS NULL")
+		}
+
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var unread int64
+		if err := db.Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", user.ID).Count(&unread).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var notifications []models.Notification
+		if err := query.Order("id DESC").Offset((page - 1) * limit).Limit(limit).Find(&notifications).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responseNotifications := make([]map[string]interface{}, 0, len(notifications))
+		for _, notification := range notifications {
+			responseNotifications = append(responseNotifications, notificationResponse(notification))
+		}
+
+		config.SendJSONResponse(w, map[string]interface{}{
+			"notifications": responseNotifications,
+			"unread":        unread,
+			"page":          page,
+			"limit":         limit,
+			"total":         total,
+		})
+	}
+}
+
+// MarkNotificationRead - Mark one of the authenticated user's notifications as read
+func MarkNotificationRead(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := requireInteractiveUser(w, r, db)
+		if !ok {
+			return
+		}
+
+		notificationID, err := strconv.Atoi(mux.Vars(r)["notificationId"])
+		if err != nil {
+			http.Error(w, "Invalid notification ID", http.StatusBadRequest)
+			return
+		}
+
+		var notification models.Notification
+		if err := db.Where("id = ? AND user_id = ?", notificationID, user.ID).First(&notification).Error; err != nil {
+			http.Error(w, "Notification not found", http.StatusNotFound)
+			return
+		}
+
+		if notification.ReadAt == nil {
+			now := time.Now()
+			notification.ReadAt = &now
+			if err := db.Model(&notification).Update("read_at", now).Error; err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		config.SendJSONResponse(w, notificationResponse(notification))
+	}
+}
+
+// MarkAllNotificationsRead - Mark all of the authenticated user's notifications as read
+func MarkAllNotificationsRead(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := requireInteractiveUser(w, r, db)
+		if !ok {
+			return
+		}
+
+		result := db.Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", user.ID).Update("read_at", time.Now())
+		if result.Error != nil {
+			http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		config.SendJSONResponse(w, map[string]interface{}{
+			"marked_read": result.RowsAffected,
+		})
+	}
+}
+
+func wishlistItemResponse(item models.WishlistItem) map[string]interface{} {
+	return map[string]interface{}{
+		"id":         item.ID,
+		"product_id": item.ProductID,
+		"title":      item.Product.Title,
+		"price":      item.Product.Price,
+		"available":  item.Product.Available(),
+		"in_stock":   item.Product.Available() > 0,
+		"created_at": item.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+func notificationResponse(notification models.Notification) map[string]interface{} {
+	return map[string]interface{}{
+		"id":         notification.ID,
+		"type":       notification.Type,
+		"title":      notification.Title,
+		"body":       notification.Body,
+		"product_id": notification.ProductID,
+		"read":       notification.ReadAt != nil,
+		"read_at":    formatOptionalTime(notification.ReadAt),
+		"created_at": notification.CreatedAt.Format(time.RFC3339),
+	}
+}
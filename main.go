@@ -1,45 +1,65 @@
-package main
-
-import (
-	"log"
-	"net/http"
-	"os"
-
-	"github.com/Pijuyy/testing_project4/config"
-	"github.com/Pijuyy/testing_project4/controllers"
-	"github.com/Pijuyy/testing_project4/routes"
-	"github.com/gorilla/mux"
-)
-
-func main() {
-	// Initialize the database connection
-	db, err := config.ConnectDB()
-	if err != nil {
-		log.Fatalf("Error connecting to the database: %v", err)
-	}
-
-	// Create a new router
-	router := mux.NewRouter()
-
-	// Register routes
-	routes.RegisterRoutes(router, db)
-
-	// Initialize admin user
-	controllers.InitializeAdminUser(db)
-
-	// Determine port for HTTP service
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
-
-	// try a lot of
-	// try 2.0 a lot of
-	// try 2.1 a lot of
-
-	// Start the server
-	log.Printf("Starting server on port %s", port)
-	if err := http.ListenAndServe(":"+port, router); err != nil {
-		log.Fatalf("Error starting server: %v", err)
-	}
-}
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/Pijuyy/testing_project4/config"
+	"github.com/Pijuyy/testing_project4/controllers"
+	"github.com/Pijuyy/testing_project4/routes"
+	"github.com/Pijuyy/testing_project4/service"
+	"github.com/Pijuyy/testing_project4/storage"
+	"github.com/gorilla/mux"
+)
+
+func main() {
+	// Initialize the database connection
+	db, err := config.ConnectDB()
+	if err != nil {
+		log.Fatalf("Error connecting to the database: %v", err)
+	}
+
+	// Run a CLI command instead of the server when one is given
+	if len(os.Args) > 1 {
+		if err := runCommand(db, os.Args[1], os.Args[2:]); err != nil {
+			log.Fatalf("Error running %s: %v", os.Args[1], err)
+		}
+		return
+	}
+
+	// Configure where uploaded files are stored
+	store, err := storage.FromEnv()
+	if err != nil {
+		log.Fatalf("Error configuring storage: %v", err)
+	}
+
+	// Create a new router
+	router := mux.NewRouter()
+
+	// Register routes
+	routes.RegisterRoutes(router, db, store)
+
+	// Initialize admin user
+	controllers.InitializeAdminUser(db)
+
+	// Release stock held by expired reservations
+	service.StartReservationSweeper(db, time.Minute)
+
+	// Determine port for HTTP service
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+
+	// try a lot of
+	// try 2.0 a lot of
+	// try 2.1 a lot of
+
+	// Start the server
+	log.Printf("Starting server on port %s", port)
+	if err := http.ListenAndServe(":"+port, router); err != nil {
+		log.Fatalf("Error starting server: %v", err)
+	}
+}
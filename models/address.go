@@ -0,0 +1,78 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Address is a delivery address saved by a user. One of a user's addresses
+// is their default, used at checkout when no address is picked.
+type Address struct {
+	ID            uint   `gorm:"primary_key"`
+	UserID        uint   `gorm:"not null;index"`
+	Label         string `gorm:"not null;default:''"`
+	RecipientName string `gorm:"not null"`
+	Phone         string `gorm:"not null;default:''"`
+	Line1         string `gorm:"not null"`
+	Line2         string `gorm:"not null;default:''"`
+	City          string `gorm:"not null"`
+	Province      string `gorm:"not null;default:''"`
+	PostalCode    string `gorm:"not null"`
+	// CountryCode is the ISO 3166-1 alpha-2 code of the country
+	CountryCode string `gorm:"type:char(2);not null;default:'ID'"`
+	IsDefault   bool   `gorm:"not null;default:false"`
+	Version     uint   `gorm:"not null;default:1"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (a *Address) BeforeCreate(tx *gorm.DB) (err error) {
+	return a.Validate()
+}
+
+// Validate trims the address and checks its required fields.
+func (a *Address) Validate() error {
+	for _, field := range []*string{&a.Label, &a.RecipientName, &a.Phone, &a.Line1, &a.Line2, &a.City, &a.Province, &a.PostalCode} {
+		*field = strings.TrimSpace(*field)
+	}
+	a.CountryCode = strings.ToUpper(strings.TrimSpace(a.CountryCode))
+	if a.CountryCode == "" {
+		a.CountryCode = "ID"
+	}
+
+	switch {
+	case a.RecipientName == "":
+		return errors.New("recipient_name is required")
+	case a.Line1 == "":
+		return errors.New("line1 is required")
+	case a.City == "":
+		return errors.New("city is required")
+	case a.PostalCode == "":
+		return errors.New("postal_code is required")
+	case len(a.CountryCode) != 2:
+		return errors.New("country_code must be a two-letter country code")
+	}
+
+	return nil
+}
+
+// Format writes the address as it is printed on a parcel.
+func (a *Address) Format() string {
+	lines := []string{a.RecipientName}
+	if a.Phone != "" {
+		lines = append(lines, a.Phone)
+	}
+	lines = append(lines, a.Line1)
+	if a.Line2 != "" {
+		lines = append(lines, a.Line2)
+	}
+	city := a.City
+	if a.Province != "" {
+		city += ", " + a.Province
+	}
+	lines = append(lines, city+" "+a.PostalCode, a.CountryCode)
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APIKeyPrefix starts every API key so it can be told apart from a JWT.
+// A full key looks like "tp4_<lookup>_<secret>"; only its hash is stored.
+const APIKeyPrefix = "tp4_"
+
+// Scopes that let an API key reserve stock and buy with, or add to, its
+// owner's balance. They are not permissions of a role; owners can grant them
+// to keys they create themselves.
+const (
+	ScopeOrdersCreate = "orders:create"
+	ScopeWalletWrite  = "wallet:write"
+)
+
+// IsOwnerScope reports whether the scope is one of the owner scopes above.
+func IsOwnerScope(scope string) bool {
+	return scope == ScopeOrdersCreate || scope == ScopeWalletWrite
+}
+
+// APIKey is a long-lived credential for server-to-server integrations.
+type APIKey struct {
+	ID          uint   `gorm:"primary_key"`
+	UserID      uint   `gorm:"not null;index"`
+	CreatedByID uint   `gorm:"not null"`
+	Name        string `gorm:"not null"`
+	Lookup      string `gorm:"not null;unique"`
+	KeyHash     string `gorm:"not null" json:"-"`
+	Scopes      string `gorm:"not null;default:''"`
+	LastUsedAt  *time.Time
+	ExpiresAt   *time.Time
+	RevokedAt   *time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (k *APIKey) BeforeCreate(tx *gorm.DB) (err error) {
+	// Validate name
+	if k.Name == "" {
+		return errors.New("name is required")
+	}
+
+	return
+}
+
+// ScopeList returns the permissions the key is allowed to use. A key without
+// scopes can still read as its owner on endpoints that need no permission,
+// but cannot reserve, buy or top up, and cannot change the owner's account,
+// addresses, reviews, wishlist or notifications.
+func (k *APIKey) ScopeList() []string {
+	return strings.Fields(k.Scopes)
+}
+
+// IsExpired reports whether the key has passed its optional expiry.
+func (k *APIKey) IsExpired(now time.Time) bool {
+	return k.ExpiresAt != nil && now.After(*k.ExpiresAt)
+}
+
+// APIKeyLookup extracts the public lookup part of a full API key.
+func APIKeyLookup(key string) (string, bool) {
+	rest, ok := strings.CutPrefix(key, APIKeyPrefix)
+	if !ok {
+		return "", false
+	}
+
+	lookup, secret, ok := strings.Cut(rest, "_")
+	if !ok || lookup == "" || secret == "" {
+		return "", false
+	}
+
+	return lookup, true
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrAuditLogAppendOnly is returned when something tries to change an audit entry.
+var ErrAuditLogAppendOnly = errors.New("audit log entries cannot be changed or deleted")
+
+// AuditLog records who changed what through the API. Entries are append-only.
+type AuditLog struct {
+	ID         uint   `gorm:"primary_key"`
+	ActorID    *uint  `gorm:"index"`
+	Action     string `gorm:"not null;index"`
+	EntityType string `gorm:"not null;index:idx_audit_logs_entity"`
+	EntityID   string `gorm:"not null;index:idx_audit_logs_entity"`
+	Before     string `gorm:"type:jsonb;not null"`
+	After      string `gorm:"type:jsonb;not null"`
+	Changes    string `gorm:"type:jsonb;not null"`
+	RequestID  string `gorm:"index"`
+	IP         string
+	CreatedAt  time.Time `gorm:"index"`
+}
+
+func (a *AuditLog) BeforeCreate(tx *gorm.DB) (err error) {
+	// Validate action
+	if a.Action == "" {
+		return errors.New("action is required")
+	}
+
+	// Validate entity
+	if a.EntityType == "" || a.EntityID == "" {
+		return errors.New("entity type and ID are required")
+	}
+
+	return
+}
+
+func (a *AuditLog) BeforeUpdate(tx *gorm.DB) (err error) {
+	return ErrAuditLogAppendOnly
+}
+
+func (a *AuditLog) BeforeDelete(tx *gorm.DB) (err error) {
+	return ErrAuditLogAppendOnly
+}
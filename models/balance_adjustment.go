@@ -0,0 +1,53 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// BalanceAdjustment records a manual change to a user's balance made by an admin.
+type BalanceAdjustment struct {
+	ID            uint   `gorm:"primary_key"`
+	UserID        uint   `gorm:"not null;index"`
+	AdminID       uint   `gorm:"not null"`
+	Amount        Money  `gorm:"not null"`
+	BalanceBefore Money  `gorm:"not null"`
+	BalanceAfter  Money  `gorm:"not null"`
+	Reason        string `gorm:"not null"`
+	CreatedAt     time.Time
+
+	// Currency is the currency of the user's wallet at the time
+	Currency string `gorm:"type:char(3);not null;default:'IDR'"`
+}
+
+func (b *BalanceAdjustment) BeforeCreate(tx *gorm.DB) (err error) {
+	// Validate amount
+	if b.Amount.Amount == 0 {
+		return errors.New("amount must not be zero")
+	}
+
+	// Validate currency
+	if b.Currency == "" {
+		b.Currency = b.Amount.Currency
+	}
+	if b.Amount.Currency != b.Currency || b.BalanceAfter.Currency != b.Currency {
+		return ErrCurrencyMismatch
+	}
+
+	// Validate reason
+	if b.Reason == "" {
+		return errors.New("reason is required")
+	}
+
+	return
+}
+
+// AfterFind sets the currency of the amounts, which are stored as amounts only.
+func (b *BalanceAdjustment) AfterFind(tx *gorm.DB) (err error) {
+	b.Amount.Currency = b.Currency
+	b.BalanceBefore.Currency = b.Currency
+	b.BalanceAfter.Currency = b.Currency
+	return
+}
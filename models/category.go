@@ -1,27 +1,40 @@
-package models
-
-import (
-	"errors"
-	"time"
-
-	"gorm.io/gorm"
-)
-
-// Category struct represents a category in the system.
-type Category struct {
-	ID                uint   `gorm:"primary_key"`
-	Type              string `gorm:"not null"`
-	SoldProductAmount int
-	CreatedAt         time.Time
-	UpdatedAt         time.Time
-	Products          []Product `gorm:"foreignKey:CategoryID"`
-}
-
-func (c *Category) BeforeCreate(tx *gorm.DB) (err error) {
-
-	if c.Type == "" {
-		return errors.New("type is required")
-	}
-
-	return
-}
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Category struct represents a category in the system.
+type Category struct {
+	ID                uint   `gorm:"primary_key"`
+	Type              string `gorm:"not null"`
+	SoldProductAmount int
+	Version           uint `gorm:"not null;default:1"`
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	Products          []Product `gorm:"foreignKey:CategoryID"`
+
+	// ParentID is the category this one is nested under, nil for top-level categories
+	ParentID *uint      `gorm:"index"`
+	Children []Category `gorm:"foreignKey:ParentID"`
+
+	// TaxRateID is the tax rate of products in the category and the ones below
+	// it that don't have their own; nil inherits the parent's
+	TaxRateID *uint `gorm:"index"`
+}
+
+func (c *Category) BeforeCreate(tx *gorm.DB) (err error) {
+	return c.Validate()
+}
+
+// Validate checks the category against the rules used when creating it.
+func (c *Category) Validate() error {
+	if c.Type == "" {
+		return errors.New("type is required")
+	}
+
+	return nil
+}
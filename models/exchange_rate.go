@@ -0,0 +1,77 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Exchange rate sources.
+const (
+	ExchangeRateManual = "manual"
+	ExchangeRateImport = "import"
+)
+
+// ExchangeRate is the value of one unit of Currency in the base currency,
+// e.g. 16250 for USD when 1 USD buys Rp16.250. Rates are never updated in
+// place; the latest one for a currency is the current rate.
+type ExchangeRate struct {
+	ID        uint   `gorm:"primary_key"`
+	Currency  string `gorm:"type:char(3);not null;index"`
+	Rate      string `gorm:"type:numeric(24,10);not null"`
+	Source    string `gorm:"not null"`
+	CreatedBy *uint
+	CreatedAt time.Time
+}
+
+func (er *ExchangeRate) BeforeCreate(tx *gorm.DB) (err error) {
+	return er.Validate()
+}
+
+// Validate checks the currency and the rate.
+func (er *ExchangeRate) Validate() error {
+	if !ValidCurrency(er.Currency) {
+		return ErrUnknownCurrency
+	}
+	if er.Currency == DefaultCurrency {
+		return errors.New("the base currency has no exchange rate")
+	}
+
+	rate, ok := er.Ratio()
+	if !ok || rate.Sign() <= 0 {
+		return errors.New("rate must be a positive number")
+	}
+	return nil
+}
+
+// Ratio returns the rate as an exact fraction.
+func (er *ExchangeRate) Ratio() (*big.Rat, bool) {
+	return new(big.Rat).SetString(er.Rate)
+}
+
+// Convert converts an amount in the base currency into the rate's currency,
+// rounding half away from zero to its minor unit.
+func (er *ExchangeRate) Convert(amount Money) (Money, error) {
+	if amount.Currency != DefaultCurrency {
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, amount.Currency, DefaultCurrency)
+	}
+	rate, ok := er.Ratio()
+	if !ok || rate.Sign() <= 0 {
+		return Money{}, errors.New("invalid exchange rate")
+	}
+
+	// amount / 10^base exponent / rate * 10^target exponent
+	converted := new(big.Rat).SetInt64(amount.Amount)
+	converted.Mul(converted, new(big.Rat).SetInt(pow10(currencies[er.Currency].Exponent)))
+	converted.Quo(converted, new(big.Rat).SetInt(pow10(currencies[DefaultCurrency].Exponent)))
+	converted.Quo(converted, rate)
+
+	amountInCurrency, err := roundHalfAway(converted)
+	if err != nil {
+		return Money{}, err
+	}
+	return NewMoney(amountInCurrency, er.Currency), nil
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Inventory movement types.
+const (
+	MovementSale       = "sale"
+	MovementRestock    = "restock"
+	MovementAdjustment = "adjustment"
+	MovementReturn     = "return"
+	MovementCorrection = "correction"
+	MovementTransfer   = "transfer"
+)
+
+// InventoryMovement records a single change to a product's stock at one
+// warehouse. Summing the quantities of a product's movements gives its
+// current stock.
+type InventoryMovement struct {
+	ID            uint   `gorm:"primary_key"`
+	ProductID     uint   `gorm:"not null;index"`
+	WarehouseID   *uint  `gorm:"index"`
+	VariantID     *uint  `gorm:"index"`
+	Type          string `gorm:"not null"`
+	Quantity      int    `gorm:"not null"`
+	StockAfter    int    `gorm:"not null"`
+	Reason        string `gorm:"not null"`
+	ActorID       *uint
+	TransactionID *uint `gorm:"index"`
+	CreatedAt     time.Time
+}
+
+func (m *InventoryMovement) BeforeCreate(tx *gorm.DB) (err error) {
+	return m.Validate()
+}
+
+// Validate checks the movement's quantity, type and reason.
+func (m *InventoryMovement) Validate() error {
+	// Validate quantity
+	if m.Quantity == 0 {
+		return errors.New("quantity must not be zero")
+	}
+
+	// Validate type and direction
+	switch m.Type {
+	case MovementSale:
+		if m.Quantity > 0 {
+			return errors.New("a sale must decrease stock")
+		}
+	case MovementRestock, MovementReturn:
+		if m.Quantity < 0 {
+			return errors.New("a " + m.Type + " must increase stock")
+		}
+	case MovementAdjustment, MovementCorrection, MovementTransfer:
+	default:
+		return errors.New("type must be one of sale, restock, adjustment, return, correction or transfer")
+	}
+
+	// Validate reason
+	if m.Reason == "" {
+		return errors.New("reason is required")
+	}
+
+	return nil
+}
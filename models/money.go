@@ -0,0 +1,310 @@
+package models
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is the base currency the catalogue is priced in, and the
+// currency of amounts that don't specify one.
+const DefaultCurrency = "IDR"
+
+// ErrMoneyOverflow is returned when an amount doesn't fit in 64 bits.
+var ErrMoneyOverflow = errors.New("amount is too large")
+
+// ErrCurrencyMismatch is returned when amounts in different currencies are combined.
+var ErrCurrencyMismatch = errors.New("amounts are in different currencies")
+
+// ErrUnknownCurrency is returned for currency codes that are not supported.
+var ErrUnknownCurrency = errors.New("unknown currency")
+
+// currency describes how amounts in an ISO 4217 currency are written.
+type currency struct {
+	// Exponent is the number of minor unit digits. The rupiah has no
+	// subunit in circulation, so IDR amounts are whole rupiah.
+	Exponent int
+	Symbol   string
+	Locale   string
+}
+
+var currencies = map[string]currency{
+	"IDR": {Exponent: 0, Symbol: "Rp", Locale: "id"},
+	"USD": {Exponent: 2, Symbol: "$", Locale: "en"},
+	"EUR": {Exponent: 2, Symbol: "€", Locale: "de"},
+	"GBP": {Exponent: 2, Symbol: "£", Locale: "en"},
+	"SGD": {Exponent: 2, Symbol: "S$", Locale: "en"},
+	"MYR": {Exponent: 2, Symbol: "RM", Locale: "en"},
+	"AUD": {Exponent: 2, Symbol: "A$", Locale: "en"},
+	"JPY": {Exponent: 0, Symbol: "¥", Locale: "en"},
+}
+
+// numberFormat holds a locale's separators.
+type numberFormat struct {
+	Group       string
+	Decimal     string
+	SymbolAfter bool
+}
+
+var numberFormats = map[string]numberFormat{
+	"id": {Group: ".", Decimal: ",", SymbolAfter: false},
+	"en": {Group: ",", Decimal: ".", SymbolAfter: false},
+	"de": {Group: ".", Decimal: ",", SymbolAfter: true},
+}
+
+// ValidCurrency reports whether the currency code is supported.
+func ValidCurrency(code string) bool {
+	_, ok := currencies[code]
+	return ok
+}
+
+// Money is an amount in the minor units of a currency, e.g. cents for USD.
+// In the database it is stored as a bigint amount in the default currency;
+// models holding amounts in other currencies keep the currency in a column
+// of their own and set it after loading.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+// NewMoney returns the amount in minor units of the currency.
+func NewMoney(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// Rupiah returns the amount in the default currency.
+func Rupiah(amount int64) Money {
+	return Money{Amount: amount, Currency: DefaultCurrency}
+}
+
+// IsNegative reports whether the amount is below zero.
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+// Add returns the sum of both amounts, which must be in the same currency.
+// A zero Money has no currency and adds to amounts in any currency.
+func (m Money) Add(other Money) (Money, error) {
+	if other == (Money{}) {
+		return m, nil
+	}
+	if m == (Money{}) {
+		return other, nil
+	}
+	if err := m.sameCurrency(other); err != nil {
+		return Money{}, err
+	}
+	sum := m.Amount + other.Amount
+	if other.Amount > 0 && sum < m.Amount || other.Amount < 0 && sum > m.Amount {
+		return Money{}, ErrMoneyOverflow
+	}
+	return Money{Amount: sum, Currency: m.Currency}, nil
+}
+
+// Sub returns the difference of both amounts, which must be in the same currency.
+func (m Money) Sub(other Money) (Money, error) {
+	if other.Amount == math.MinInt64 {
+		return Money{}, ErrMoneyOverflow
+	}
+	return m.Add(Money{Amount: -other.Amount, Currency: other.Currency})
+}
+
+// Mul returns the amount multiplied by n, e.g. a unit price by a quantity.
+func (m Money) Mul(n int64) (Money, error) {
+	if m.Amount == 0 || n == 0 {
+		return Money{Currency: m.Currency}, nil
+	}
+	product := m.Amount * n
+	if product/n != m.Amount || m.Amount == -1 && n == math.MinInt64 || n == -1 && m.Amount == math.MinInt64 {
+		return Money{}, ErrMoneyOverflow
+	}
+	return Money{Amount: product, Currency: m.Currency}, nil
+}
+
+// Percent returns percent percent of the amount, rounded down.
+func (m Money) Percent(percent int64) (Money, error) {
+	scaled, err := m.Mul(percent)
+	if err != nil {
+		return Money{}, err
+	}
+	scaled.Amount /= 100
+	return scaled, nil
+}
+
+func (m Money) sameCurrency(other Money) error {
+	if m.Currency != other.Currency {
+		return fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, other.Currency)
+	}
+	return nil
+}
+
+// Format writes the amount for the locale, e.g. "Rp12.500" for id or
+// "$1,250.00" for en. Locales are matched on their language; when the
+// locale is unknown or empty the currency's own locale is used.
+func (m Money) Format(locale string) string {
+	c, ok := currencies[m.Currency]
+	if !ok {
+		c = currency{Symbol: m.Currency + " ", Locale: "en"}
+	}
+	format, ok := numberFormats[language(locale)]
+	if !ok {
+		format = numberFormats[c.Locale]
+	}
+
+	// Work on the absolute value as unsigned so the smallest int64 is exact
+	abs := uint64(m.Amount)
+	if m.Amount < 0 {
+		abs = -abs
+	}
+	divisor := uint64(1)
+	for i := 0; i < c.Exponent; i++ {
+		divisor *= 10
+	}
+
+	digits := groupDigits(strconv.FormatUint(abs/divisor, 10), format.Group)
+	if c.Exponent > 0 {
+		digits += format.Decimal + fmt.Sprintf("%0*d", c.Exponent, abs%divisor)
+	}
+
+	formatted := c.Symbol + digits
+	if format.SymbolAfter {
+		formatted = digits + " " + strings.TrimSpace(c.Symbol)
+	}
+	if m.Amount < 0 {
+		formatted = "-" + formatted
+	}
+	return formatted
+}
+
+// String formats the amount in the currency's own locale.
+func (m Money) String() string {
+	return m.Format("")
+}
+
+// MarshalJSON writes the amount as an object with its currency and the
+// formatted amount, so every amount in the API has the same shape.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Amount    int64  `json:"amount"`
+		Currency  string `json:"currency"`
+		Formatted string `json:"formatted"`
+	}{m.Amount, m.Currency, m.String()})
+}
+
+// UnmarshalJSON accepts either an object with an amount and a currency, or
+// a plain number of minor units. A plain number leaves the currency empty;
+// it is in whatever currency the amount is kept in.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if string(data) == "null" {
+		return nil
+	}
+
+	if len(data) > 0 && data[0] != '{' {
+		var amount int64
+		if err := json.Unmarshal(data, &amount); err != nil {
+			return errors.New("amounts must be whole numbers of minor units")
+		}
+		*m = Money{Amount: amount}
+		return nil
+	}
+
+	var value struct {
+		Amount   int64  `json:"amount"`
+		Currency string `json:"currency"`
+	}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return errors.New("amounts must be whole numbers of minor units")
+	}
+	code := strings.ToUpper(strings.TrimSpace(value.Currency))
+	if code == "" {
+		code = DefaultCurrency
+	}
+	if !ValidCurrency(code) {
+		return fmt.Errorf("%w: %s", ErrUnknownCurrency, value.Currency)
+	}
+	*m = NewMoney(value.Amount, code)
+	return nil
+}
+
+// Scan reads an amount stored in the database.
+func (m *Money) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*m = Rupiah(0)
+	case int64:
+		*m = Rupiah(v)
+	case []byte:
+		return m.Scan(string(v))
+	case string:
+		amount, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return err
+		}
+		*m = Rupiah(amount)
+	default:
+		return fmt.Errorf("cannot scan %T into Money", value)
+	}
+	return nil
+}
+
+// Value stores the amount in minor units.
+func (m Money) Value() (driver.Value, error) {
+	return m.Amount, nil
+}
+
+// checkCurrency checks that the amount is in the currency it is stored in.
+// Amounts without a currency are taken to be in it.
+func checkCurrency(field string, m *Money, currency string) error {
+	if m.Currency == "" {
+		m.Currency = currency
+	}
+	if m.Currency != currency {
+		return fmt.Errorf("%s must be in %s", field, currency)
+	}
+	return nil
+}
+
+// roundHalfAway rounds the fraction to a whole amount, rounding halves away
+// from zero.
+func roundHalfAway(value *big.Rat) (int64, error) {
+	quotient, remainder := new(big.Int).QuoRem(value.Num(), value.Denom(), new(big.Int))
+	if new(big.Int).Mul(new(big.Int).Abs(remainder), big.NewInt(2)).Cmp(value.Denom()) >= 0 {
+		quotient.Add(quotient, big.NewInt(int64(remainder.Sign())))
+	}
+	if !quotient.IsInt64() {
+		return 0, ErrMoneyOverflow
+	}
+	return quotient.Int64(), nil
+}
+
+func pow10(exponent int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exponent)), nil)
+}
+
+// language returns the language of a locale such as "id-ID" or "en_US".
+func language(locale string) string {
+	locale = strings.ToLower(strings.TrimSpace(locale))
+	if i := strings.IndexAny(locale, "-_"); i >= 0 {
+		locale = locale[:i]
+	}
+	return locale
+}
+
+// groupDigits separates the digits into groups of three.
+func groupDigits(digits, separator string) string {
+	var b strings.Builder
+	for i, digit := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteString(separator)
+		}
+		b.WriteRune(digit)
+	}
+	return b.String()
+}
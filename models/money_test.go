@@ -0,0 +1,60 @@
+package models
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestMoneyOverflow(t *testing.T) {
+	largest, smallest := Rupiah(math.MaxInt64), Rupiah(math.MinInt64)
+	tests := []struct {
+		name string
+		op   func() (Money, error)
+		want int64
+		err  error
+	}{
+		{"add", func() (Money, error) { return Rupiah(2).Add(Rupiah(3)) }, 5, nil},
+		{"add to max", func() (Money, error) { return largest.Add(Rupiah(1)) }, 0, ErrMoneyOverflow},
+		{"add to min", func() (Money, error) { return smallest.Add(Rupiah(-1)) }, 0, ErrMoneyOverflow},
+		{"add up to max", func() (Money, error) { return Rupiah(math.MaxInt64 - 1).Add(Rupiah(1)) }, math.MaxInt64, nil},
+		{"sub", func() (Money, error) { return Rupiah(2).Sub(Rupiah(3)) }, -1, nil},
+		{"sub min", func() (Money, error) { return Rupiah(0).Sub(smallest) }, 0, ErrMoneyOverflow},
+		{"sub from min", func() (Money, error) { return smallest.Sub(Rupiah(1)) }, 0, ErrMoneyOverflow},
+		{"mul", func() (Money, error) { return Rupiah(25000).Mul(3) }, 75000, nil},
+		{"mul by zero", func() (Money, error) { return largest.Mul(0) }, 0, nil},
+		{"mul past max", func() (Money, error) { return Rupiah(math.MaxInt64/2 + 1).Mul(2) }, 0, ErrMoneyOverflow},
+		{"mul min by -1", func() (Money, error) { return smallest.Mul(-1) }, 0, ErrMoneyOverflow},
+		{"mul -1 by min", func() (Money, error) { return Rupiah(-1).Mul(math.MinInt64) }, 0, ErrMoneyOverflow},
+		{"percent", func() (Money, error) { return Rupiah(999).Percent(10) }, 99, nil},
+		{"percent past max", func() (Money, error) { return largest.Percent(50) }, 0, ErrMoneyOverflow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.op()
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error = %v, want %v", err, tt.err)
+			}
+			if err == nil && got != Rupiah(tt.want) {
+				t.Errorf("got %+v, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyCurrencyMismatch(t *testing.T) {
+	if _, err := Rupiah(1).Add(NewMoney(1, "USD")); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Add error = %v, want ErrCurrencyMismatch", err)
+	}
+	// A zero Money has no currency and adds to any amount
+	if got, err := (Money{}).Add(NewMoney(150, "USD")); err != nil || got != NewMoney(150, "USD") {
+		t.Errorf("Add = %+v, %v", got, err)
+	}
+}
+
+func TestMoneyFormatMinInt64(t *testing.T) {
+	if got, want := Rupiah(math.MinInt64).Format("id"), "-Rp9.223.372.036.854.775.808"; got != want {
+		t.Errorf("Format = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Notification types.
+const (
+	NotificationBackInStock = "back_in_stock"
+)
+
+// Notification is a message in a user's in-app inbox.
+type Notification struct {
+	ID        uint   `gorm:"primary_key"`
+	UserID    uint   `gorm:"not null;index"`
+	Type      string `gorm:"not null"`
+	Title     string `gorm:"not null"`
+	Body      string `gorm:"not null;default:''"`
+	ProductID *uint
+	ReadAt    *time.Time
+	CreatedAt time.Time
+}
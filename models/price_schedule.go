@@ -0,0 +1,88 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PriceSchedule is a sale price for a product during a time window, such as
+// a flash sale. It applies automatically between StartsAt and EndsAt until
+// QuantityCap items have been sold at the sale price. Variants with their own
+// price are not affected.
+type PriceSchedule struct {
+	ID           uint      `gorm:"primary_key"`
+	ProductID    uint      `gorm:"not null;index"`
+	Name         string    `gorm:"not null;default:''"`
+	SalePrice    Money     `gorm:"not null"`
+	StartsAt     time.Time `gorm:"not null"`
+	EndsAt       time.Time `gorm:"not null"`
+	QuantityCap  *int
+	SoldQuantity int  `gorm:"not null;default:0"`
+	Active       bool `gorm:"not null;default:true"`
+	CreatedBy    *uint
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+func (ps *PriceSchedule) BeforeCreate(tx *gorm.DB) (err error) {
+	return ps.Validate()
+}
+
+// Validate checks the schedule's settings.
+func (ps *PriceSchedule) Validate() error {
+	if err := checkCurrency("sale_price", &ps.SalePrice, DefaultCurrency); err != nil {
+		return err
+	}
+	if ps.SalePrice.Amount < 0 || ps.SalePrice.Amount > 50000000 {
+		return errors.New("sale_price must be between 0 and 50,000,000")
+	}
+
+	if ps.StartsAt.IsZero() || ps.EndsAt.IsZero() {
+		return errors.New("starts_at and ends_at are required")
+	}
+
+	if !ps.EndsAt.After(ps.StartsAt) {
+		return errors.New("ends_at must be after starts_at")
+	}
+
+	if ps.QuantityCap != nil && *ps.QuantityCap < 1 {
+		return errors.New("quantity_cap must be greater than 0")
+	}
+
+	return nil
+}
+
+// Remaining returns how many items can still be sold at the sale price, or
+// nil when the sale has no cap.
+func (ps *PriceSchedule) Remaining() *int {
+	if ps.QuantityCap == nil {
+		return nil
+	}
+	remaining := max(*ps.QuantityCap-ps.SoldQuantity, 0)
+	return &remaining
+}
+
+// Price change sources.
+const (
+	PriceChangeManual            = "manual"
+	PriceChangeImport            = "import"
+	PriceChangeScheduleCreated   = "schedule_created"
+	PriceChangeScheduleCancelled = "schedule_cancelled"
+)
+
+// PriceChange is an entry in a product's price history. Scheduled prices are
+// recorded when they are created or cancelled, with their window.
+type PriceChange struct {
+	ID              uint   `gorm:"primary_key"`
+	ProductID       uint   `gorm:"not null;index"`
+	Source          string `gorm:"not null"`
+	OldPrice        Money  `gorm:"not null"`
+	NewPrice        Money  `gorm:"not null"`
+	PriceScheduleID *uint
+	EffectiveFrom   *time.Time
+	EffectiveUntil  *time.Time
+	ActorID         *uint
+	CreatedAt       time.Time
+}
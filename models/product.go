@@ -1,37 +1,99 @@
-package models
-
-import (
-	"errors"
-	"gorm.io/gorm"
-	"time"
-)
-
-type Product struct {
-	ID         uint   `gorm:"primary_key"`
-	Title      string `gorm:"not null"`
-	Price      int    `gorm:"not null"`
-	Stock      int    `gorm:"not null"`
-	CategoryID uint
-	Category   Category `gorm:"foreignKey:CategoryID"`
-	CreatedAt  time.Time
-	UpdatedAt  time.Time
-}
-
-func (p *Product) BeforeCreate(tx *gorm.DB) (err error) {
-	// Validate title
-	if p.Title == "" {
-		return errors.New("title is required")
-	}
-
-	// Validate stock
-	if p.Stock < 5 {
-		return errors.New("stock must be at least 5")
-	}
-
-	// Validate price
-	if p.Price < 0 || p.Price > 50000000 {
-		return errors.New("price must be between 0 and 50,000,000")
-	}
-
-	return
-}
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Product struct {
+	ID         uint   `gorm:"primary_key"`
+	Title      string `gorm:"not null"`
+	Price      Money  `gorm:"not null"`
+	Stock      int    `gorm:"not null"`
+	CategoryID uint
+	Category   Category `gorm:"foreignKey:CategoryID"`
+	Version    uint     `gorm:"not null;default:1"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+
+	// LowStockThreshold is the stock level at or below which an alert is raised
+	LowStockThreshold int `gorm:"not null;default:5"`
+
+	// Reserved is the quantity held by active reservations
+	Reserved int `gorm:"not null;default:0"`
+
+	// SKU is the optional stock keeping unit used to identify the product in imports
+	SKU *string `gorm:"uniqueIndex"`
+
+	// Variants are the purchasable versions of the product. A product with
+	// variants is bought through one of them; its Stock includes theirs.
+	Variants []ProductVariant `gorm:"foreignKey:ProductID"`
+
+	// Images are the product's pictures, ordered by position
+	Images []ProductImage `gorm:"foreignKey:ProductID"`
+
+	// Description is searched along with the title
+	Description string `gorm:"not null;default:''"`
+
+	// RatingAverage and RatingCount summarise the visible reviews
+	RatingAverage float64 `gorm:"not null;default:0"`
+	RatingCount   int     `gorm:"not null;default:0"`
+
+	// WeightGrams is the shipping weight of one item
+	WeightGrams int `gorm:"not null;default:0"`
+}
+
+// NormalizeSKU trims a SKU, returning nil when it is empty.
+func NormalizeSKU(sku string) *string {
+	sku = strings.TrimSpace(sku)
+	if sku == "" {
+		return nil
+	}
+	return &sku
+}
+
+// Available returns the stock that is not held by reservations.
+func (p *Product) Available() int {
+	return max(p.Stock-p.Reserved, 0)
+}
+
+func (p *Product) BeforeCreate(tx *gorm.DB) (err error) {
+	// Validate stock. Afterwards stock only changes through inventory
+	// movements, so this is checked on creation only.
+	if p.Stock < 5 {
+		return errors.New("stock must be at least 5")
+	}
+
+	return p.Validate()
+}
+
+// Validate checks the editable fields of the product.
+func (p *Product) Validate() error {
+	// Validate title
+	if p.Title == "" {
+		return errors.New("title is required")
+	}
+
+	// Validate price
+	if err := checkCurrency("price", &p.Price, DefaultCurrency); err != nil {
+		return err
+	}
+	if p.Price.Amount < 0 || p.Price.Amount > 50000000 {
+		return errors.New("price must be between 0 and 50,000,000")
+	}
+
+	// Validate weight
+	if p.WeightGrams < 0 || p.WeightGrams > 1000000 {
+		return errors.New("weight_grams must be between 0 and 1,000,000")
+	}
+
+	// Validate low stock threshold
+	if p.LowStockThreshold < 0 {
+		return errors.New("low_stock_threshold must not be negative")
+	}
+
+	return nil
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// ProductImage is an uploaded picture of a product. The files themselves are
+// kept in storage under Key and ThumbnailKey.
+type ProductImage struct {
+	ID           uint   `gorm:"primary_key"`
+	ProductID    uint   `gorm:"not null;index"`
+	Key          string `gorm:"not null"`
+	ThumbnailKey string `gorm:"not null"`
+	ContentType  string `gorm:"not null"`
+	Size         int    `gorm:"not null"`
+	Width        int    `gorm:"not null"`
+	Height       int    `gorm:"not null"`
+	// Position orders the images of a product, starting at 1
+	Position int `gorm:"not null"`
+	// IsPrimary marks the image shown first in the catalogue
+	IsPrimary bool `gorm:"not null;default:false"`
+	CreatedAt time.Time
+}
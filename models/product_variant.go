@@ -0,0 +1,96 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ProductVariant is a purchasable version of a product, e.g. a t-shirt in one
+// size and color. Variants keep their own SKU, price, weight and stock; their
+// stock and sales roll up to the parent product.
+type ProductVariant struct {
+	ID        uint   `gorm:"primary_key"`
+	ProductID uint   `gorm:"not null;index"`
+	SKU       string `gorm:"not null;unique"`
+	// Options holds the variant's attributes as a JSON object, e.g. {"size": "M"}
+	Options       string `gorm:"type:jsonb;not null;default:'{}'"`
+	PriceOverride *Money
+	// WeightGramsOverride is the shipping weight of one item when it differs
+	// from the product's
+	WeightGramsOverride *int
+	Stock               int  `gorm:"not null;default:0"`
+	Reserved            int  `gorm:"not null;default:0"`
+	Version             uint `gorm:"not null;default:1"`
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+}
+
+func (v *ProductVariant) BeforeCreate(tx *gorm.DB) (err error) {
+	return v.Validate()
+}
+
+// Validate checks the editable fields of the variant.
+func (v *ProductVariant) Validate() error {
+	// Validate SKU
+	if v.SKU == "" {
+		return errors.New("sku is required")
+	}
+
+	// Validate price override
+	if v.PriceOverride != nil {
+		if err := checkCurrency("price_override", v.PriceOverride, DefaultCurrency); err != nil {
+			return err
+		}
+	}
+	if v.PriceOverride != nil && (v.PriceOverride.Amount < 0 || v.PriceOverride.Amount > 50000000) {
+		return errors.New("price_override must be between 0 and 50,000,000")
+	}
+
+	// Validate weight override
+	if v.WeightGramsOverride != nil && (*v.WeightGramsOverride < 0 || *v.WeightGramsOverride > 1000000) {
+		return errors.New("weight_grams_override must be between 0 and 1,000,000")
+	}
+
+	return nil
+}
+
+// OptionMap returns the variant's options.
+func (v *ProductVariant) OptionMap() map[string]string {
+	options := map[string]string{}
+	json.Unmarshal([]byte(v.Options), &options)
+	return options
+}
+
+// SetOptions stores the variant's options.
+func (v *ProductVariant) SetOptions(options map[string]string) {
+	if options == nil {
+		options = map[string]string{}
+	}
+	data, _ := json.Marshal(options)
+	v.Options = string(data)
+}
+
+// Price returns the variant's price, falling back to the product's.
+func (v *ProductVariant) Price(product Product) Money {
+	if v.PriceOverride != nil {
+		return *v.PriceOverride
+	}
+	return product.Price
+}
+
+// WeightGrams returns the shipping weight of one item of the variant, falling
+// back to the product's.
+func (v *ProductVariant) WeightGrams(product Product) int {
+	if v.WeightGramsOverride != nil {
+		return *v.WeightGramsOverride
+	}
+	return product.WeightGrams
+}
+
+// Available returns the variant's stock that is not held by reservations.
+func (v *ProductVariant) Available() int {
+	return max(v.Stock-v.Reserved, 0)
+}
@@ -0,0 +1,108 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Promotion types.
+const (
+	// PromotionPercentage takes Value percent off the subtotal.
+	PromotionPercentage = "percentage"
+	// PromotionFixed takes Value off the subtotal.
+	PromotionFixed = "fixed"
+)
+
+// Promotion is a promo code customers can apply to a purchase. Optional
+// restrictions are left nil when they don't apply.
+type Promotion struct {
+	ID          uint   `gorm:"primary_key"`
+	Code        string `gorm:"not null;uniqueIndex"`
+	Description string `gorm:"not null;default:''"`
+	Type        string `gorm:"not null"`
+	Value       int    `gorm:"not null"`
+	// MinSpend is the subtotal a purchase needs for the code to apply
+	MinSpend Money `gorm:"not null;default:0"`
+	// CategoryID limits the code to products in the category or below it
+	CategoryID *uint
+	// ProductID limits the code to one product
+	ProductID *uint
+	StartsAt  *time.Time
+	EndsAt    *time.Time
+	// UsageLimit caps the redemptions of the code by all users
+	UsageLimit *int
+	// PerUserLimit caps the redemptions of the code by each user
+	PerUserLimit *int
+	UsedCount    int  `gorm:"not null;default:0"`
+	Active       bool `gorm:"not null;default:true"`
+	Version      uint `gorm:"not null;default:1"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+func (p *Promotion) BeforeCreate(tx *gorm.DB) (err error) {
+	return p.Validate()
+}
+
+// Validate checks the promotion's settings.
+func (p *Promotion) Validate() error {
+	if p.Code == "" {
+		return errors.New("code is required")
+	}
+
+	switch p.Type {
+	case PromotionPercentage:
+		if p.Value < 1 || p.Value > 100 {
+			return errors.New("value must be between 1 and 100 for percentage promotions")
+		}
+	case PromotionFixed:
+		if p.Value < 1 {
+			return errors.New("value must be greater than 0")
+		}
+	default:
+		return errors.New("type must be percentage or fixed")
+	}
+
+	if err := checkCurrency("min_spend", &p.MinSpend, DefaultCurrency); err != nil {
+		return err
+	}
+	if p.MinSpend.IsNegative() {
+		return errors.New("min_spend must not be negative")
+	}
+
+	if p.StartsAt != nil && p.EndsAt != nil && !p.EndsAt.After(*p.StartsAt) {
+		return errors.New("ends_at must be after starts_at")
+	}
+
+	if p.UsageLimit != nil && *p.UsageLimit < 1 || p.PerUserLimit != nil && *p.PerUserLimit < 1 {
+		return errors.New("usage limits must be greater than 0")
+	}
+
+	return nil
+}
+
+// Discount returns the amount taken off the subtotal, which never exceeds it.
+// Fixed values are in minor units of the subtotal's currency.
+func (p *Promotion) Discount(subtotal Money) (Money, error) {
+	discount := NewMoney(int64(p.Value), subtotal.Currency)
+	if p.Type == PromotionPercentage {
+		var err error
+		if discount, err = subtotal.Percent(int64(p.Value)); err != nil {
+			return Money{}, err
+		}
+	}
+	discount.Amount = min(discount.Amount, subtotal.Amount)
+	return discount, nil
+}
+
+// PromotionRedemption records a promo code applied to a transaction.
+type PromotionRedemption struct {
+	ID            uint  `gorm:"primary_key"`
+	PromotionID   uint  `gorm:"not null;index"`
+	UserID        uint  `gorm:"not null;index"`
+	TransactionID uint  `gorm:"not null"`
+	Discount      Money `gorm:"not null"`
+	CreatedAt     time.Time
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Reservation statuses.
+const (
+	ReservationActive    = "active"
+	ReservationConverted = "converted"
+	ReservationReleased  = "released"
+	ReservationExpired   = "expired"
+)
+
+// Reservation holds stock of a product for a user while they check out. Active
+// reservations count against the product's availability until they are
+// converted into a sale, released or expire.
+type Reservation struct {
+	ID            uint      `gorm:"primary_key"`
+	UserID        uint      `gorm:"not null;index"`
+	ProductID     uint      `gorm:"not null;index"`
+	Quantity      int       `gorm:"not null"`
+	Status        string    `gorm:"not null;default:'active';index"`
+	ExpiresAt     time.Time `gorm:"not null;index"`
+	VariantID     *uint
+	TransactionID *uint
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+func (res *Reservation) BeforeCreate(tx *gorm.DB) (err error) {
+	// Validate quantity
+	if res.Quantity <= 0 {
+		return errors.New("quantity is required and must be greater than 0")
+	}
+
+	return
+}
+
+// IsExpired reports whether the reservation's hold has run out.
+func (res *Reservation) IsExpired() bool {
+	return !res.ExpiresAt.After(time.Now())
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Review is a customer's rating of a product they bought. Each user reviews a
+// product at most once. Hidden reviews are kept but left out of listings and
+// of the product's rating.
+type Review struct {
+	ID           uint   `gorm:"primary_key"`
+	ProductID    uint   `gorm:"not null;uniqueIndex:idx_review_product_user"`
+	UserID       uint   `gorm:"not null;uniqueIndex:idx_review_product_user"`
+	Rating       int    `gorm:"not null"`
+	Title        string `gorm:"not null;default:''"`
+	Body         string `gorm:"not null;default:''"`
+	Hidden       bool   `gorm:"not null;default:false"`
+	HiddenReason string `gorm:"not null;default:''"`
+	HiddenBy     *uint
+	HiddenAt     *time.Time
+	Version      uint `gorm:"not null;default:1"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+func (rv *Review) BeforeCreate(tx *gorm.DB) (err error) {
+	return rv.Validate()
+}
+
+// Validate checks the fields written by the reviewer.
+func (rv *Review) Validate() error {
+	if rv.Rating < 1 || rv.Rating > 5 {
+		return errors.New("rating must be between 1 and 5")
+	}
+
+	if len(rv.Title) > 200 {
+		return errors.New("title must not be longer than 200 characters")
+	}
+
+	if len(rv.Body) > 5000 {
+		return errors.New("body must not be longer than 5000 characters")
+	}
+
+	return nil
+}
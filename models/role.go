@@ -0,0 +1,118 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Permissions checked by the API. Roles are granted a set of these.
+const (
+	PermCatalogRead     = "catalog:read"
+	PermCatalogWrite    = "catalog:write"
+	PermOrdersReadAll   = "orders:read_all"
+	PermUsersRead       = "users:read"
+	PermUsersManage     = "users:manage"
+	PermBalancesAdjust  = "balances:adjust"
+	PermReportsRead     = "reports:read"
+	PermRolesManage     = "roles:manage"
+	PermAuditRead       = "audit:read"
+	PermInventoryRead   = "inventory:read"
+	PermInventoryAdjust = "inventory:adjust"
+	PermReviewsModerate = "reviews:moderate"
+
+	PermPromotionsManage    = "promotions:manage"
+	PermExchangeRatesManage = "exchange_rates:manage"
+	PermTaxesManage         = "taxes:manage"
+)
+
+// Built-in roles. They are seeded on startup and can be edited afterwards,
+// except for the super admin which always holds every permission.
+const (
+	RoleSuperAdmin       = "super_admin"
+	RoleAdmin            = "admin"
+	RoleInventoryManager = "inventory_manager"
+	RoleSupportAgent     = "support_agent"
+	RoleFinance          = "finance"
+	RoleCustomer         = "customer"
+)
+
+// Permissions lists every known permission with a short description.
+var Permissions = []Permission{
+	{Name: PermCatalogRead, Description: "View products and categories"},
+	{Name: PermCatalogWrite, Description: "Create, update and delete products and categories"},
+	{Name: PermOrdersReadAll, Description: "View transactions of all users"},
+	{Name: PermUsersRead, Description: "List and view user accounts"},
+	{Name: PermUsersManage, Description: "Change roles and suspend or reactivate users"},
+	{Name: PermBalancesAdjust, Description: "Manually adjust user balances"},
+	{Name: PermReportsRead, Description: "View sales and inventory reports"},
+	{Name: PermRolesManage, Description: "Create and edit roles and their permissions"},
+	{Name: PermAuditRead, Description: "Query the audit log"},
+	{Name: PermInventoryRead, Description: "View inventory movements of products"},
+	{Name: PermInventoryAdjust, Description: "Restock, return and correct product stock"},
+	{Name: PermReviewsModerate, Description: "Hide and unhide product reviews"},
+	{Name: PermPromotionsManage, Description: "Create and edit promo codes"},
+	{Name: PermExchangeRatesManage, Description: "Set and import currency exchange rates"},
+	{Name: PermTaxesManage, Description: "Manage tax rates and the rates of categories"},
+}
+
+// DefaultRolePermissions maps the built-in roles to the permissions they are
+// seeded with. Permissions added in later releases are granted to the roles
+// listed here the first time they are seeded.
+var DefaultRolePermissions = map[string][]string{
+	RoleAdmin: {
+		PermCatalogRead, PermCatalogWrite, PermOrdersReadAll, PermUsersRead,
+		PermUsersManage, PermBalancesAdjust, PermReportsRead, PermAuditRead,
+		PermInventoryRead, PermInventoryAdjust, PermReviewsModerate, PermPromotionsManage,
+		PermExchangeRatesManage, PermTaxesManage,
+	},
+	RoleInventoryManager: {PermCatalogRead, PermCatalogWrite, PermInventoryRead, PermInventoryAdjust},
+	RoleSupportAgent:     {PermCatalogRead, PermOrdersReadAll, PermUsersRead, PermReviewsModerate},
+	RoleFinance:          {PermOrdersReadAll, PermUsersRead, PermBalancesAdjust, PermReportsRead, PermAuditRead, PermInventoryRead, PermExchangeRatesManage, PermTaxesManage},
+	RoleCustomer:         {PermCatalogRead},
+}
+
+type Permission struct {
+	ID          uint   `gorm:"primary_key"`
+	Name        string `gorm:"not null;unique"`
+	Description string
+}
+
+type Role struct {
+	ID          uint   `gorm:"primary_key"`
+	Name        string `gorm:"not null;unique"`
+	Description string
+	Permissions []Permission `gorm:"many2many:role_permissions"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (r *Role) BeforeCreate(tx *gorm.DB) (err error) {
+	// Validate name
+	if r.Name == "" {
+		return errors.New("name is required")
+	}
+
+	return
+}
+
+// HasPermission reports whether the role grants the given permission.
+// Permissions must be preloaded.
+func (r *Role) HasPermission(name string) bool {
+	for _, permission := range r.Permissions {
+		if permission.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// PermissionNames returns the names of the role's preloaded permissions.
+func (r *Role) PermissionNames() []string {
+	names := make([]string, 0, len(r.Permissions))
+	for _, permission := range r.Permissions {
+		names = append(names, permission.Name)
+	}
+	return names
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Stock alert types.
+const (
+	StockAlertLowStock   = "low_stock"
+	StockAlertOutOfStock = "out_of_stock"
+)
+
+// StockAlert is raised when a product's stock drops to or below its low-stock
+// threshold, or runs out entirely.
+type StockAlert struct {
+	ID            uint   `gorm:"primary_key"`
+	ProductID     uint   `gorm:"not null;index"`
+	ProductTitle  string `gorm:"not null"`
+	Type          string `gorm:"not null"`
+	Stock         int    `gorm:"not null"`
+	Threshold     int    `gorm:"not null"`
+	MovementID    uint   `gorm:"not null"`
+	TransactionID *uint
+	CreatedAt     time.Time
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TaxRate is a sales tax such as PPN. Products are taxed at the rate of their
+// category, or of its nearest ancestor that has one, and otherwise at the
+// default rate. A rate of zero makes a category exempt.
+type TaxRate struct {
+	ID   uint   `gorm:"primary_key"`
+	Name string `gorm:"not null;uniqueIndex"`
+	// BasisPoints is the rate in hundredths of a percent, e.g. 1100 for 11%
+	BasisPoints int  `gorm:"not null"`
+	IsDefault   bool `gorm:"not null;default:false"`
+	Version     uint `gorm:"not null;default:1"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (t *TaxRate) BeforeCreate(tx *gorm.DB) (err error) {
+	return t.Validate()
+}
+
+// Validate checks the tax rate's settings.
+func (t *TaxRate) Validate() error {
+	t.Name = strings.TrimSpace(t.Name)
+	if t.Name == "" {
+		return errors.New("name is required")
+	}
+
+	if t.BasisPoints < 0 || t.BasisPoints > 10000 {
+		return errors.New("basis_points must be between 0 and 10,000")
+	}
+
+	return nil
+}
+
+// Tax returns the tax on the amount, rounded half away from zero to the
+// minor unit. The amount includes the tax, unless exclusive is set, in
+// which case the tax comes on top of it.
+func (t *TaxRate) Tax(amount Money, exclusive bool) (Money, error) {
+	tax := new(big.Rat).SetInt64(amount.Amount)
+	if exclusive {
+		tax.Mul(tax, big.NewRat(int64(t.BasisPoints), 10000))
+	} else {
+		tax.Mul(tax, big.NewRat(int64(t.BasisPoints), int64(10000+t.BasisPoints)))
+	}
+
+	taxAmount, err := roundHalfAway(tax)
+	if err != nil {
+		return Money{}, err
+	}
+	return NewMoney(taxAmount, amount.Currency), nil
+}
@@ -0,0 +1,39 @@
+package models
+
+import "testing"
+
+func TestTaxRateTax(t *testing.T) {
+	tests := []struct {
+		name        string
+		basisPoints int
+		amount      Money
+		exclusive   bool
+		want        Money
+	}{
+		{"inclusive PPN", 1100, Rupiah(111000), false, Rupiah(11000)},
+		{"exclusive PPN", 1100, Rupiah(100000), true, Rupiah(11000)},
+		// 1,000 * 11/111 is 99.09
+		{"inclusive rounds down", 1100, Rupiah(1000), false, Rupiah(99)},
+		// 1,005 * 11% is 110.55
+		{"exclusive rounds up", 1100, Rupiah(1005), true, Rupiah(111)},
+		{"exclusive half", 1000, Rupiah(5), true, Rupiah(1)},
+		{"exclusive half below zero", 1000, Rupiah(-5), true, Rupiah(-1)},
+		// 3 * 100/200 is 1.5
+		{"inclusive half", 10000, Rupiah(3), false, Rupiah(2)},
+		{"exempt", 0, Rupiah(99999), true, Rupiah(0)},
+		{"keeps the currency", 1000, NewMoney(1995, "USD"), true, NewMoney(200, "USD")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate := TaxRate{BasisPoints: tt.basisPoints}
+			got, err := rate.Tax(tt.amount, tt.exclusive)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Tax = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,33 +1,101 @@
-package models
-
-import (
-	"errors"
-	"gorm.io/gorm"
-	"time"
-)
-
-type TransactionHistory struct {
-	ID         uint `gorm:"primary_key"`
-	ProductID  uint
-	Product    Product `gorm:"foreignKey:ProductID"`
-	UserID     uint
-	User       User `gorm:"foreignKey:UserID"`
-	Quantity   int  `gorm:"not null"`
-	TotalPrice int  `gorm:"not null"`
-	CreatedAt  time.Time
-	UpdatedAt  time.Time
-}
-
-func (th *TransactionHistory) BeforeCreate(tx *gorm.DB) (err error) {
-	// Validate quantity
-	if th.Quantity <= 0 {
-		return errors.New("quantity is required and must be greater than 0")
-	}
-
-	// Validate total price
-	if th.TotalPrice <= 0 {
-		return errors.New("total price is required and must be greater than 0")
-	}
-
-	return
-}
+package models
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+type TransactionHistory struct {
+	ID         uint `gorm:"primary_key"`
+	ProductID  uint
+	Product    Product `gorm:"foreignKey:ProductID"`
+	VariantID  *uint
+	UserID     uint
+	User       User  `gorm:"foreignKey:UserID"`
+	Quantity   int   `gorm:"not null"`
+	TotalPrice Money `gorm:"not null"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+
+	// Subtotal is the price before the promotion's Discount; TotalPrice is what was paid
+	Subtotal    Money `gorm:"not null;default:0"`
+	Discount    Money `gorm:"not null;default:0"`
+	PromotionID *uint
+
+	// PriceScheduleID is the sale the product was bought in, if any
+	PriceScheduleID *uint
+
+	// CategoryID is the product's category at checkout, which the sales
+	// reports group by, so moving the product later leaves them unchanged
+	CategoryID uint `gorm:"not null;default:0;index"`
+
+	// ChargedAmount is the TotalPrice converted into Currency, the currency of
+	// the buyer's wallet, at ExchangeRate; it is what was debited
+	ChargedAmount Money  `gorm:"not null;default:0"`
+	Currency      string `gorm:"type:char(3);not null;default:'IDR'"`
+	ExchangeRate  string `gorm:"type:numeric(24,10);not null;default:1"`
+
+	// TaxAmount is the tax on the subtotal minus the discount, at the rate the
+	// product's category had. Prices include the tax, unless TaxExclusive is
+	// set, in which case it is added to the TotalPrice.
+	TaxRateID      *uint
+	TaxName        string `gorm:"not null;default:''"`
+	TaxBasisPoints int    `gorm:"not null;default:0"`
+	TaxAmount      Money  `gorm:"not null;default:0"`
+	TaxExclusive   bool   `gorm:"not null;default:false"`
+
+	// ShippingAddress is the delivery address as it was at checkout; the
+	// ShippingCost of the ShippingMethod is part of the TotalPrice
+	ShippingAddressID *uint
+	ShippingAddress   string `gorm:"not null;default:''"`
+	ShippingMethod    string `gorm:"not null;default:''"`
+	ShippingCost      Money  `gorm:"not null;default:0"`
+}
+
+func (th *TransactionHistory) BeforeCreate(tx *gorm.DB) (err error) {
+	// Validate quantity
+	if th.Quantity <= 0 {
+		return errors.New("quantity is required and must be greater than 0")
+	}
+
+	// Validate total price, which a promotion can bring down to zero
+	if th.TotalPrice.IsNegative() {
+		return errors.New("total price must not be negative")
+	}
+	if expected, err := th.ExpectedTotal(); err != nil || th.TotalPrice != expected {
+		return errors.New("total price must equal the subtotal minus the discount, plus shipping and any tax added on top")
+	}
+
+	// Validate the charged amount
+	if th.Currency == "" {
+		th.Currency = th.ChargedAmount.Currency
+	}
+	if th.ChargedAmount.Currency != th.Currency {
+		return ErrCurrencyMismatch
+	}
+	if th.ChargedAmount.IsNegative() {
+		return errors.New("charged amount must not be negative")
+	}
+
+	return
+}
+
+// ExpectedTotal returns what the transaction costs: the subtotal minus the
+// discount, plus shipping and any tax added on top of the prices.
+func (th *TransactionHistory) ExpectedTotal() (Money, error) {
+	total, err := th.Subtotal.Sub(th.Discount)
+	if err == nil && th.TaxExclusive {
+		total, err = total.Add(th.TaxAmount)
+	}
+	if err == nil {
+		total, err = total.Add(th.ShippingCost)
+	}
+	return total, err
+}
+
+// AfterFind sets the currency of the charged amount, which is stored as an amount.
+func (th *TransactionHistory) AfterFind(tx *gorm.DB) (err error) {
+	th.ChargedAmount.Currency = th.Currency
+	return
+}
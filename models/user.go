@@ -1,49 +1,97 @@
-package models
-
-import (
-	"errors"
-	"time"
-
-	"github.com/asaskevich/govalidator"
-	"gorm.io/gorm"
-)
-
-type User struct {
-	ID        uint   `gorm:"primary_key"`
-	FullName  string `gorm:"not null" valid:"required"`
-	Email     string `gorm:"not null;unique" valid:"email,required"`
-	Password  string `gorm:"not null" valid:"required,length(6|255)"`
-	Role      string `gorm:"not null" valid:"required,oneof=admin customer" json:"Role"`
-	Balance   int64  `gorm:"not null" valid:"range(0|100000000)"`
-	CreatedAt time.Time
-	UpdatedAt time.Time
-}
-
-func (u *User) BeforeCreate(tx *gorm.DB) (err error) {
-	// Validate email
-	if !govalidator.IsEmail(u.Email) {
-		return errors.New("invalid email")
-	}
-
-	// Validate full name
-	if u.FullName == "" {
-		return errors.New("full name is required")
-	}
-
-	// Validate balance
-	if u.Balance < 0 || u.Balance > 100000000 {
-		return errors.New("balance must be between 0 and 100,000,000")
-	}
-
-	// Validate password
-	if len(u.Password) < 6 {
-		return errors.New("password must be at least 6 characters long")
-	}
-
-	// Validate role
-	if u.Role != "admin" && u.Role != "customer" {
-		return errors.New("role must be either 'admin' or 'customer'")
-	}
-
-	return
-}
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/asaskevich/govalidator"
+	"gorm.io/gorm"
+)
+
+// User account statuses. Only active users can authenticate.
+const (
+	UserStatusActive    = "active"
+	UserStatusSuspended = "suspended"
+	UserStatusDeleted   = "deleted"
+)
+
+// MaxBalance is the most a wallet can hold, in minor units of its currency.
+const MaxBalance = 100000000
+
+type User struct {
+	ID        uint   `gorm:"primary_key"`
+	FullName  string `gorm:"not null" valid:"required"`
+	Email     string `gorm:"not null;unique" valid:"email,required"`
+	Password  string `gorm:"not null" valid:"required,length(6|255)" json:"-"`
+	Role      string `gorm:"not null" valid:"required" json:"Role"`
+	Balance   Money  `gorm:"not null"`
+	Status    string `gorm:"not null;default:active"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	// Email change awaiting confirmation; only the hash of the token is stored
+	PendingEmail               string
+	EmailVerificationHash      string `json:"-"`
+	EmailVerificationExpiresAt *time.Time
+
+	// Currency is the currency the wallet Balance is held in
+	Currency string `gorm:"type:char(3);not null;default:'IDR'"`
+}
+
+func (u *User) BeforeCreate(tx *gorm.DB) (err error) {
+	// Validate email
+	if !govalidator.IsEmail(u.Email) {
+		return errors.New("invalid email")
+	}
+
+	// Validate full name
+	if u.FullName == "" {
+		return errors.New("full name is required")
+	}
+
+	// Validate wallet currency
+	if u.Currency == "" {
+		u.Currency = DefaultCurrency
+	}
+	if !ValidCurrency(u.Currency) {
+		return ErrUnknownCurrency
+	}
+
+	// Validate balance
+	if err := checkCurrency("balance", &u.Balance, u.Currency); err != nil {
+		return err
+	}
+	if u.Balance.Amount < 0 || u.Balance.Amount > MaxBalance {
+		return errors.New("balance must be between 0 and 100,000,000")
+	}
+
+	// Validate password
+	if len(u.Password) < 6 {
+		return errors.New("password must be at least 6 characters long")
+	}
+
+	// Validate role
+	var count int64
+	tx.Session(&gorm.Session{NewDB: true}).Model(&Role{}).Where("name = ?", u.Role).Count(&count)
+	if count == 0 {
+		return errors.New("role does not exist")
+	}
+
+	// New accounts start out active
+	if u.Status == "" {
+		u.Status = UserStatusActive
+	}
+
+	return
+}
+
+// AfterFind sets the currency of the balance, which is stored as an amount.
+func (u *User) AfterFind(tx *gorm.DB) (err error) {
+	u.Balance.Currency = u.Currency
+	return
+}
+
+// IsActive reports whether the user is allowed to authenticate.
+func (u *User) IsActive() bool {
+	return u.Status == "" || u.Status == UserStatusActive
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Warehouse is a location products are stocked in and shipped from.
+// Warehouses with a lower priority are allocated from first.
+type Warehouse struct {
+	ID        uint   `gorm:"primary_key"`
+	Code      string `gorm:"not null;unique"`
+	Name      string `gorm:"not null"`
+	Priority  int    `gorm:"not null;default:0"`
+	Active    bool   `gorm:"not null;default:true"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (wh *Warehouse) BeforeCreate(tx *gorm.DB) (err error) {
+	return wh.Validate()
+}
+
+// Validate checks the editable fields of the warehouse.
+func (wh *Warehouse) Validate() error {
+	// Validate code
+	if wh.Code == "" {
+		return errors.New("code is required")
+	}
+
+	// Validate name
+	if wh.Name == "" {
+		return errors.New("name is required")
+	}
+
+	return nil
+}
+
+// WarehouseStock is the stock level of a product, or one of its variants, at
+// one warehouse. VariantID is 0 for stock of the product itself. A product's
+// Stock is the sum of its levels across all warehouses.
+type WarehouseStock struct {
+	ID          uint `gorm:"primary_key"`
+	WarehouseID uint `gorm:"not null;uniqueIndex:idx_warehouse_stock_variant"`
+	ProductID   uint `gorm:"not null;uniqueIndex:idx_warehouse_stock_variant;index"`
+	VariantID   uint `gorm:"not null;default:0;uniqueIndex:idx_warehouse_stock_variant"`
+	Quantity    int  `gorm:"not null"`
+	UpdatedAt   time.Time
+}
+
+// StockTransfer records stock moved from one warehouse to another.
+type StockTransfer struct {
+	ID              uint   `gorm:"primary_key"`
+	ProductID       uint   `gorm:"not null;index"`
+	FromWarehouseID uint   `gorm:"not null"`
+	ToWarehouseID   uint   `gorm:"not null"`
+	Quantity        int    `gorm:"not null"`
+	Reason          string `gorm:"not null"`
+	ActorID         uint   `gorm:"not null"`
+	VariantID       *uint
+	CreatedAt       time.Time
+}
+
+func (t *StockTransfer) BeforeCreate(tx *gorm.DB) (err error) {
+	// Validate quantity
+	if t.Quantity <= 0 {
+		return errors.New("quantity must be greater than 0")
+	}
+
+	// Validate warehouses
+	if t.FromWarehouseID == t.ToWarehouseID {
+		return errors.New("stock must be transferred to a different warehouse")
+	}
+
+	// Validate reason
+	if t.Reason == "" {
+		return errors.New("reason is required")
+	}
+
+	return
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// WishlistItem is a product a user saved for later.
+type WishlistItem struct {
+	ID        uint    `gorm:"primary_key"`
+	UserID    uint    `gorm:"not null;uniqueIndex:idx_wishlist_user_product"`
+	ProductID uint    `gorm:"not null;uniqueIndex:idx_wishlist_user_product;index"`
+	Product   Product `gorm:"foreignKey:ProductID"`
+	CreatedAt time.Time
+}
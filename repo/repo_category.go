@@ -1,23 +1,29 @@
-// repository.go
-package repo
-
-import (
-	"github.com/Pijuyy/testing_project4/models"
-	"gorm.io/gorm"
-)
-
-type CategoryRepository struct {
-	DB *gorm.DB
-}
-
-func NewCategoryRepository(db *gorm.DB) *CategoryRepository {
-	return &CategoryRepository{
-		DB: db,
-	}
-}
-
-func (r *CategoryRepository) FindCategoryByID(id int) (*models.Category, error) {
-	var category models.Category
-	result := r.DB.First(&category, id)
-	return &category, result.Error
-}
+// repository.go
+package repo
+
+import (
+	"github.com/Pijuyy/testing_project4/models"
+	"gorm.io/gorm"
+)
+
+type CategoryRepository struct {
+	DB *gorm.DB
+}
+
+func NewCategoryRepository(db *gorm.DB) *CategoryRepository {
+	return &CategoryRepository{
+		DB: db,
+	}
+}
+
+func (r *CategoryRepository) FindCategoryByID(id int) (*models.Category, error) {
+	var category models.Category
+	result := r.DB.First(&category, id)
+	return &category, result.Error
+}
+
+func (r *CategoryRepository) FindCategoryWithProducts(id int) (*models.Category, error) {
+	var category models.Category
+	result := r.DB.Preload("Products").First(&category, id)
+	return &category, result.Error
+}
@@ -1,40 +1,175 @@
-package routes
-
-import (
-	"fmt"
-	"net/http"
-
-	"github.com/Pijuyy/testing_project4/controllers"
-	"github.com/gorilla/mux"
-	"gorm.io/gorm"
-)
-
-func RegisterRoutes(router *mux.Router, db *gorm.DB) {
-	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprintln(w, "API Project 4 Kelompok 2")
-	})
-	// User routes
-	router.HandleFunc("/users/register", controllers.RegisterUser(db)).Methods("POST")
-	router.HandleFunc("/users/login", controllers.LoginUser(db)).Methods("POST")
-	router.HandleFunc("/users/topup", controllers.TopUpUser(db)).Methods("PATCH")
-
-	// Menggunakan instance CategoryController
-	categoryController := controllers.NewCategoryController(db)
-
-	// Category routes
-	router.HandleFunc("/categories", categoryController.CreateCategory).Methods("POST")
-	router.HandleFunc("/categories", categoryController.GetCategories).Methods("GET")
-	router.HandleFunc("/categories/{categoryId}", categoryController.UpdateCategory).Methods("PATCH")
-	router.HandleFunc("/categories/{categoryId}", categoryController.DeleteCategory).Methods("DELETE")
-
-	// Product routes
-	router.HandleFunc("/products", controllers.CreateProduct(db)).Methods("POST")
-	router.HandleFunc("/products", controllers.GetProducts(db)).Methods("GET")
-	router.HandleFunc("/products/{productId}", controllers.UpdateProduct(db)).Methods("PUT")
-	router.HandleFunc("/products/{productId}", controllers.DeleteProduct(db)).Methods("DELETE")
-
-	// TransactionHistory routes
-	router.HandleFunc("/transactions", controllers.CreateTransaction(db)).Methods("POST")
-	router.HandleFunc("/transactions/my-transactions", controllers.GetMyTransactions(db)).Methods("GET")
-	router.HandleFunc("/transactions/user-transactions", controllers.GetUserTransactions(db)).Methods("GET")
-}
+package routes
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Pijuyy/testing_project4/controllers"
+	"github.com/Pijuyy/testing_project4/storage"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+func RegisterRoutes(router *mux.Router, db *gorm.DB, store storage.Storage) {
+	router.Use(requestIDMiddleware)
+
+	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "API Project 4 Kelompok 2")
+	})
+	// User routes
+	router.HandleFunc("/users/register", controllers.RegisterUser(db)).Methods("POST")
+	router.HandleFunc("/users/login", controllers.LoginUser(db)).Methods("POST")
+	router.HandleFunc("/users/topup", controllers.TopUpUser(db)).Methods("PATCH")
+
+	// Profile routes for the authenticated user
+	router.HandleFunc("/users/me", controllers.GetProfile(db)).Methods("GET")
+	router.HandleFunc("/users/me", controllers.UpdateProfile(db)).Methods("PATCH")
+	router.HandleFunc("/users/me", controllers.DeleteAccount(db)).Methods("DELETE")
+	router.HandleFunc("/users/me/password", controllers.ChangePassword(db)).Methods("PATCH")
+	router.HandleFunc("/users/me/email", controllers.RequestEmailChange(db)).Methods("POST")
+	router.HandleFunc("/users/me/email/verify", controllers.VerifyEmailChange(db)).Methods("POST")
+
+	// Wishlist and notification routes for the authenticated user
+	router.HandleFunc("/users/me/wishlist", controllers.AddToWishlist(db)).Methods("POST")
+	router.HandleFunc("/users/me/wishlist", controllers.GetWishlist(db)).Methods("GET")
+	router.HandleFunc("/users/me/wishlist/{productId:[0-9]+}", controllers.RemoveFromWishlist(db)).Methods("DELETE")
+	router.HandleFunc("/users/me/notifications", controllers.GetMyNotifications(db)).Methods("GET")
+	router.HandleFunc("/users/me/notifications/read", controllers.MarkAllNotificationsRead(db)).Methods("POST")
+	router.HandleFunc("/users/me/notifications/{notificationId:[0-9]+}/read", controllers.MarkNotificationRead(db)).Methods("POST")
+
+	// Shipping addresses of the authenticated user
+	router.HandleFunc("/users/me/addresses", controllers.CreateAddress(db)).Methods("POST")
+	router.HandleFunc("/users/me/addresses", controllers.GetMyAddresses(db)).Methods("GET")
+	router.HandleFunc("/users/me/addresses/{addressId:[0-9]+}", controllers.PatchAddress(db)).Methods("PATCH")
+	router.HandleFunc("/users/me/addresses/{addressId:[0-9]+}", controllers.DeleteAddress(db)).Methods("DELETE")
+	router.HandleFunc("/users/me/addresses/{addressId:[0-9]+}/default", controllers.SetDefaultAddress(db)).Methods("PUT")
+
+	// API key routes
+	router.HandleFunc("/users/me/api-keys", controllers.CreateMyAPIKey(db)).Methods("POST")
+	router.HandleFunc("/users/me/api-keys", controllers.GetMyAPIKeys(db)).Methods("GET")
+	router.HandleFunc("/users/me/api-keys/{keyId}", controllers.RevokeMyAPIKey(db)).Methods("DELETE")
+	router.HandleFunc("/users/{userId:[0-9]+}/api-keys", controllers.CreateUserAPIKey(db)).Methods("POST")
+	router.HandleFunc("/users/{userId:[0-9]+}/api-keys", controllers.GetUserAPIKeys(db)).Methods("GET")
+	router.HandleFunc("/users/{userId:[0-9]+}/api-keys/{keyId}", controllers.RevokeUserAPIKey(db)).Methods("DELETE")
+
+	// Admin user management routes
+	router.HandleFunc("/users", controllers.ListUsers(db)).Methods("GET")
+	router.HandleFunc("/users/{userId:[0-9]+}", controllers.GetUser(db)).Methods("GET")
+	router.HandleFunc("/users/{userId:[0-9]+}/role", controllers.UpdateUserRole(db)).Methods("PATCH")
+	router.HandleFunc("/users/{userId:[0-9]+}/suspend", controllers.SuspendUser(db)).Methods("PATCH")
+	router.HandleFunc("/users/{userId:[0-9]+}/reactivate", controllers.ReactivateUser(db)).Methods("PATCH")
+	router.HandleFunc("/users/{userId:[0-9]+}/balance-adjustments", controllers.AdjustUserBalance(db)).Methods("POST")
+	router.HandleFunc("/users/{userId:[0-9]+}/balance-adjustments", controllers.GetUserBalanceAdjustments(db)).Methods("GET")
+
+	// Role and permission management routes
+	router.HandleFunc("/permissions", controllers.GetPermissions(db)).Methods("GET")
+	router.HandleFunc("/roles", controllers.GetRoles(db)).Methods("GET")
+	router.HandleFunc("/roles", controllers.CreateRole(db)).Methods("POST")
+	router.HandleFunc("/roles/{roleId}", controllers.UpdateRole(db)).Methods("PUT")
+	router.HandleFunc("/roles/{roleId}", controllers.DeleteRole(db)).Methods("DELETE")
+
+	// Audit log routes
+	router.HandleFunc("/audit-logs", controllers.GetAuditLogs(db)).Methods("GET")
+
+	// Menggunakan instance CategoryController
+	categoryController := controllers.NewCategoryController(db)
+
+	// Category routes
+	router.HandleFunc("/categories", categoryController.CreateCategory).Methods("POST")
+	router.HandleFunc("/categories", categoryController.GetCategories).Methods("GET")
+	router.HandleFunc("/categories/{categoryId:[0-9]+}", categoryController.GetCategory).Methods("GET")
+	router.HandleFunc("/categories/{categoryId}", categoryController.UpdateCategory).Methods("PATCH")
+	router.HandleFunc("/categories/{categoryId}", categoryController.DeleteCategory).Methods("DELETE")
+	router.HandleFunc("/categories/{categoryId:[0-9]+}/move", categoryController.MoveCategory).Methods("POST")
+	router.HandleFunc("/categories/{categoryId:[0-9]+}/tax-rate", categoryController.SetCategoryTaxRate).Methods("PUT")
+	router.HandleFunc("/reports/category-sales", categoryController.CategorySalesReport).Methods("GET")
+
+	// Tax routes
+	router.HandleFunc("/tax-rates", controllers.CreateTaxRate(db)).Methods("POST")
+	router.HandleFunc("/tax-rates", controllers.GetTaxRates(db)).Methods("GET")
+	router.HandleFunc("/tax-rates/{taxRateId:[0-9]+}", controllers.PatchTaxRate(db)).Methods("PATCH")
+	router.HandleFunc("/tax-rates/{taxRateId:[0-9]+}", controllers.DeleteTaxRate(db)).Methods("DELETE")
+	router.HandleFunc("/reports/tax", controllers.TaxReport(db)).Methods("GET")
+
+	// Product routes
+	router.HandleFunc("/products", controllers.CreateProduct(db)).Methods("POST")
+	router.HandleFunc("/products", controllers.GetProducts(db, store)).Methods("GET")
+	router.HandleFunc("/products/{productId:[0-9]+}", controllers.GetProduct(db, store)).Methods("GET")
+	router.HandleFunc("/products/{productId:[0-9]+}", controllers.UpdateProduct(db)).Methods("PUT")
+	router.HandleFunc("/products/{productId:[0-9]+}", controllers.PatchProduct(db)).Methods("PATCH")
+	router.HandleFunc("/products/{productId:[0-9]+}", controllers.DeleteProduct(db, store)).Methods("DELETE")
+	router.HandleFunc("/products/import", controllers.ImportProducts(db)).Methods("POST")
+	router.HandleFunc("/products/{productId:[0-9]+}/variants", controllers.CreateVariant(db)).Methods("POST")
+	router.HandleFunc("/products/{productId:[0-9]+}/variants", controllers.GetVariants(db)).Methods("GET")
+	router.HandleFunc("/products/{productId:[0-9]+}/variants/{variantId:[0-9]+}", controllers.PatchVariant(db)).Methods("PATCH")
+	router.HandleFunc("/products/{productId:[0-9]+}/variants/{variantId:[0-9]+}", controllers.DeleteVariant(db)).Methods("DELETE")
+	router.HandleFunc("/products/export", controllers.ExportProducts(db)).Methods("GET")
+	router.HandleFunc("/products/search", controllers.SearchProducts(db, store)).Methods("GET")
+	router.HandleFunc("/products/suggest", controllers.SuggestProducts(db)).Methods("GET")
+
+	// Product review routes
+	router.HandleFunc("/products/{productId:[0-9]+}/reviews", controllers.CreateReview(db)).Methods("POST")
+	router.HandleFunc("/products/{productId:[0-9]+}/reviews", controllers.GetProductReviews(db)).Methods("GET")
+	router.HandleFunc("/products/{productId:[0-9]+}/reviews/{reviewId:[0-9]+}", controllers.PatchReview(db)).Methods("PATCH")
+	router.HandleFunc("/products/{productId:[0-9]+}/reviews/{reviewId:[0-9]+}", controllers.DeleteReview(db)).Methods("DELETE")
+	router.HandleFunc("/products/{productId:[0-9]+}/reviews/{reviewId:[0-9]+}/hide", controllers.HideReview(db)).Methods("POST")
+	router.HandleFunc("/products/{productId:[0-9]+}/reviews/{reviewId:[0-9]+}/unhide", controllers.UnhideReview(db)).Methods("POST")
+
+	// Exchange rate routes
+	router.HandleFunc("/exchange-rates", controllers.GetExchangeRates(db)).Methods("GET")
+	router.HandleFunc("/exchange-rates/import", controllers.ImportExchangeRates(db)).Methods("POST")
+	router.HandleFunc("/exchange-rates/{currency:[A-Za-z]{3}}", controllers.SetExchangeRate(db)).Methods("PUT")
+	router.HandleFunc("/exchange-rates/{currency:[A-Za-z]{3}}/history", controllers.GetExchangeRateHistory(db)).Methods("GET")
+
+	// Price schedule routes
+	router.HandleFunc("/products/{productId:[0-9]+}/price-schedules", controllers.CreatePriceSchedule(db)).Methods("POST")
+	router.HandleFunc("/products/{productId:[0-9]+}/price-schedules", controllers.GetPriceSchedules(db)).Methods("GET")
+	router.HandleFunc("/products/{productId:[0-9]+}/price-schedules/{scheduleId:[0-9]+}", controllers.CancelPriceSchedule(db)).Methods("DELETE")
+	router.HandleFunc("/products/{productId:[0-9]+}/price-history", controllers.GetPriceHistory(db)).Methods("GET")
+
+	// Product image routes
+	router.HandleFunc("/products/{productId:[0-9]+}/images", controllers.UploadProductImage(db, store)).Methods("POST")
+	router.HandleFunc("/products/{productId:[0-9]+}/images", controllers.GetProductImages(db, store)).Methods("GET")
+	router.HandleFunc("/products/{productId:[0-9]+}/images/order", controllers.ReorderProductImages(db, store)).Methods("PUT")
+	router.HandleFunc("/products/{productId:[0-9]+}/images/{imageId:[0-9]+}/primary", controllers.SetPrimaryProductImage(db, store)).Methods("PUT")
+	router.HandleFunc("/products/{productId:[0-9]+}/images/{imageId:[0-9]+}", controllers.DeleteProductImage(db, store)).Methods("DELETE")
+
+	// Locally stored files are served by the API itself
+	if local, ok := store.(*storage.LocalStorage); ok {
+		router.PathPrefix(local.URLPrefix + "/").Handler(local.Handler()).Methods("GET")
+	}
+
+	// Inventory routes
+	router.HandleFunc("/products/{productId:[0-9]+}/stock-adjustments", controllers.CreateStockAdjustment(db)).Methods("POST")
+	router.HandleFunc("/products/{productId:[0-9]+}/stock-movements", controllers.GetStockMovements(db)).Methods("GET")
+	router.HandleFunc("/products/low-stock", controllers.GetLowStockProducts(db)).Methods("GET")
+	router.HandleFunc("/stock-alerts", controllers.GetStockAlerts(db)).Methods("GET")
+	router.HandleFunc("/products/{productId:[0-9]+}/stock-levels", controllers.GetProductStockLevels(db)).Methods("GET")
+	router.HandleFunc("/reports/inventory-reconciliation", controllers.GetInventoryReconciliation(db)).Methods("GET")
+
+	// Warehouse routes
+	router.HandleFunc("/warehouses", controllers.CreateWarehouse(db)).Methods("POST")
+	router.HandleFunc("/warehouses", controllers.GetWarehouses(db)).Methods("GET")
+	router.HandleFunc("/warehouses/{warehouseId:[0-9]+}", controllers.UpdateWarehouse(db)).Methods("PATCH")
+	router.HandleFunc("/warehouses/{warehouseId:[0-9]+}/stock", controllers.GetWarehouseStock(db)).Methods("GET")
+	router.HandleFunc("/stock-transfers", controllers.CreateStockTransfer(db)).Methods("POST")
+	router.HandleFunc("/stock-transfers", controllers.GetStockTransfers(db)).Methods("GET")
+
+	// Reservation routes
+	router.HandleFunc("/reservations", controllers.CreateReservation(db)).Methods("POST")
+	router.HandleFunc("/reservations", controllers.GetMyReservations(db)).Methods("GET")
+	router.HandleFunc("/reservations/{reservationId:[0-9]+}", controllers.ReleaseReservation(db)).Methods("DELETE")
+
+	// Promotion routes
+	router.HandleFunc("/promotions", controllers.CreatePromotion(db)).Methods("POST")
+	router.HandleFunc("/promotions", controllers.GetPromotions(db)).Methods("GET")
+	router.HandleFunc("/promotions/{promotionId:[0-9]+}", controllers.GetPromotion(db)).Methods("GET")
+	router.HandleFunc("/promotions/{promotionId:[0-9]+}", controllers.PatchPromotion(db)).Methods("PATCH")
+	router.HandleFunc("/promotions/{promotionId:[0-9]+}", controllers.DeletePromotion(db)).Methods("DELETE")
+
+	// TransactionHistory routes
+	router.HandleFunc("/transactions", controllers.CreateTransaction(db)).Methods("POST")
+	router.HandleFunc("/transactions/my-transactions", controllers.GetMyTransactions(db)).Methods("GET")
+	router.HandleFunc("/transactions/user-transactions", controllers.GetUserTransactions(db)).Methods("GET")
+	router.HandleFunc("/transactions/{transactionId:[0-9]+}", controllers.GetTransaction(db)).Methods("GET")
+}
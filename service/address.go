@@ -0,0 +1,158 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/Pijuyy/testing_project4/models"
+	"gorm.io/gorm"
+)
+
+// ShippingAddressFor returns the user's address to ship an order to: the one
+// with addressID, or the user's default address when addressID is nil. It is
+// nil when the user has no address, and the order is then picked up.
+func ShippingAddressFor(tx *gorm.DB, userID uint, addressID *uint) (*models.Address, error) {
+	query := tx.Where("user_id = ?", userID)
+	if addressID != nil {
+		query = query.Where("id = ?", *addressID)
+	} else {
+		query = query.Where("is_default = ?", true)
+	}
+
+	var address models.Address
+	err := query.First(&address).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) && addressID == nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &address, nil
+}
+
+// CreateAddress saves a new address for its user. A user's first address, or
+// one created with IsDefault set, becomes their default. It must run in a
+// transaction.
+func CreateAddress(tx *gorm.DB, address *models.Address) error {
+	if err := lockUserAddresses(tx, address.UserID); err != nil {
+		return err
+	}
+
+	var count int64
+	if err := tx.Model(&models.Address{}).Where("user_id = ?", address.UserID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		address.IsDefault = true
+	}
+	if address.IsDefault {
+		if err := clearDefaultAddress(tx, address.UserID, 0); err != nil {
+			return err
+		}
+	}
+
+	return tx.Create(address).Error
+}
+
+// UpdateAddress saves changes to an address if it is still at the version it
+// was read at. It must run in a transaction.
+func UpdateAddress(tx *gorm.DB, address *models.Address) error {
+	if address.IsDefault {
+		if err := lockUserAddresses(tx, address.UserID); err != nil {
+			return err
+		}
+		if err := clearDefaultAddress(tx, address.UserID, address.ID); err != nil {
+			return err
+		}
+	}
+
+	result := tx.Model(address).Where("version = ?", address.Version).Updates(map[string]interface{}{
+		"label":          address.Label,
+		"recipient_name": address.RecipientName,
+		"phone":          address.Phone,
+		"line1":          address.Line1,
+		"line2":          address.Line2,
+		"city":           address.City,
+		"province":       address.Province,
+		"postal_code":    address.PostalCode,
+		"country_code":   address.CountryCode,
+		"is_default":     address.IsDefault,
+		"version":        gorm.Expr("version + 1"),
+		"updated_at":     address.UpdatedAt,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrVersionConflict
+	}
+
+	address.Version++
+	return nil
+}
+
+// SetDefaultAddress makes the address its user's default. It must run in a
+// transaction.
+func SetDefaultAddress(tx *gorm.DB, address *models.Address) error {
+	if err := lockUserAddresses(tx, address.UserID); err != nil {
+		return err
+	}
+	if err := clearDefaultAddress(tx, address.UserID, address.ID); err != nil {
+		return err
+	}
+
+	err := tx.Model(address).Updates(map[string]interface{}{
+		"is_default": true,
+		"version":    gorm.Expr("version + 1"),
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	address.IsDefault = true
+	address.Version++
+	return nil
+}
+
+// DeleteAddress deletes an address. When it was the default, the user's most
+// recently added remaining address becomes the default. Past orders keep the
+// address they were shipped to. It must run in a transaction.
+func DeleteAddress(tx *gorm.DB, address *models.Address) error {
+	if err := lockUserAddresses(tx, address.UserID); err != nil {
+		return err
+	}
+	// Whether it is the default may have changed before the lock was taken
+	if err := tx.First(address, address.ID).Error; err != nil {
+		return err
+	}
+	if err := tx.Delete(address).Error; err != nil {
+		return err
+	}
+	if !address.IsDefault {
+		return nil
+	}
+
+	var next models.Address
+	err := tx.Where("user_id = ?", address.UserID).Order("id DESC").First(&next).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return tx.Model(&next).Updates(map[string]interface{}{
+		"is_default": true,
+		"version":    gorm.Expr("version + 1"),
+	}).Error
+}
+
+// lockUserAddresses serializes changes to a user's addresses so they never
+// have more than one default.
+func lockUserAddresses(tx *gorm.DB, userID uint) error {
+	return tx.Exec("SELECT pg_advisory_xact_lock(hashtext('addresses.default'), ?)", userID).Error
+}
+
+func clearDefaultAddress(tx *gorm.DB, userID, exceptID uint) error {
+	return tx.Model(&models.Address{}).Where("user_id = ? AND is_default = ? AND id <> ?", userID, true, exceptID).
+		Updates(map[string]interface{}{
+			"is_default": false,
+			"version":    gorm.Expr("version + 1"),
+		}).Error
+}
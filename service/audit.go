@@ -0,0 +1,128 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"sync"
+
+	"github.com/Pijuyy/testing_project4/config"
+	"github.com/Pijuyy/testing_project4/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+var schemaCache sync.Map
+
+// RecordAudit appends an audit log entry through tx, so it is committed or
+// rolled back together with the change it describes. before and after are
+// snapshots of the entity, nil when it did not exist before or after the
+// change. Actions are named "<entity>.<verb>", e.g. "product.update". r and
+// actor are nil for changes made outside of a request, e.g. by CLI commands.
+func RecordAudit(tx *gorm.DB, r *http.Request, actor *models.User, action, entityType string, entityID uint, before, after interface{}) error {
+	beforeSnapshot, err := snapshot(before)
+	if err != nil {
+		return err
+	}
+	afterSnapshot, err := snapshot(after)
+	if err != nil {
+		return err
+	}
+
+	entry := models.AuditLog{
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   strconv.FormatUint(uint64(entityID), 10),
+		RequestID:  config.RequestID(r),
+		IP:         config.ClientIP(r),
+	}
+	if actor != nil {
+		entry.ActorID = &actor.ID
+	}
+
+	if entry.Before, err = marshalJSON(beforeSnapshot); err != nil {
+		return err
+	}
+	if entry.After, err = marshalJSON(afterSnapshot); err != nil {
+		return err
+	}
+	if entry.Changes, err = marshalJSON(diffSnapshots(beforeSnapshot, afterSnapshot)); err != nil {
+		return err
+	}
+
+	return tx.Create(&entry).Error
+}
+
+// ScrubUserAudit removes the user's name and email addresses from the audit
+// entries about them, which keep what was done and when. It must run in the
+// transaction that erases the user's personal data.
+func ScrubUserAudit(tx *gorm.DB, userID uint) error {
+	return tx.Exec(`UPDATE audit_logs SET
+	before = CASE WHEN jsonb_typeof(before) = 'object' THEN before - '{FullName,Email,PendingEmail}'::text[] ELSE before END,
+	after = CASE WHEN jsonb_typeof(after) = 'object' THEN after - '{FullName,Email,PendingEmail}'::text[] ELSE after END,
+	changes = CASE WHEN jsonb_typeof(changes) = 'object' THEN changes - '{FullName,Email,PendingEmail}'::text[] ELSE changes END
+WHERE entity_type = 'user' AND entity_id = ?`, strconv.FormatUint(uint64(userID), 10)).Error
+}
+
+// snapshot converts an entity into a flat map of its fields. Associations are
+// left out, each entry describes a single entity. Secrets are excluded through
+// their `json:"-"` tags.
+func snapshot(entity interface{}) (map[string]interface{}, error) {
+	if entity == nil {
+		return nil, nil
+	}
+	value := reflect.ValueOf(entity)
+	if value.Kind() == reflect.Pointer && value.IsNil() {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(entity)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	if reflect.Indirect(value).Kind() == reflect.Struct {
+		entitySchema, err := schema.Parse(entity, &schemaCache, schema.NamingStrategy{})
+		if err == nil {
+			for name := range entitySchema.Relationships.Relations {
+				delete(fields, name)
+			}
+		}
+	}
+
+	return fields, nil
+}
+
+// diffSnapshots lists the fields that differ as {"field": {"from": x, "to": y}}.
+func diffSnapshots(before, after map[string]interface{}) map[string]interface{} {
+	changes := make(map[string]interface{})
+	for field, value := range after {
+		if old, ok := before[field]; !ok || !reflect.DeepEqual(old, value) {
+			changes[field] = map[string]interface{}{"from": before[field], "to": value}
+		}
+	}
+	for field, old := range before {
+		if _, ok := after[field]; !ok {
+			changes[field] = map[string]interface{}{"from": old, "to": nil}
+		}
+	}
+
+	return changes
+}
+
+func marshalJSON(v interface{}) (string, error) {
+	if m, ok := v.(map[string]interface{}); ok && m == nil {
+		return "null", nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Pijuyy/testing_project4/models"
+)
+
+func TestScrubUserAudit(t *testing.T) {
+	db := testDB(t)
+	user := models.User{
+		FullName: "Siti Rahma",
+		Email:    fmt.Sprintf("siti-%d@example.com", time.Now().UnixNano()),
+		Password: "not a real hash",
+		Role:     models.RoleCustomer,
+	}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	before := user
+	user.PendingEmail = "rahma@example.com"
+	if err := RecordAudit(db, nil, &user, "user.register", "user", user.ID, nil, before); err != nil {
+		t.Fatal(err)
+	}
+	if err := RecordAudit(db, nil, &user, "user.request_email_change", "user", user.ID, before, user); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ScrubUserAudit(db, user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	var entries []models.AuditLog
+	db.Where("entity_type = ? AND entity_id = ?", "user", fmt.Sprint(user.ID)).Find(&entries)
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	for _, entry := range entries {
+		for _, data := range []string{entry.Before, entry.After, entry.Changes} {
+			if strings.Contains(data, "Siti") || strings.Contains(data, "@example.com") {
+				t.Errorf("%s still holds personal data: %s", entry.Action, data)
+			}
+		}
+		if !strings.Contains(entry.After, `"Status"`) {
+			t.Errorf("%s lost the other fields: %s", entry.Action, entry.After)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Pijuyy/testing_project4/config"
+	"github.com/Pijuyy/testing_project4/models"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var migrateTestDB sync.Once
+
+// testDB connects to the PostgreSQL database in TEST_DATABASE_URL and
+// migrates it. Tests that need the database are skipped when it is not set.
+// Each test creates the rows it uses, so the database can be shared.
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrateTestDB.Do(func() { err = config.Migrate(db) })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// createTestProduct creates a product with the stock in a category of its own.
+func createTestProduct(t *testing.T, db *gorm.DB, stock int) models.Product {
+	t.Helper()
+	name := fmt.Sprintf("%s %d", t.Name(), time.Now().UnixNano())
+
+	category := models.Category{Type: name}
+	if err := db.Create(&category).Error; err != nil {
+		t.Fatal(err)
+	}
+	product := models.Product{Title: name, Price: models.Rupiah(10000), Stock: stock, CategoryID: category.ID}
+	if err := db.Create(&product).Error; err != nil {
+		t.Fatal(err)
+	}
+	return product
+}
+
+// inParallel runs n transactions at the same time and returns their errors.
+func inParallel(db *gorm.DB, n int, fn func(tx *gorm.DB, i int) error) []error {
+	errs := make([]error, n)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			errs[i] = db.Transaction(func(tx *gorm.DB) error { return fn(tx, i) })
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	return errs
+}
+
+// countErrors returns how many of the errors are nil and how many are target.
+// Any other error fails the test.
+func countErrors(t *testing.T, errs []error, target error) (succeeded, failed int) {
+	t.Helper()
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case errors.Is(err, target):
+			failed++
+		default:
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	return succeeded, failed
+}
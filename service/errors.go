@@ -0,0 +1,48 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrVersionConflict is returned when a row was changed by someone else
+// between reading and writing it.
+var ErrVersionConflict = errors.New("the resource was modified by another request, reload it and try again")
+
+// ErrInsufficientStock is returned when a product does not have enough stock.
+var ErrInsufficientStock = errors.New("Not enough stock available")
+
+// ErrInsufficientBalance is returned when a user cannot pay for a purchase.
+var ErrInsufficientBalance = errors.New("Insufficient balance")
+
+// ErrBalanceLimit is returned when a top-up would take a balance over
+// models.MaxBalance.
+var ErrBalanceLimit = errors.New("balance cannot exceed 100,000,000")
+
+// ErrReservationUnavailable is returned when a reservation is no longer
+// active, e.g. because it expired or was already used.
+var ErrReservationUnavailable = errors.New("Reservation is no longer active")
+
+// ErrCategoryCycle is returned when a category would be moved below itself.
+var ErrCategoryCycle = errors.New("a category cannot be moved below itself or one of its subcategories")
+
+// ErrNotVerifiedBuyer is returned when a user reviews a product they did not buy.
+var ErrNotVerifiedBuyer = errors.New("only customers who bought the product can review it")
+
+// ErrAlreadyReviewed is returned when a user reviews a product a second time.
+var ErrAlreadyReviewed = errors.New("you have already reviewed this product, edit your review instead")
+
+// ErrVariantRequired is returned when the stock of a product with variants is
+// changed without naming one of them.
+var ErrVariantRequired = errors.New("variant_id is required for products with variants")
+
+// ErrLastSuperAdmin is returned when the last super admin would be demoted or
+// suspended.
+var ErrLastSuperAdmin = errors.New("the last super admin cannot be demoted or suspended")
+
+// IsUniqueViolation reports whether err is a violation of a unique constraint.
+func IsUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
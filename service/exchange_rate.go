@@ -0,0 +1,121 @@
+package service
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+
+	"github.com/Pijuyy/testing_project4/models"
+	"gorm.io/gorm"
+)
+
+// ErrNoExchangeRate is returned when a currency has no exchange rate yet.
+var ErrNoExchangeRate = errors.New("no exchange rate is set for the currency")
+
+// ExchangeRateFor returns the current rate of the currency. The base
+// currency always has a rate of 1.
+func ExchangeRateFor(tx *gorm.DB, currency string) (*models.ExchangeRate, error) {
+	if currency == models.DefaultCurrency {
+		return &models.ExchangeRate{Currency: currency, Rate: "1"}, nil
+	}
+
+	var rate models.ExchangeRate
+	err := tx.Where("currency = ?", currency).Order("id DESC").First(&rate).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrNoExchangeRate, currency)
+	}
+	return &rate, err
+}
+
+// CurrentExchangeRates returns the current rate of every currency that has one.
+func CurrentExchangeRates(tx *gorm.DB) ([]models.ExchangeRate, error) {
+	var rates []models.ExchangeRate
+	err := tx.Raw("SELECT DISTINCT ON (currency) * FROM exchange_rates ORDER BY currency, id DESC").Scan(&rates).Error
+	return rates, err
+}
+
+// SetExchangeRate records a new rate for the currency, which becomes its
+// current rate.
+func SetExchangeRate(tx *gorm.DB, currency, rate, source string, actorID *uint) (*models.ExchangeRate, error) {
+	exchangeRate := models.ExchangeRate{
+		Currency:  strings.ToUpper(strings.TrimSpace(currency)),
+		Rate:      normalizeRate(rate),
+		Source:    source,
+		CreatedBy: actorID,
+	}
+	if err := exchangeRate.Validate(); err != nil {
+		return nil, err
+	}
+	if err := tx.Create(&exchangeRate).Error; err != nil {
+		return nil, err
+	}
+	return &exchangeRate, nil
+}
+
+// ImportExchangeRates sets the rates listed in a CSV file with a currency and
+// a rate column. The file is imported as a whole or not at all, so it must
+// run in a transaction.
+func ImportExchangeRates(tx *gorm.DB, r io.Reader, actorID *uint) ([]models.ExchangeRate, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: reading header: %v", ErrInvalidCSV, err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	currencyColumn, hasCurrency := columns["currency"]
+	rateColumn, hasRate := columns["rate"]
+	if !hasCurrency || !hasRate {
+		return nil, fmt.Errorf("%w: the columns must be \"currency\" and \"rate\"", ErrInvalidCSV)
+	}
+
+	var rates []models.ExchangeRate
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidCSV, line, err)
+		}
+
+		rate, err := SetExchangeRate(tx, record[currencyColumn], record[rateColumn], models.ExchangeRateImport, actorID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidCSV, line, err)
+		}
+		rates = append(rates, *rate)
+	}
+	if len(rates) == 0 {
+		return nil, fmt.Errorf("%w: the file has no rates", ErrInvalidCSV)
+	}
+	return rates, nil
+}
+
+// ConvertForDisplay converts a base currency amount for showing it in another
+// currency. Amounts in the base currency are returned as they are.
+func ConvertForDisplay(amount models.Money, rate *models.ExchangeRate) (models.Money, error) {
+	if rate == nil || rate.Currency == amount.Currency {
+		return amount, nil
+	}
+	return rate.Convert(amount)
+}
+
+// normalizeRate writes a decimal rate with the precision it is stored in,
+// leaving anything that isn't a decimal number for validation to reject.
+func normalizeRate(rate string) string {
+	rate = strings.TrimSpace(rate)
+	if strings.ContainsAny(rate, "/eE") {
+		return ""
+	}
+	value, ok := new(big.Rat).SetString(rate)
+	if !ok {
+		return ""
+	}
+	return value.FloatString(10)
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"time"
+
+	"github.com/Pijuyy/testing_project4/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// StockChange describes a change to a product's stock at a warehouse.
+// VariantID is set when the stock belongs to one of the product's variants.
+// Quantity is signed: negative values take items out of stock.
+type StockChange struct {
+	ProductID     uint
+	VariantID     *uint
+	WarehouseID   uint
+	Type          string
+	Quantity      int
+	Reason        string
+	ActorID       *uint
+	TransactionID *uint
+}
+
+// ApplyStockChange atomically applies a stock change to a product's level at
+// a warehouse, keeps the variant's and product's total stock in step and
+// records the change as an inventory movement. Stock never goes below zero;
+// such changes fail with ErrInsufficientStock. Changes to a product with
+// variants must name one of them, or they fail with ErrVariantRequired.
+// Stock is not editable through the product, so its version is left alone and
+// admin edits are not rejected because of purchases. Users who wishlisted the
+// product are notified when it comes back in stock.
+func ApplyStockChange(tx *gorm.DB, change StockChange) (*models.InventoryMovement, error) {
+	variantID := variantIDOrZero(change.VariantID)
+
+	// Products with variants hold all their sellable stock in the variants
+	if change.VariantID == nil {
+		hasVariants, err := HasVariants(tx, change.ProductID)
+		if err != nil {
+			return nil, err
+		}
+		if hasVariants {
+			return nil, ErrVariantRequired
+		}
+	}
+
+	if change.Quantity < 0 {
+		result := tx.Model(&models.WarehouseStock{}).
+			Where("warehouse_id = ? AND product_id = ? AND variant_id = ? AND quantity >= ?",
+				change.WarehouseID, change.ProductID, variantID, -change.Quantity).
+			Updates(map[string]interface{}{
+				"quantity":   gorm.Expr("quantity + ?", change.Quantity),
+				"updated_at": time.Now(),
+			})
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil, ErrInsufficientStock
+		}
+	} else {
+		level := models.WarehouseStock{
+			WarehouseID: change.WarehouseID,
+			ProductID:   change.ProductID,
+			VariantID:   variantID,
+			Quantity:    change.Quantity,
+		}
+		err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "warehouse_id"}, {Name: "product_id"}, {Name: "variant_id"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"quantity":   gorm.Expr("warehouse_stocks.quantity + ?", change.Quantity),
+				"updated_at": time.Now(),
+			}),
+		}).Create(&level).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Transfers move stock between warehouses without changing the total
+	if change.Type != models.MovementTransfer && change.VariantID != nil {
+		query := tx.Model(&models.ProductVariant{}).Where("id = ? AND product_id = ?", variantID, change.ProductID)
+		if change.Type == models.MovementSale {
+			query = query.Where("stock - reserved >= ?", -change.Quantity)
+		}
+		result := query.Update("stock", gorm.Expr("stock + ?", change.Quantity))
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 0 && change.Type == models.MovementSale {
+			return nil, ErrInsufficientStock
+		} else if result.RowsAffected == 0 {
+			return nil, gorm.ErrRecordNotFound
+		}
+	}
+	if change.Type != models.MovementTransfer {
+		query := tx.Model(&models.Product{}).Where("id = ?", change.ProductID)
+		if change.Type == models.MovementSale {
+			// Sales may not take stock held by other customers' reservations
+			query = query.Where("stock - reserved >= ?", -change.Quantity)
+		}
+		result := query.Update("stock", gorm.Expr("stock + ?", change.Quantity))
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 0 && change.Type == models.MovementSale {
+			return nil, ErrInsufficientStock
+		} else if result.RowsAffected == 0 {
+			return nil, gorm.ErrRecordNotFound
+		}
+	}
+
+	// The row is locked by the update, so the stock read back is our own
+	var product models.Product
+	if err := tx.Select("id", "stock").First(&product, change.ProductID).Error; err != nil {
+		return nil, err
+	}
+
+	movement := models.InventoryMovement{
+		ProductID:     change.ProductID,
+		VariantID:     change.VariantID,
+		WarehouseID:   &change.WarehouseID,
+		Type:          change.Type,
+		Quantity:      change.Quantity,
+		StockAfter:    product.Stock,
+		Reason:        change.Reason,
+		ActorID:       change.ActorID,
+		TransactionID: change.TransactionID,
+	}
+	if err := tx.Create(&movement).Error; err != nil {
+		return nil, err
+	}
+
+	// Transfers only move stock between warehouses
+	if change.Type != models.MovementTransfer {
+		if err := NotifyBackInStock(tx, change.ProductID, change.Quantity); err != nil {
+			return nil, err
+		}
+	}
+
+	return &movement, nil
+}
+
+// RaiseStockAlert records an alert when a movement takes a product's stock
+// across its low-stock threshold or to zero. It returns nil when no threshold
+// was crossed. The alert should be passed to NotifyStockAlerts after commit.
+func RaiseStockAlert(tx *gorm.DB, movement *models.InventoryMovement) (*models.StockAlert, error) {
+	if movement.Quantity >= 0 {
+		return nil, nil
+	}
+
+	var product models.Product
+	if err := tx.Select("id", "title", "low_stock_threshold").First(&product, movement.ProductID).Error; err != nil {
+		return nil, err
+	}
+
+	before := movement.StockAfter - movement.Quantity
+	after := movement.StockAfter
+
+	var alertType string
+	switch {
+	case after == 0:
+		alertType = models.StockAlertOutOfStock
+	case before > product.LowStockThreshold && after <= product.LowStockThreshold:
+		alertType = models.StockAlertLowStock
+	default:
+		return nil, nil
+	}
+
+	alert := models.StockAlert{
+		ProductID:     product.ID,
+		ProductTitle:  product.Title,
+		Type:          alertType,
+		Stock:         after,
+		Threshold:     product.LowStockThreshold,
+		MovementID:    movement.ID,
+		TransactionID: movement.TransactionID,
+	}
+	if err := tx.Create(&alert).Error; err != nil {
+		return nil, err
+	}
+
+	return &alert, nil
+}
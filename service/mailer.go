@@ -0,0 +1,20 @@
+package service
+
+import "log"
+
+// Mailer sends transactional emails such as address verification links.
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// LogMailer writes emails to the application log instead of delivering them.
+// It is the default until a real email provider is configured.
+type LogMailer struct{}
+
+func (LogMailer) Send(to, subject, body string) error {
+	log.Printf("email to=%s subject=%q body=%q", to, subject, body)
+	return nil
+}
+
+// DefaultMailer is used by the controllers to send emails.
+var DefaultMailer Mailer = LogMailer{}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/Pijuyy/testing_project4/models"
+)
+
+// Notifier pushes stock alerts to the people who restock products.
+type Notifier interface {
+	NotifyStockAlert(alert models.StockAlert) error
+}
+
+// LogNotifier writes alerts to the application log.
+type LogNotifier struct{}
+
+func (LogNotifier) NotifyStockAlert(alert models.StockAlert) error {
+	log.Printf("stock alert type=%s product=%d title=%q stock=%d threshold=%d",
+		alert.Type, alert.ProductID, alert.ProductTitle, alert.Stock, alert.Threshold)
+	return nil
+}
+
+// WebhookNotifier posts alerts as JSON to a URL.
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+func (n WebhookNotifier) NotifyStockAlert(alert models.StockAlert) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"id":             alert.ID,
+		"type":           alert.Type,
+		"product_id":     alert.ProductID,
+		"product_title":  alert.ProductTitle,
+		"stock":          alert.Stock,
+		"threshold":      alert.Threshold,
+		"transaction_id": alert.TransactionID,
+		"created_at":     alert.CreatedAt.Format(time.RFC3339),
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := n.Client.Post(n.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return nil
+}
+
+// DefaultNotifier is used to deliver stock alerts. Alerts are posted to
+// STOCK_ALERT_WEBHOOK_URL when it is set and logged otherwise.
+var DefaultNotifier Notifier = notifierFromEnv()
+
+func notifierFromEnv() Notifier {
+	if url := os.Getenv("STOCK_ALERT_WEBHOOK_URL"); url != "" {
+		return WebhookNotifier{URL: url, Client: &http.Client{Timeout: 10 * time.Second}}
+	}
+	return LogNotifier{}
+}
+
+// NotifyStockAlerts delivers alerts in the background once the transaction
+// that raised them has committed. Delivery failures are logged; the alerts
+// stay listable either way.
+func NotifyStockAlerts(alerts ...*models.StockAlert) {
+	for _, alert := range alerts {
+		if alert == nil {
+			continue
+		}
+		go func(alert models.StockAlert) {
+			if err := DefaultNotifier.NotifyStockAlert(alert); err != nil {
+				log.Printf("delivering stock alert %d: %v", alert.ID, err)
+			}
+		}(*alert)
+	}
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Pijuyy/testing_project4/models"
+	"gorm.io/gorm"
+)
+
+// ErrSaleUnavailable is returned when a purchase can no longer be made at the
+// sale price because the sale ended or sold out in the meantime.
+var ErrSaleUnavailable = errors.New("the sale has ended or sold out, please review the new price")
+
+// ErrScheduleOverlap is returned when a product would have two sales at once.
+var ErrScheduleOverlap = errors.New("the product already has a sale scheduled in this period")
+
+// ActivePriceSchedules returns the sale running now for each of the products
+// that has one. A product never has overlapping sales.
+func ActivePriceSchedules(tx *gorm.DB, productIDs []uint) (map[uint]models.PriceSchedule, error) {
+	var schedules []models.PriceSchedule
+	err := activeSchedules(tx, time.Now()).Where("product_id IN ?", productIDs).Find(&schedules).Error
+	if err != nil {
+		return nil, err
+	}
+
+	byProduct := make(map[uint]models.PriceSchedule, len(schedules))
+	for _, schedule := range schedules {
+		byProduct[schedule.ProductID] = schedule
+	}
+	return byProduct, nil
+}
+
+// EffectivePrice returns the price the product sells for now, and the sale
+// it comes from, which is nil when the regular price applies.
+func EffectivePrice(tx *gorm.DB, product models.Product) (models.Money, *models.PriceSchedule, error) {
+	schedules, err := ActivePriceSchedules(tx, []uint{product.ID})
+	if err != nil {
+		return models.Money{}, nil, err
+	}
+	schedule, ok := schedules[product.ID]
+	if !ok {
+		return product.Price, nil, nil
+	}
+	return schedule.SalePrice, &schedule, nil
+}
+
+// ClaimSaleQuantity counts the quantity against the sale's cap. It fails with
+// ErrSaleUnavailable when the sale is no longer running or the quantity would
+// exceed the cap; the check and the increment are a single update, so
+// concurrent purchases can't oversell the sale.
+func ClaimSaleQuantity(tx *gorm.DB, schedule *models.PriceSchedule, quantity int) error {
+	result := activeSchedules(tx, time.Now()).
+		Where("id = ? AND (quantity_cap IS NULL OR sold_quantity + ? <= quantity_cap)", schedule.ID, quantity).
+		Update("sold_quantity", gorm.Expr("sold_quantity + ?", quantity))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSaleUnavailable
+	}
+
+	schedule.SoldQuantity += quantity
+	return nil
+}
+
+// CreatePriceSchedule schedules a sale and records it in the product's price
+// history. It must run in a transaction.
+func CreatePriceSchedule(tx *gorm.DB, product models.Product, schedule *models.PriceSchedule) error {
+	// Lock the product so overlapping sales can't be created concurrently
+	if err := lockProduct(tx, product.ID); err != nil {
+		return err
+	}
+
+	var overlapping int64
+	err := tx.Model(&models.PriceSchedule{}).
+		Where("product_id = ? AND active = ? AND starts_at < ? AND ends_at > ?", product.ID, true, schedule.EndsAt, schedule.StartsAt).
+		Count(&overlapping).Error
+	if err != nil {
+		return err
+	}
+	if overlapping > 0 {
+		return ErrScheduleOverlap
+	}
+
+	if err := tx.Create(schedule).Error; err != nil {
+		return err
+	}
+
+	return RecordPriceChange(tx, models.PriceChange{
+		ProductID:       product.ID,
+		Source:          models.PriceChangeScheduleCreated,
+		OldPrice:        product.Price,
+		NewPrice:        schedule.SalePrice,
+		PriceScheduleID: &schedule.ID,
+		EffectiveFrom:   &schedule.StartsAt,
+		EffectiveUntil:  &schedule.EndsAt,
+		ActorID:         schedule.CreatedBy,
+	})
+}
+
+// CancelPriceSchedule stops a sale, whether or not it has started, and
+// records it in the product's price history.
+func CancelPriceSchedule(tx *gorm.DB, product models.Product, schedule *models.PriceSchedule, actorID *uint) error {
+	result := tx.Model(schedule).Where("active = ?", true).Update("active", false)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("the sale has already been cancelled")
+	}
+	schedule.Active = false
+
+	now := time.Now()
+	return RecordPriceChange(tx, models.PriceChange{
+		ProductID:       product.ID,
+		Source:          models.PriceChangeScheduleCancelled,
+		OldPrice:        schedule.SalePrice,
+		NewPrice:        product.Price,
+		PriceScheduleID: &schedule.ID,
+		EffectiveFrom:   &now,
+		ActorID:         actorID,
+	})
+}
+
+// RecordPriceChange adds an entry to a product's price history.
+func RecordPriceChange(tx *gorm.DB, change models.PriceChange) error {
+	return tx.Create(&change).Error
+}
+
+// RecordManualPriceChange records an edit of the regular price, if the
+// price changed.
+func RecordManualPriceChange(tx *gorm.DB, before, after models.Product, source string, actorID *uint) error {
+	if before.Price == after.Price {
+		return nil
+	}
+	now := time.Now()
+	return RecordPriceChange(tx, models.PriceChange{
+		ProductID:     after.ID,
+		Source:        source,
+		OldPrice:      before.Price,
+		NewPrice:      after.Price,
+		EffectiveFrom: &now,
+		ActorID:       actorID,
+	})
+}
+
+// activeSchedules selects the sales running at the given time that have not
+// sold out.
+func activeSchedules(tx *gorm.DB, now time.Time) *gorm.DB {
+	return tx.Model(&models.PriceSchedule{}).
+		Where("active = ? AND starts_at <= ? AND ends_at > ?", true, now, now).
+		Where("quantity_cap IS NULL OR sold_quantity < quantity_cap")
+}
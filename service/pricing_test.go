@@ -0,0 +1,42 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Pijuyy/testing_project4/models"
+	"gorm.io/gorm"
+)
+
+func TestClaimSaleQuantityInParallel(t *testing.T) {
+	db := testDB(t)
+	product := createTestProduct(t, db, 50)
+	quantityCap := 10
+	schedule := models.PriceSchedule{
+		ProductID:   product.ID,
+		SalePrice:   models.Rupiah(5000),
+		StartsAt:    time.Now().Add(-time.Hour),
+		EndsAt:      time.Now().Add(time.Hour),
+		QuantityCap: &quantityCap,
+		Active:      true,
+	}
+	if err := db.Create(&schedule).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// Three purchases of 3 fit under the cap of 10, a fourth doesn't
+	errs := inParallel(db, 12, func(tx *gorm.DB, i int) error {
+		claimed := schedule
+		return ClaimSaleQuantity(tx, &claimed, 3)
+	})
+	if claimed, refused := countErrors(t, errs, ErrSaleUnavailable); claimed != 3 || refused != 9 {
+		t.Errorf("%d claimed and %d refused, want 3 and 9", claimed, refused)
+	}
+
+	if err := db.First(&schedule, schedule.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if schedule.SoldQuantity != 9 {
+		t.Errorf("sold quantity = %d, want 9", schedule.SoldQuantity)
+	}
+}
@@ -0,0 +1,268 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"net/http"
+
+	"github.com/Pijuyy/testing_project4/models"
+	"github.com/Pijuyy/testing_project4/storage"
+	"gorm.io/gorm"
+)
+
+const (
+	// MaxImageSize is the largest image file accepted for upload.
+	MaxImageSize = 5 << 20
+	// MaxImagePixels limits the decoded size of an image.
+	MaxImagePixels = 40_000_000
+	// ThumbnailSize is the longest side of a generated thumbnail.
+	ThumbnailSize = 320
+)
+
+// ImageContentTypes maps the accepted image types to their file extension.
+var ImageContentTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// ErrUnsupportedImage is returned for files that are not a JPEG, PNG or GIF image.
+var ErrUnsupportedImage = errors.New("image must be a JPEG, PNG or GIF file")
+
+// SaveProductImage checks an uploaded image by its content, stores it along
+// with a thumbnail and records it as the product's last image. The first image
+// of a product becomes its primary image. recorded is called in the same
+// transaction once the image is recorded, e.g. to audit it.
+func SaveProductImage(db *gorm.DB, store storage.Storage, productID uint, data []byte, recorded func(tx *gorm.DB, productImage *models.ProductImage) error) (*models.ProductImage, error) {
+	// The declared content type is not trusted, the data is sniffed instead
+	contentType := http.DetectContentType(data)
+	ext, ok := ImageContentTypes[contentType]
+	if !ok {
+		return nil, ErrUnsupportedImage
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+	if config.Width*config.Height > MaxImagePixels {
+		return nil, fmt.Errorf("image must not be larger than %d pixels", MaxImagePixels)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+
+	thumbnail, err := encodeImage(Thumbnail(img, ThumbnailSize), contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := randomName()
+	if err != nil {
+		return nil, err
+	}
+	productImage := models.ProductImage{
+		ProductID:    productID,
+		Key:          fmt.Sprintf("products/%d/%s%s", productID, name, ext),
+		ThumbnailKey: fmt.Sprintf("products/%d/%s_thumb%s", productID, name, ext),
+		ContentType:  contentType,
+		Size:         len(data),
+		Width:        config.Width,
+		Height:       config.Height,
+	}
+
+	ctx := context.Background()
+	if err := store.Put(ctx, productImage.Key, data, contentType); err != nil {
+		return nil, err
+	}
+	if err := store.Put(ctx, productImage.ThumbnailKey, thumbnail, contentType); err != nil {
+		DeleteImageFiles(store, productImage)
+		return nil, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Lock the product so concurrent uploads get distinct positions
+		if err := tx.Exec("SELECT id FROM products WHERE id = ? FOR UPDATE", productID).Error; err != nil {
+			return err
+		}
+
+		var last struct {
+			Count    int
+			Position int
+		}
+		err := tx.Model(&models.ProductImage{}).Where("product_id = ?", productID).
+			Select("COUNT(*) AS count, COALESCE(MAX(position), 0) AS position").Scan(&last).Error
+		if err != nil {
+			return err
+		}
+
+		productImage.Position = last.Position + 1
+		productImage.IsPrimary = last.Count == 0
+		if err := tx.Create(&productImage).Error; err != nil {
+			return err
+		}
+		return recorded(tx, &productImage)
+	})
+	if err != nil {
+		// Don't leave files behind for an image that was never recorded
+		DeleteImageFiles(store, productImage)
+		return nil, err
+	}
+
+	return &productImage, nil
+}
+
+// DeleteImageFiles removes an image and its thumbnail from storage. Failures
+// are only logged, as the image is no longer referenced.
+func DeleteImageFiles(store storage.Storage, productImage models.ProductImage) {
+	for _, key := range []string{productImage.Key, productImage.ThumbnailKey} {
+		if err := store.Delete(context.Background(), key); err != nil {
+			log.Printf("Error deleting image file %s: %v", key, err)
+		}
+	}
+}
+
+// ReorderProductImages sets the positions of a product's images to the order
+// of ids, which must list every image of the product exactly once.
+func ReorderProductImages(tx *gorm.DB, productID uint, ids []uint) error {
+	var existing []uint
+	if err := tx.Model(&models.ProductImage{}).Where("product_id = ?", productID).Pluck("id", &existing).Error; err != nil {
+		return err
+	}
+
+	seen := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		seen[id] = true
+	}
+	if len(ids) != len(existing) || len(seen) != len(existing) {
+		return errors.New("image_ids must list every image of the product exactly once")
+	}
+	for _, id := range existing {
+		if !seen[id] {
+			return errors.New("image_ids must list every image of the product exactly once")
+		}
+	}
+
+	for i, id := range ids {
+		err := tx.Model(&models.ProductImage{}).Where("id = ?", id).Update("position", i+1).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetPrimaryImage makes the image the product's only primary image.
+func SetPrimaryImage(tx *gorm.DB, productImage *models.ProductImage) error {
+	err := tx.Model(&models.ProductImage{}).
+		Where("product_id = ? AND id <> ?", productImage.ProductID, productImage.ID).
+		Update("is_primary", false).Error
+	if err != nil {
+		return err
+	}
+
+	productImage.IsPrimary = true
+	return tx.Model(productImage).Update("is_primary", true).Error
+}
+
+// DeleteProductImage removes an image record. When it was the primary image,
+// the next image in order becomes primary.
+func DeleteProductImage(tx *gorm.DB, productImage *models.ProductImage) error {
+	if err := tx.Delete(productImage).Error; err != nil {
+		return err
+	}
+	if !productImage.IsPrimary {
+		return nil
+	}
+
+	var next models.ProductImage
+	err := tx.Where("product_id = ?", productImage.ProductID).Order("position, id").First(&next).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return SetPrimaryImage(tx, &next)
+}
+
+// Thumbnail scales img down so that its longest side is at most size pixels,
+// averaging the source pixels covered by each thumbnail pixel. Images that
+// already fit are returned unchanged.
+func Thumbnail(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= size && height <= size {
+		return img
+	}
+
+	thumbWidth, thumbHeight := size, size
+	if width > height {
+		thumbHeight = max(height*size/width, 1)
+	} else {
+		thumbWidth = max(width*size/height, 1)
+	}
+
+	thumb := image.NewNRGBA(image.Rect(0, 0, thumbWidth, thumbHeight))
+	for y := 0; y < thumbHeight; y++ {
+		y0 := bounds.Min.Y + y*height/thumbHeight
+		y1 := max(bounds.Min.Y+(y+1)*height/thumbHeight, y0+1)
+		for x := 0; x < thumbWidth; x++ {
+			x0 := bounds.Min.X + x*width/thumbWidth
+			x1 := max(bounds.Min.X+(x+1)*width/thumbWidth, x0+1)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+
+			// Colours are premultiplied by alpha, so they are averaged before
+			// converting back to non-premultiplied values
+			thumb.Set(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(b / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+	return thumb
+}
+
+func encodeImage(img image.Image, contentType string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch contentType {
+	case "image/jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85})
+	case "image/png":
+		err = png.Encode(&buf, img)
+	case "image/gif":
+		err = gif.Encode(&buf, img, nil)
+	default:
+		err = ErrUnsupportedImage
+	}
+	return buf.Bytes(), err
+}
+
+func randomName() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
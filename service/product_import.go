@@ -0,0 +1,380 @@
+package service
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Pijuyy/testing_project4/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Import modes.
+const (
+	// ImportAtomic commits the import only if every row is valid.
+	ImportAtomic = "atomic"
+	// ImportBestEffort commits the valid rows and reports the others.
+	ImportBestEffort = "best_effort"
+)
+
+// Import row actions.
+const (
+	ImportCreated   = "created"
+	ImportUpdated   = "updated"
+	ImportUnchanged = "unchanged"
+	ImportFailed    = "failed"
+)
+
+// ProductCSVColumns are the columns written by ExportProducts. Imports accept
+// the same columns; id is ignored and either category_id or category (a
+// category type or ID) identifies the category.
+var ProductCSVColumns = []string{"id", "sku", "title", "price", "stock", "category_id", "category", "low_stock_threshold"}
+
+// ImportOptions controls how ImportProducts applies a CSV file.
+type ImportOptions struct {
+	Mode   string
+	DryRun bool
+	// Actor is recorded in the audit log, nil for CLI imports.
+	Actor *models.User
+	// Request is used for the audit log, nil for CLI imports.
+	Request *http.Request
+	// CanAdjustStock allows rows to change the stock of existing products.
+	CanAdjustStock bool
+}
+
+// ImportRowResult reports what happened to one CSV row. Row numbers count
+// the header as row 1.
+type ImportRowResult struct {
+	Row       int    `json:"row"`
+	SKU       string `json:"sku,omitempty"`
+	Action    string `json:"action"`
+	ProductID uint   `json:"product_id,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ImportResult summarises an import. Committed is false for dry runs and for
+// atomic imports that had invalid rows.
+type ImportResult struct {
+	Mode      string            `json:"mode"`
+	DryRun    bool              `json:"dry_run"`
+	Committed bool              `json:"committed"`
+	Created   int               `json:"created"`
+	Updated   int               `json:"updated"`
+	Unchanged int               `json:"unchanged"`
+	Failed    int               `json:"failed"`
+	Rows      []ImportRowResult `json:"rows"`
+}
+
+// ErrInvalidCSV is returned when a CSV file cannot be imported at all, e.g.
+// because of a missing column. Row-level problems are reported in the result.
+var ErrInvalidCSV = errors.New("invalid CSV")
+
+// errRollback rolls back an import transaction that should not be committed.
+var errRollback = errors.New("rollback")
+
+// ImportProducts creates products from CSV rows, updating the product with the
+// same SKU when there is one. Each row is applied in its own savepoint, so a
+// failing row never leaves partial changes behind.
+func ImportProducts(db *gorm.DB, r io.Reader, opts ImportOptions) (*ImportResult, error) {
+	if opts.Mode == "" {
+		opts.Mode = ImportAtomic
+	}
+	if opts.Mode != ImportAtomic && opts.Mode != ImportBestEffort {
+		return nil, fmt.Errorf("%w: mode must be %s or %s", ErrInvalidCSV, ImportAtomic, ImportBestEffort)
+	}
+
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: reading header: %v", ErrInvalidCSV, err)
+	}
+	columns, err := parseImportHeader(header)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ImportResult{Mode: opts.Mode, DryRun: opts.DryRun, Rows: []ImportRowResult{}}
+	importer := productImporter{opts: opts, columns: columns, categories: make(map[string]uint)}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for row := 2; ; row++ {
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+
+			rowResult := ImportRowResult{Row: row}
+			if err != nil {
+				rowResult.Action = ImportFailed
+				rowResult.Error = err.Error()
+			} else {
+				err = tx.Transaction(func(rowTx *gorm.DB) error {
+					return importer.importRow(rowTx, record, &rowResult)
+				})
+				if err != nil {
+					rowResult.Action = ImportFailed
+					rowResult.Error = err.Error()
+				}
+			}
+
+			switch rowResult.Action {
+			case ImportCreated:
+				result.Created++
+			case ImportUpdated:
+				result.Updated++
+			case ImportUnchanged:
+				result.Unchanged++
+			case ImportFailed:
+				result.Failed++
+			}
+			result.Rows = append(result.Rows, rowResult)
+		}
+
+		if opts.DryRun || (opts.Mode == ImportAtomic && result.Failed > 0) {
+			return errRollback
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errRollback) {
+		return nil, err
+	}
+
+	result.Committed = err == nil
+	return result, nil
+}
+
+func parseImportHeader(header []string) (map[string]int, error) {
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !slices.Contains(ProductCSVColumns, name) {
+			return nil, fmt.Errorf("%w: unknown column %q", ErrInvalidCSV, name)
+		}
+		if _, ok := columns[name]; ok {
+			return nil, fmt.Errorf("%w: duplicate column %q", ErrInvalidCSV, name)
+		}
+		columns[name] = i
+	}
+
+	for _, required := range []string{"title", "price", "stock"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("%w: missing column %q", ErrInvalidCSV, required)
+		}
+	}
+	_, hasCategoryID := columns["category_id"]
+	_, hasCategory := columns["category"]
+	if !hasCategoryID && !hasCategory {
+		return nil, fmt.Errorf("%w: missing column \"category_id\" or \"category\"", ErrInvalidCSV)
+	}
+
+	return columns, nil
+}
+
+type productImporter struct {
+	opts       ImportOptions
+	columns    map[string]int
+	categories map[string]uint
+}
+
+func (im *productImporter) value(record []string, column string) string {
+	i, ok := im.columns[column]
+	if !ok || i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
+
+func (im *productImporter) intValue(record []string, column string) (int, error) {
+	value, err := strconv.Atoi(im.value(record, column))
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a whole number", column)
+	}
+	return value, nil
+}
+
+// categoryID resolves the row's category by ID or by type.
+func (im *productImporter) categoryID(tx *gorm.DB, record []string) (uint, error) {
+	key := im.value(record, "category_id")
+	if key == "" {
+		key = im.value(record, "category")
+	}
+	if key == "" {
+		return 0, errors.New("category is required")
+	}
+	if id, ok := im.categories[key]; ok {
+		return id, nil
+	}
+
+	var category models.Category
+	var query *gorm.DB
+	if id, err := strconv.Atoi(key); err == nil {
+		query = tx.Where("id = ?", id)
+	} else {
+		query = tx.Where("type = ?", key)
+	}
+	if err := query.Order("id").First(&category).Error; err != nil {
+		return 0, fmt.Errorf("category %q not found", key)
+	}
+
+	im.categories[key] = category.ID
+	return category.ID, nil
+}
+
+func (im *productImporter) importRow(tx *gorm.DB, record []string, result *ImportRowResult) error {
+	sku := models.NormalizeSKU(im.value(record, "sku"))
+	if sku != nil {
+		result.SKU = *sku
+	}
+
+	price, err := im.intValue(record, "price")
+	if err != nil {
+		return err
+	}
+	stock, err := im.intValue(record, "stock")
+	if err != nil {
+		return err
+	}
+	categoryID, err := im.categoryID(tx, record)
+	if err != nil {
+		return err
+	}
+
+	var existing models.Product
+	found := false
+	if sku != nil {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("sku = ?", *sku).First(&existing).Error
+		if err == nil {
+			found = true
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+	}
+
+	product := existing
+	product.Title = im.value(record, "title")
+	product.Price = models.Rupiah(int64(price))
+	product.CategoryID = categoryID
+	product.SKU = sku
+	if !found {
+		product.Stock = stock
+		product.LowStockThreshold = 5
+	}
+	if im.value(record, "low_stock_threshold") != "" {
+		if product.LowStockThreshold, err = im.intValue(record, "low_stock_threshold"); err != nil {
+			return err
+		}
+	}
+
+	if !found {
+		warehouse, err := FindWarehouse(tx, 0)
+		if err != nil {
+			return err
+		}
+		if err := CreateProduct(tx, &product, warehouse.ID, actorID(im.opts.Actor)); err != nil {
+			return err
+		}
+		result.Action = ImportCreated
+		result.ProductID = product.ID
+		return RecordAudit(tx, im.opts.Request, im.opts.Actor, "product.create", "product", product.ID, nil, product)
+	}
+
+	result.ProductID = existing.ID
+	if err := product.Validate(); err != nil {
+		return err
+	}
+
+	changed := product.Title != existing.Title || product.Price != existing.Price ||
+		product.CategoryID != existing.CategoryID || product.LowStockThreshold != existing.LowStockThreshold
+	if changed {
+		if err := UpdateProduct(tx, &product); err != nil {
+			return err
+		}
+		if err := RecordManualPriceChange(tx, existing, product, models.PriceChangeImport, actorID(im.opts.Actor)); err != nil {
+			return err
+		}
+	}
+
+	// Stock differences are booked as a correction at the default warehouse
+	if delta := stock - existing.Stock; delta != 0 {
+		if !im.opts.CanAdjustStock {
+			return errors.New("changing the stock of an existing product requires the inventory:adjust permission")
+		}
+		warehouse, err := FindWarehouse(tx, 0)
+		if err != nil {
+			return err
+		}
+		movement, err := ApplyStockChange(tx, StockChange{
+			ProductID:   product.ID,
+			WarehouseID: warehouse.ID,
+			Type:        models.MovementCorrection,
+			Quantity:    delta,
+			Reason:      "CSV import",
+			ActorID:     actorID(im.opts.Actor),
+		})
+		if errors.Is(err, ErrInsufficientStock) {
+			return errors.New("the default warehouse does not hold enough stock to lower it")
+		} else if err != nil {
+			return err
+		}
+		product.Stock = movement.StockAfter
+		changed = true
+	}
+
+	if !changed {
+		result.Action = ImportUnchanged
+		return nil
+	}
+
+	result.Action = ImportUpdated
+	return RecordAudit(tx, im.opts.Request, im.opts.Actor, "product.update", "product", product.ID, existing, product)
+}
+
+func actorID(actor *models.User) *uint {
+	if actor == nil {
+		return nil
+	}
+	return &actor.ID
+}
+
+// ExportProducts writes the whole catalogue as CSV in the format accepted by
+// ImportProducts.
+func ExportProducts(db *gorm.DB, w io.Writer) error {
+	var products []models.Product
+	if err := db.Preload("Category").Order("id").Find(&products).Error; err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(ProductCSVColumns); err != nil {
+		return err
+	}
+	for _, product := range products {
+		sku := ""
+		if product.SKU != nil {
+			sku = *product.SKU
+		}
+		err := writer.Write([]string{
+			strconv.FormatUint(uint64(product.ID), 10),
+			sku,
+			product.Title,
+			strconv.FormatInt(product.Price.Amount, 10),
+			strconv.Itoa(product.Stock),
+			strconv.FormatUint(uint64(product.CategoryID), 10),
+			product.Category.Type,
+			strconv.Itoa(product.LowStockThreshold),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
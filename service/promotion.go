@@ -0,0 +1,147 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Pijuyy/testing_project4/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrPromotionNotFound is returned for unknown promo codes.
+var ErrPromotionNotFound = errors.New("Promo code not found")
+
+// ErrPromotionNotApplicable is returned when a promo code cannot be applied
+// to a purchase. The wrapping error says why.
+var ErrPromotionNotApplicable = errors.New("promo code cannot be applied")
+
+// NormalizePromoCode makes promo codes case-insensitive.
+func NormalizePromoCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// FindPromotion loads a promotion by its code.
+func FindPromotion(tx *gorm.DB, code string) (*models.Promotion, error) {
+	var promotion models.Promotion
+	err := tx.Where("code = ?", NormalizePromoCode(code)).First(&promotion).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrPromotionNotFound
+	}
+	return &promotion, err
+}
+
+// CheckPromotion checks that the promotion applies to the user buying the
+// product for the subtotal, and returns the discount.
+func CheckPromotion(tx *gorm.DB, promotion *models.Promotion, userID uint, product models.Product, subtotal models.Money) (models.Money, error) {
+	now := time.Now()
+	switch {
+	case !promotion.Active:
+		return models.Money{}, fmt.Errorf("%w: the code is not active", ErrPromotionNotApplicable)
+	case promotion.StartsAt != nil && now.Before(*promotion.StartsAt):
+		return models.Money{}, fmt.Errorf("%w: the code is not valid yet", ErrPromotionNotApplicable)
+	case promotion.EndsAt != nil && !now.Before(*promotion.EndsAt):
+		return models.Money{}, fmt.Errorf("%w: the code has expired", ErrPromotionNotApplicable)
+	case subtotal.Amount < promotion.MinSpend.Amount:
+		return models.Money{}, fmt.Errorf("%w: the minimum spend is %s", ErrPromotionNotApplicable, promotion.MinSpend)
+	case promotion.ProductID != nil && *promotion.ProductID != product.ID:
+		return models.Money{}, fmt.Errorf("%w: the code does not apply to this product", ErrPromotionNotApplicable)
+	case promotion.UsageLimit != nil && promotion.UsedCount >= *promotion.UsageLimit:
+		return models.Money{}, fmt.Errorf("%w: the code has been used up", ErrPromotionNotApplicable)
+	}
+
+	if promotion.CategoryID != nil {
+		categoryIDs, err := NewCategoryService(tx).DescendantIDs(*promotion.CategoryID)
+		if err != nil {
+			return models.Money{}, err
+		}
+		if !slices.Contains(categoryIDs, product.CategoryID) {
+			return models.Money{}, fmt.Errorf("%w: the code does not apply to this category", ErrPromotionNotApplicable)
+		}
+	}
+
+	if promotion.PerUserLimit != nil {
+		var used int64
+		err := tx.Model(&models.PromotionRedemption{}).
+			Where("promotion_id = ? AND user_id = ?", promotion.ID, userID).
+			Count(&used).Error
+		if err != nil {
+			return models.Money{}, err
+		}
+		if used >= int64(*promotion.PerUserLimit) {
+			return models.Money{}, fmt.Errorf("%w: you have already used this code", ErrPromotionNotApplicable)
+		}
+	}
+
+	return promotion.Discount(subtotal)
+}
+
+// RedeemPromotion locks the promotion, checks it still applies and counts the
+// use. Every redemption of a code locks the same row, so usage limits hold
+// under concurrent purchases. It must run in a transaction; the redemption is
+// recorded with RecordRedemption once the transaction exists.
+func RedeemPromotion(tx *gorm.DB, code string, userID uint, product models.Product, subtotal models.Money) (*models.Promotion, models.Money, error) {
+	var promotion models.Promotion
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("code = ?", NormalizePromoCode(code)).First(&promotion).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, models.Money{}, ErrPromotionNotFound
+	} else if err != nil {
+		return nil, models.Money{}, err
+	}
+
+	discount, err := CheckPromotion(tx, &promotion, userID, product, subtotal)
+	if err != nil {
+		return nil, models.Money{}, err
+	}
+
+	err = tx.Model(&promotion).Update("used_count", gorm.Expr("used_count + 1")).Error
+	if err != nil {
+		return nil, models.Money{}, err
+	}
+	promotion.UsedCount++
+
+	return &promotion, discount, nil
+}
+
+// RecordRedemption records the promotion as applied to the transaction.
+func RecordRedemption(tx *gorm.DB, promotion *models.Promotion, transaction *models.TransactionHistory) error {
+	return tx.Create(&models.PromotionRedemption{
+		PromotionID:   promotion.ID,
+		UserID:        transaction.UserID,
+		TransactionID: transaction.ID,
+		Discount:      transaction.Discount,
+	}).Error
+}
+
+// UpdatePromotion writes the promotion's settings if its version still
+// matches the one that was read, and bumps the version. The usage count is
+// left alone so concurrent redemptions are never overwritten.
+func UpdatePromotion(tx *gorm.DB, promotion *models.Promotion) error {
+	result := tx.Model(promotion).Where("version = ?", promotion.Version).Updates(map[string]interface{}{
+		"description":    promotion.Description,
+		"type":           promotion.Type,
+		"value":          promotion.Value,
+		"min_spend":      promotion.MinSpend,
+		"category_id":    promotion.CategoryID,
+		"product_id":     promotion.ProductID,
+		"starts_at":      promotion.StartsAt,
+		"ends_at":        promotion.EndsAt,
+		"usage_limit":    promotion.UsageLimit,
+		"per_user_limit": promotion.PerUserLimit,
+		"active":         promotion.Active,
+		"version":        gorm.Expr("version + 1"),
+		"updated_at":     promotion.UpdatedAt,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrVersionConflict
+	}
+
+	promotion.Version++
+	return nil
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Pijuyy/testing_project4/models"
+	"gorm.io/gorm"
+)
+
+func createTestPromotion(t *testing.T, db *gorm.DB, usageLimit, perUserLimit *int) models.Promotion {
+	t.Helper()
+	promotion := models.Promotion{
+		Code:         fmt.Sprintf("TEST%d", time.Now().UnixNano()),
+		Type:         models.PromotionFixed,
+		Value:        1000,
+		UsageLimit:   usageLimit,
+		PerUserLimit: perUserLimit,
+		Active:       true,
+	}
+	if err := db.Create(&promotion).Error; err != nil {
+		t.Fatal(err)
+	}
+	return promotion
+}
+
+func TestRedeemPromotionUsageLimitInParallel(t *testing.T) {
+	db := testDB(t)
+	product := createTestProduct(t, db, 10)
+	limit := 5
+	promotion := createTestPromotion(t, db, &limit, nil)
+
+	errs := inParallel(db, 20, func(tx *gorm.DB, i int) error {
+		_, _, err := RedeemPromotion(tx, promotion.Code, uint(i+1), product, models.Rupiah(50000))
+		return err
+	})
+	if redeemed, refused := countErrors(t, errs, ErrPromotionNotApplicable); redeemed != 5 || refused != 15 {
+		t.Errorf("%d redeemed and %d refused, want 5 and 15", redeemed, refused)
+	}
+
+	if err := db.First(&promotion, promotion.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if promotion.UsedCount != 5 {
+		t.Errorf("used count = %d, want 5", promotion.UsedCount)
+	}
+}
+
+func TestRedeemPromotionPerUserLimitInParallel(t *testing.T) {
+	db := testDB(t)
+	product := createTestProduct(t, db, 10)
+	limit := 2
+	promotion := createTestPromotion(t, db, nil, &limit)
+
+	// One user checks out with the code many times at once
+	errs := inParallel(db, 10, func(tx *gorm.DB, i int) error {
+		redeemed, discount, err := RedeemPromotion(tx, promotion.Code, 1, product, models.Rupiah(50000))
+		if err != nil {
+			return err
+		}
+		return RecordRedemption(tx, redeemed, &models.TransactionHistory{ID: uint(i + 1), UserID: 1, Discount: discount})
+	})
+	if redeemed, refused := countErrors(t, errs, ErrPromotionNotApplicable); redeemed != 2 || refused != 8 {
+		t.Errorf("%d redeemed and %d refused, want 2 and 8", redeemed, refused)
+	}
+
+	var redemptions int64
+	db.Model(&models.PromotionRedemption{}).Where("promotion_id = ?", promotion.ID).Count(&redemptions)
+	if redemptions != 2 {
+		t.Errorf("%d redemptions, want 2", redemptions)
+	}
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Pijuyy/testing_project4/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const defaultReservationTTL = 15 * time.Minute
+
+// ReservationTTL is how long a reservation holds stock. It is read from
+// RESERVATION_TTL as a Go duration such as "10m" and defaults to 15 minutes.
+var ReservationTTL = reservationTTLFromEnv()
+
+func reservationTTLFromEnv() time.Duration {
+	value := os.Getenv("RESERVATION_TTL")
+	if value == "" {
+		return defaultReservationTTL
+	}
+
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl <= 0 {
+		log.Printf("invalid RESERVATION_TTL %q, using %s", value, defaultReservationTTL)
+		return defaultReservationTTL
+	}
+	return ttl
+}
+
+// ReserveStock holds quantity items of a product, or of one of its variants
+// when variantID is not nil, for a user. The hold is only taken if that much
+// stock is still available, checked in the same statement that takes it, so
+// concurrent reservations cannot oversell.
+func ReserveStock(tx *gorm.DB, userID, productID uint, variantID *uint, quantity int) (*models.Reservation, error) {
+	if quantity <= 0 {
+		return nil, errors.New("quantity is required and must be greater than 0")
+	}
+	if variantID == nil {
+		hasVariants, err := HasVariants(tx, productID)
+		if err != nil {
+			return nil, err
+		}
+		if hasVariants {
+			return nil, ErrVariantRequired
+		}
+	}
+
+	if variantID != nil {
+		result := tx.Model(&models.ProductVariant{}).
+			Where("id = ? AND product_id = ? AND stock - reserved >= ?", *variantID, productID, quantity).
+			Update("reserved", gorm.Expr("reserved + ?", quantity))
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil, ErrInsufficientStock
+		}
+	}
+
+	result := tx.Model(&models.Product{}).
+		Where("id = ? AND stock - reserved >= ?", productID, quantity).
+		Update("reserved", gorm.Expr("reserved + ?", quantity))
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInsufficientStock
+	}
+
+	reservation := models.Reservation{
+		UserID:    userID,
+		ProductID: productID,
+		VariantID: variantID,
+		Quantity:  quantity,
+		Status:    models.ReservationActive,
+		ExpiresAt: time.Now().Add(ReservationTTL),
+	}
+	if err := tx.Create(&reservation).Error; err != nil {
+		return nil, err
+	}
+
+	return &reservation, nil
+}
+
+// LockReservation loads a reservation and locks it until the transaction ends.
+func LockReservation(tx *gorm.DB, id uint) (*models.Reservation, error) {
+	var reservation models.Reservation
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&reservation, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &reservation, nil
+}
+
+// ReleaseReservation ends an active reservation with the given status and
+// returns its quantity to the product's availability. Only one caller can end
+// a reservation; the others get ErrReservationUnavailable. When converting a
+// reservation into a sale, transactionID links it to the purchase.
+func ReleaseReservation(tx *gorm.DB, reservation *models.Reservation, status string, transactionID *uint) error {
+	result := tx.Model(reservation).Where("status = ?", models.ReservationActive).Updates(map[string]interface{}{
+		"status":         status,
+		"transaction_id": transactionID,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrReservationUnavailable
+	}
+
+	if reservation.VariantID != nil {
+		err := tx.Model(&models.ProductVariant{}).Where("id = ?", *reservation.VariantID).
+			Update("reserved", gorm.Expr("GREATEST(reserved - ?, 0)", reservation.Quantity)).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	err := tx.Model(&models.Product{}).Where("id = ?", reservation.ProductID).
+		Update("reserved", gorm.Expr("GREATEST(reserved - ?, 0)", reservation.Quantity)).Error
+	if err != nil {
+		return err
+	}
+
+	// Converted reservations are sold right away, the others free their items
+	if status != models.ReservationConverted {
+		if err := NotifyBackInStock(tx, reservation.ProductID, reservation.Quantity); err != nil {
+			return err
+		}
+	}
+
+	reservation.Status = status
+	reservation.TransactionID = transactionID
+	return nil
+}
+
+// ExpireReservations releases every active reservation whose hold has run out
+// and returns how many were expired.
+func ExpireReservations(db *gorm.DB) (int, error) {
+	var reservations []models.Reservation
+	err := db.Where("status = ? AND expires_at <= ?", models.ReservationActive, time.Now()).
+		Order("id").Find(&reservations).Error
+	if err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for i := range reservations {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			return ReleaseReservation(tx, &reservations[i], models.ReservationExpired, nil)
+		})
+		// The reservation may have been converted or released in the meantime
+		if errors.Is(err, ErrReservationUnavailable) {
+			continue
+		} else if err != nil {
+			return expired, err
+		}
+		expired++
+	}
+
+	return expired, nil
+}
+
+// StartReservationSweeper expires stale reservations every interval until
+// the process exits.
+func StartReservationSweeper(db *gorm.DB, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			expired, err := ExpireReservations(db)
+			if err != nil {
+				log.Printf("expiring reservations: %v", err)
+			} else if expired > 0 {
+				log.Printf("expired %d reservations", expired)
+			}
+		}
+	}()
+}
@@ -0,0 +1,30 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/Pijuyy/testing_project4/models"
+	"gorm.io/gorm"
+)
+
+func TestReserveStockInParallel(t *testing.T) {
+	db := testDB(t)
+	product := createTestProduct(t, db, 10)
+
+	errs := inParallel(db, 25, func(tx *gorm.DB, i int) error {
+		_, err := ReserveStock(tx, uint(i+1), product.ID, nil, 1)
+		return err
+	})
+	if reserved, refused := countErrors(t, errs, ErrInsufficientStock); reserved != 10 || refused != 15 {
+		t.Errorf("%d reserved and %d refused, want 10 and 15", reserved, refused)
+	}
+
+	if err := db.First(&product, product.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	var active int64
+	db.Model(&models.Reservation{}).Where("product_id = ? AND status = ?", product.ID, models.ReservationActive).Count(&active)
+	if product.Reserved != 10 || product.Stock != 10 || active != 10 {
+		t.Errorf("stock %d, reserved %d, %d active reservations, want 10, 10 and 10", product.Stock, product.Reserved, active)
+	}
+}
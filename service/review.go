@@ -0,0 +1,168 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Pijuyy/testing_project4/models"
+	"gorm.io/gorm"
+)
+
+// HasPurchased reports whether the user has a transaction for the product.
+func HasPurchased(tx *gorm.DB, userID, productID uint) (bool, error) {
+	var count int64
+	err := tx.Model(&models.TransactionHistory{}).
+		Where("user_id = ? AND product_id = ?", userID, productID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// CreateReview records a verified buyer's review and updates the product's
+// rating. It must run in a transaction.
+func CreateReview(tx *gorm.DB, review *models.Review) error {
+	if err := lockProduct(tx, review.ProductID); err != nil {
+		return err
+	}
+
+	purchased, err := HasPurchased(tx, review.UserID, review.ProductID)
+	if err != nil {
+		return err
+	}
+	if !purchased {
+		return ErrNotVerifiedBuyer
+	}
+
+	var existing int64
+	err = tx.Model(&models.Review{}).Where("product_id = ? AND user_id = ?", review.ProductID, review.UserID).Count(&existing).Error
+	if err != nil {
+		return err
+	}
+	if existing > 0 {
+		return ErrAlreadyReviewed
+	}
+
+	if err := tx.Create(review).Error; err != nil {
+		return err
+	}
+	return refreshProductRating(tx, review.ProductID)
+}
+
+// UpdateReview writes the reviewer's fields if the version still matches the
+// one that was read, and updates the product's rating. It must run in a
+// transaction.
+func UpdateReview(tx *gorm.DB, review *models.Review) error {
+	if err := lockProduct(tx, review.ProductID); err != nil {
+		return err
+	}
+
+	result := tx.Model(review).Where("version = ?", review.Version).Updates(map[string]interface{}{
+		"rating":     review.Rating,
+		"title":      review.Title,
+		"body":       review.Body,
+		"version":    gorm.Expr("version + 1"),
+		"updated_at": review.UpdatedAt,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrVersionConflict
+	}
+
+	review.Version++
+	return refreshProductRating(tx, review.ProductID)
+}
+
+// DeleteReview deletes the review if its version still matches the one that
+// was read, and updates the product's rating. It must run in a transaction.
+func DeleteReview(tx *gorm.DB, review *models.Review) error {
+	if err := lockProduct(tx, review.ProductID); err != nil {
+		return err
+	}
+
+	result := tx.Where("version = ?", review.Version).Delete(review)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrVersionConflict
+	}
+
+	return refreshProductRating(tx, review.ProductID)
+}
+
+// SetReviewHidden hides a review with the moderator's reason, or shows it
+// again, and updates the product's rating. It must run in a transaction.
+func SetReviewHidden(tx *gorm.DB, review *models.Review, hidden bool, reason string, moderatorID uint) error {
+	if err := lockProduct(tx, review.ProductID); err != nil {
+		return err
+	}
+
+	review.Hidden = hidden
+	review.HiddenReason = ""
+	review.HiddenBy = nil
+	review.HiddenAt = nil
+	if hidden {
+		now := time.Now()
+		review.HiddenReason = reason
+		review.HiddenBy = &moderatorID
+		review.HiddenAt = &now
+	}
+
+	result := tx.Model(review).Where("version = ?", review.Version).Updates(map[string]interface{}{
+		"hidden":        review.Hidden,
+		"hidden_reason": review.HiddenReason,
+		"hidden_by":     review.HiddenBy,
+		"hidden_at":     review.HiddenAt,
+		"version":       gorm.Expr("version + 1"),
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrVersionConflict
+	}
+
+	review.Version++
+	return refreshProductRating(tx, review.ProductID)
+}
+
+// lockProduct locks the product row so changes to its reviews, and the
+// rating computed from them, are applied one at a time.
+func lockProduct(tx *gorm.DB, productID uint) error {
+	result := tx.Exec("SELECT id FROM products WHERE id = ? FOR UPDATE", productID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// refreshProductRating recomputes the product's rating from its visible reviews.
+func refreshProductRating(tx *gorm.DB, productID uint) error {
+	var rating struct {
+		Average float64
+		Count   int
+	}
+	err := tx.Model(&models.Review{}).
+		Select("COALESCE(ROUND(AVG(rating), 2), 0) AS average, COUNT(*) AS count").
+		Where("product_id = ? AND hidden = ?", productID, false).
+		Scan(&rating).Error
+	if err != nil {
+		return err
+	}
+
+	result := tx.Model(&models.Product{}).Where("id = ?", productID).Updates(map[string]interface{}{
+		"rating_average": rating.Average,
+		"rating_count":   rating.Count,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("product not found")
+	}
+	return nil
+}
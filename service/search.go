@@ -0,0 +1,123 @@
+package service
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/Pijuyy/testing_project4/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SearchSimilarityThreshold is the trigram word similarity a title needs to
+// match a misspelled query.
+const SearchSimilarityThreshold = 0.4
+
+// searchQuery is the full-text query built from the user's search terms.
+const searchQuery = "websearch_to_tsquery('simple', ?)"
+
+// highlightOptions wrap matched words in <mark> tags.
+const highlightOptions = "StartSel=<mark>, StopSel=</mark>"
+
+// CatalogueFilters narrow down the products listed or searched in the
+// catalogue. Zero values don't filter.
+type CatalogueFilters struct {
+	// CategoryIDs are the accepted categories, including subcategories.
+	// A nil slice accepts every category.
+	CategoryIDs []uint
+	MinPrice    *int
+	MaxPrice    *int
+}
+
+// Apply adds the filters to a query on products.
+func (f CatalogueFilters) Apply(query *gorm.DB) *gorm.DB {
+	if f.CategoryIDs != nil {
+		query = query.Where("products.category_id IN ?", f.CategoryIDs)
+	}
+	if f.MinPrice != nil {
+		query = query.Where("products.price >= ?", *f.MinPrice)
+	}
+	if f.MaxPrice != nil {
+		query = query.Where("products.price <= ?", *f.MaxPrice)
+	}
+	return query
+}
+
+// SearchHit is a product matching a search, with its matches highlighted.
+type SearchHit struct {
+	ProductID            uint
+	Rank                 float64
+	TitleHighlight       string
+	DescriptionHighlight string
+}
+
+// SearchProducts finds products whose title or description match the terms,
+// best matches first. Title matches weigh more than description matches, and
+// titles close to a misspelled term still match.
+func SearchProducts(db *gorm.DB, terms string, filters CatalogueFilters, offset, limit int) ([]SearchHit, int64, error) {
+	var hits []SearchHit
+	var total int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := setSimilarityThreshold(tx); err != nil {
+			return err
+		}
+
+		query := filters.Apply(tx.Model(&models.Product{}).
+			Where("products.search_vector @@ "+searchQuery+" OR ? <% products.title", terms, terms))
+		if err := query.Count(&total).Error; err != nil {
+			return err
+		}
+
+		return query.Select(
+			"products.id AS product_id, "+
+				"ts_rank(products.search_vector, "+searchQuery+") + word_similarity(?, products.title) AS rank, "+
+				"ts_headline('simple', products.title, "+searchQuery+", '"+highlightOptions+", HighlightAll=true') AS title_highlight, "+
+				"ts_headline('simple', products.description, "+searchQuery+", '"+highlightOptions+", MaxFragments=2') AS description_highlight",
+			terms, terms, terms, terms).
+			Order("rank DESC, products.id").
+			Offset(offset).Limit(limit).
+			Scan(&hits).Error
+	})
+	return hits, total, err
+}
+
+// Suggestion is an autocomplete suggestion for a search.
+type Suggestion struct {
+	ID    uint   `json:"id"`
+	Title string `json:"title"`
+}
+
+// SuggestProducts returns product titles completing the prefix, preferring
+// titles that start with it, then words that start with it, then titles
+// similar to it.
+func SuggestProducts(db *gorm.DB, prefix string, filters CatalogueFilters, limit int) ([]Suggestion, error) {
+	pattern := escapeLike(prefix) + "%"
+	var suggestions []Suggestion
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := setSimilarityThreshold(tx); err != nil {
+			return err
+		}
+
+		return filters.Apply(tx.Model(&models.Product{}).
+			Where("products.title ILIKE ? OR products.title ILIKE ? OR ? <% products.title", pattern, "% "+pattern, prefix)).
+			Select("products.id, products.title").
+			Clauses(clause.OrderBy{Expression: clause.Expr{
+				SQL:                "products.title ILIKE ? DESC, products.title ILIKE ? DESC, word_similarity(?, products.title) DESC, products.title",
+				Vars:               []interface{}{pattern, "% " + pattern, prefix},
+				WithoutParentheses: true,
+			}}).
+			Limit(limit).
+			Scan(&suggestions).Error
+	})
+	return suggestions, err
+}
+
+func setSimilarityThreshold(tx *gorm.DB) error {
+	threshold := strconv.FormatFloat(SearchSimilarityThreshold, 'f', -1, 64)
+	return tx.Exec("SELECT set_config('pg_trgm.word_similarity_threshold', ?, true)", threshold).Error
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
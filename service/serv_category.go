@@ -1,35 +1,230 @@
-// service.go
-package service
-
-import (
-	"github.com/Pijuyy/testing_project4/models"
-	"gorm.io/gorm"
-)
-
-type CategoryService struct {
-	DB *gorm.DB
-}
-
-func NewCategoryService(db *gorm.DB) *CategoryService {
-	return &CategoryService{
-		DB: db,
-	}
-}
-
-func (s *CategoryService) CreateCategory(category *models.Category) error {
-	return s.DB.Create(category).Error
-}
-
-func (s *CategoryService) GetCategories() ([]models.Category, error) {
-	var categories []models.Category
-	result := s.DB.Preload("Products").Find(&categories)
-	return categories, result.Error
-}
-
-func (s *CategoryService) UpdateCategory(category *models.Category) error {
-	return s.DB.Save(category).Error
-}
-
-func (s *CategoryService) DeleteCategory(category *models.Category) error {
-	return s.DB.Delete(category).Error
-}
+// service.go
+package service
+
+import (
+	"slices"
+
+	"github.com/Pijuyy/testing_project4/models"
+	"gorm.io/gorm"
+)
+
+type CategoryService struct {
+	DB *gorm.DB
+}
+
+func NewCategoryService(db *gorm.DB) *CategoryService {
+	return &CategoryService{
+		DB: db,
+	}
+}
+
+func (s *CategoryService) CreateCategory(category *models.Category) error {
+	return s.DB.Create(category).Error
+}
+
+func (s *CategoryService) GetCategories() ([]models.Category, error) {
+	var categories []models.Category
+	result := s.DB.Preload("Products").Order("id").Find(&categories)
+	return categories, result.Error
+}
+
+// descendantsCTE selects the ids of a category and all categories below it.
+const descendantsCTE = `WITH RECURSIVE subtree AS (
+	SELECT id FROM categories WHERE id = ?
+	UNION
+	SELECT c.id FROM categories c JOIN subtree ON c.parent_id = subtree.id
+)
+SELECT id FROM subtree`
+
+// DescendantIDs returns the id of the category and of every category nested
+// below it, at any depth.
+func (s *CategoryService) DescendantIDs(categoryID uint) ([]uint, error) {
+	var ids []uint
+	err := s.DB.Raw(descendantsCTE, categoryID).Scan(&ids).Error
+	return ids, err
+}
+
+// Ancestors returns the path from the top-level category down to and
+// including the given category.
+func (s *CategoryService) Ancestors(categoryID uint) ([]models.Category, error) {
+	var categories []models.Category
+	err := s.DB.Raw(`WITH RECURSIVE path AS (
+	SELECT categories.*, 0 AS depth FROM categories WHERE id = ?
+	UNION
+	SELECT c.*, path.depth + 1 FROM categories c JOIN path ON c.id = path.parent_id
+)
+SELECT * FROM path ORDER BY depth DESC`, categoryID).Scan(&categories).Error
+	return categories, err
+}
+
+// MoveCategory moves the category, with everything below it, under the given
+// parent, or to the top level when parentID is nil. It must run in a
+// transaction.
+func (s *CategoryService) MoveCategory(category *models.Category, parentID *uint) error {
+	// Serialize moves so two concurrent moves cannot create a cycle together
+	if err := s.DB.Exec("SELECT pg_advisory_xact_lock(hashtext('categories.move'))").Error; err != nil {
+		return err
+	}
+
+	if parentID != nil {
+		var parent models.Category
+		if err := s.DB.First(&parent, *parentID).Error; err != nil {
+			return err
+		}
+
+		subtree, err := s.DescendantIDs(category.ID)
+		if err != nil {
+			return err
+		}
+		if slices.Contains(subtree, *parentID) {
+			return ErrCategoryCycle
+		}
+	}
+
+	result := s.DB.Model(category).Where("version = ?", category.Version).Updates(map[string]interface{}{
+		"parent_id":  parentID,
+		"version":    gorm.Expr("version + 1"),
+		"updated_at": category.UpdatedAt,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrVersionConflict
+	}
+
+	category.ParentID = parentID
+	category.Version++
+	return nil
+}
+
+// SoldProductTotals returns, for every category, the sold product amount of
+// the category and all categories below it. Sold amounts stay with the
+// category a product was sold in, while the roll-up follows the current
+// category tree, so moving a category moves its sales to its new parents.
+func (s *CategoryService) SoldProductTotals() (map[uint]int, error) {
+	var rows []struct {
+		CategoryID uint
+		Total      int
+	}
+	err := s.DB.Raw(`WITH RECURSIVE tree AS (
+	SELECT id AS root_id, id FROM categories
+	UNION
+	SELECT tree.root_id, c.id FROM categories c JOIN tree ON c.parent_id = tree.id
+)
+SELECT tree.root_id AS category_id, COALESCE(SUM(c.sold_product_amount), 0) AS total
+FROM tree JOIN categories c ON c.id = tree.id
+GROUP BY tree.root_id`).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	totals := make(map[uint]int, len(rows))
+	for _, row := range rows {
+		totals[row.CategoryID] = row.Total
+	}
+	return totals, nil
+}
+
+// CategoryTax is the tax charged on a category's sales.
+type CategoryTax struct {
+	// Own is the tax on the sales of the category's own products
+	Own models.Money
+	// Total also includes the categories below it
+	Total models.Money
+}
+
+// TaxTotals returns, for every category with sales in it or below it, the
+// tax charged on the sales of its own products and of all categories below
+// it. Sales count towards the category the product was in when it was sold;
+// like SoldProductTotals, they roll up through the current category tree.
+func (s *CategoryService) TaxTotals() (map[uint]CategoryTax, error) {
+	var rows []struct {
+		CategoryID uint
+		Own        models.Money
+		Total      models.Money
+	}
+	err := s.DB.Raw(`WITH RECURSIVE tree AS (
+	SELECT id AS root_id, id FROM categories
+	UNION
+	SELECT tree.root_id, c.id FROM categories c JOIN tree ON c.parent_id = tree.id
+), own AS (
+	SELECT category_id, SUM(tax_amount) AS tax
+	FROM transaction_histories
+	GROUP BY category_id
+)
+SELECT tree.root_id AS category_id,
+	CAST(COALESCE(SUM(own.tax) FILTER (WHERE own.category_id = tree.root_id), 0) AS bigint) AS own,
+	CAST(COALESCE(SUM(own.tax), 0) AS bigint) AS total
+FROM tree JOIN own ON own.category_id = tree.id
+GROUP BY tree.root_id`).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	totals := make(map[uint]CategoryTax, len(rows))
+	for _, row := range rows {
+		totals[row.CategoryID] = CategoryTax{Own: row.Own, Total: row.Total}
+	}
+	return totals, nil
+}
+
+// SetTaxRate sets the category's tax rate if its version still matches the
+// one that was read, and bumps the version. A nil taxRateID makes the
+// category inherit its parent's rate.
+func (s *CategoryService) SetTaxRate(category *models.Category, taxRateID *uint) error {
+	result := s.DB.Model(category).Where("version = ?", category.Version).Updates(map[string]interface{}{
+		"tax_rate_id": taxRateID,
+		"version":     gorm.Expr("version + 1"),
+		"updated_at":  category.UpdatedAt,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrVersionConflict
+	}
+
+	category.TaxRateID = taxRateID
+	category.Version++
+	return nil
+}
+
+// UpdateCategory writes the category's type if its version still matches the
+// one that was read, and bumps the version. Sold amounts are left alone so
+// concurrent purchases are never overwritten.
+func (s *CategoryService) UpdateCategory(category *models.Category) error {
+	result := s.DB.Model(category).Where("version = ?", category.Version).Updates(map[string]interface{}{
+		"type":    category.Type,
+		"version": gorm.Expr("version + 1"),
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrVersionConflict
+	}
+
+	category.Version++
+	return nil
+}
+
+// DeleteCategory deletes the category if its version still matches the one
+// that was read.
+func (s *CategoryService) DeleteCategory(category *models.Category) error {
+	result := s.DB.Where("version = ?", category.Version).Delete(category)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrVersionConflict
+	}
+
+	return nil
+}
+
+// AddSoldProducts atomically increases the sold product amount of a category.
+func (s *CategoryService) AddSoldProducts(categoryID uint, quantity int) error {
+	return s.DB.Model(&models.Category{}).Where("id = ?", categoryID).
+		Update("sold_product_amount", gorm.Expr("sold_product_amount + ?", quantity)).Error
+}
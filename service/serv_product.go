@@ -0,0 +1,211 @@
+package service
+
+import (
+	"github.com/Pijuyy/testing_project4/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UpdateProduct writes the editable fields of a product, but only if its
+// version still matches the one that was read, and bumps the version. Stock
+// is not written here; it only changes through ApplyStockChange.
+func UpdateProduct(tx *gorm.DB, product *models.Product) error {
+	result := tx.Model(product).Where("version = ?", product.Version).Updates(map[string]interface{}{
+		"title":       product.Title,
+		"price":       product.Price,
+		"category_id": product.CategoryID,
+		"version":     gorm.Expr("version + 1"),
+
+		"low_stock_threshold": product.LowStockThreshold,
+		"sku":                 product.SKU,
+		"description":         product.Description,
+		"weight_grams":        product.WeightGrams,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrVersionConflict
+	}
+
+	product.Version++
+	return nil
+}
+
+// CreateProduct creates a product and places its initial stock in the given
+// warehouse, recording it as the product's first inventory movement.
+func CreateProduct(tx *gorm.DB, product *models.Product, warehouseID uint, actorID *uint) error {
+	if err := tx.Create(product).Error; err != nil {
+		return err
+	}
+
+	level := models.WarehouseStock{
+		WarehouseID: warehouseID,
+		ProductID:   product.ID,
+		Quantity:    product.Stock,
+	}
+	if err := tx.Create(&level).Error; err != nil {
+		return err
+	}
+
+	movement := models.InventoryMovement{
+		ProductID:   product.ID,
+		WarehouseID: &warehouseID,
+		Type:        models.MovementRestock,
+		Quantity:    product.Stock,
+		StockAfter:  product.Stock,
+		Reason:      "initial stock",
+		ActorID:     actorID,
+	}
+	return tx.Create(&movement).Error
+}
+
+// SKUTaken reports whether a variant or another product than excludeID
+// already uses the SKU. SKUs are unique across products and variants.
+func SKUTaken(tx *gorm.DB, sku *string, excludeID uint) (bool, error) {
+	if sku == nil {
+		return false, nil
+	}
+
+	var count int64
+	err := tx.Model(&models.Product{}).Where("sku = ? AND id <> ?", *sku, excludeID).Count(&count).Error
+	if err != nil || count > 0 {
+		return count > 0, err
+	}
+	err = tx.Model(&models.ProductVariant{}).Where("sku = ?", *sku).Count(&count).Error
+	return count > 0, err
+}
+
+// VariantSKUTaken reports whether a product or another variant than
+// excludeID already uses the SKU.
+func VariantSKUTaken(tx *gorm.DB, sku string, excludeID uint) (bool, error) {
+	var count int64
+	err := tx.Model(&models.ProductVariant{}).Where("sku = ? AND id <> ?", sku, excludeID).Count(&count).Error
+	if err != nil || count > 0 {
+		return count > 0, err
+	}
+	err = tx.Model(&models.Product{}).Where("sku = ?", sku).Count(&count).Error
+	return count > 0, err
+}
+
+// HasVariants reports whether the product is sold through variants.
+func HasVariants(tx *gorm.DB, productID uint) (bool, error) {
+	var count int64
+	err := tx.Model(&models.ProductVariant{}).Where("product_id = ?", productID).Count(&count).Error
+	return count > 0, err
+}
+
+// AvailableToSell returns how many items of the product can be bought: the
+// unreserved stock of its variants, or of the product itself when it has none.
+func AvailableToSell(tx *gorm.DB, productID uint) (int, error) {
+	hasVariants, err := HasVariants(tx, productID)
+	if err != nil {
+		return 0, err
+	}
+
+	query := tx.Model(&models.Product{}).Where("id = ?", productID)
+	if hasVariants {
+		query = tx.Model(&models.ProductVariant{}).Where("product_id = ?", productID)
+	}
+	var available int
+	err = query.Select("COALESCE(SUM(GREATEST(stock - reserved, 0)), 0)").Scan(&available).Error
+	return available, err
+}
+
+// CreateVariant creates a variant. Products with variants can only be sold
+// through them, so the first variant takes over the stock and reservations
+// of the product itself. It must run in a transaction.
+func CreateVariant(tx *gorm.DB, variant *models.ProductVariant, actorID *uint) error {
+	// Lock the product so two first variants cannot both take over its stock
+	var product models.Product
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "stock").First(&product, variant.ProductID).Error
+	if err != nil {
+		return err
+	}
+	hasVariants, err := HasVariants(tx, product.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Create(variant).Error; err != nil {
+		return err
+	}
+	if hasVariants {
+		return nil
+	}
+
+	// The stock moves between the product and the variant at each warehouse,
+	// which is recorded like a transfer
+	var levels []models.WarehouseStock
+	if err := tx.Where("product_id = ? AND variant_id = 0 AND quantity > 0", product.ID).Find(&levels).Error; err != nil {
+		return err
+	}
+	for _, level := range levels {
+		if err := tx.Model(&level).Update("variant_id", variant.ID).Error; err != nil {
+			return err
+		}
+		for _, movement := range []models.InventoryMovement{
+			{VariantID: nil, Quantity: -level.Quantity},
+			{VariantID: &variant.ID, Quantity: level.Quantity},
+		} {
+			movement.ProductID = product.ID
+			movement.WarehouseID = &level.WarehouseID
+			movement.Type = models.MovementTransfer
+			movement.StockAfter = product.Stock
+			movement.Reason = "moved to the first variant"
+			movement.ActorID = actorID
+			if err := tx.Create(&movement).Error; err != nil {
+				return err
+			}
+		}
+		variant.Stock += level.Quantity
+	}
+
+	var reserved int
+	err = tx.Model(&models.Reservation{}).
+		Where("product_id = ? AND variant_id IS NULL AND status = ?", product.ID, models.ReservationActive).
+		Select("COALESCE(SUM(quantity), 0)").Scan(&reserved).Error
+	if err != nil {
+		return err
+	}
+	if reserved > 0 {
+		err := tx.Model(&models.Reservation{}).
+			Where("product_id = ? AND variant_id IS NULL AND status = ?", product.ID, models.ReservationActive).
+			Update("variant_id", variant.ID).Error
+		if err != nil {
+			return err
+		}
+		variant.Reserved = reserved
+	}
+
+	if variant.Stock == 0 && variant.Reserved == 0 {
+		return nil
+	}
+	return tx.Model(variant).Updates(map[string]interface{}{
+		"stock":    variant.Stock,
+		"reserved": variant.Reserved,
+	}).Error
+}
+
+// UpdateVariant writes the editable fields of a variant if its version still
+// matches the one that was read, and bumps the version. Like products, its
+// stock only changes through ApplyStockChange.
+func UpdateVariant(tx *gorm.DB, variant *models.ProductVariant) error {
+	result := tx.Model(variant).Where("version = ?", variant.Version).Updates(map[string]interface{}{
+		"sku":                   variant.SKU,
+		"options":               variant.Options,
+		"price_override":        variant.PriceOverride,
+		"weight_grams_override": variant.WeightGramsOverride,
+		"updated_at":            variant.UpdatedAt,
+		"version":               gorm.Expr("version + 1"),
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrVersionConflict
+	}
+
+	variant.Version++
+	return nil
+}
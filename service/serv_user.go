@@ -0,0 +1,64 @@
+package service
+
+import (
+	"github.com/Pijuyy/testing_project4/models"
+	"gorm.io/gorm"
+)
+
+// DebitBalance atomically subtracts amount, which must be in the currency of
+// the user's wallet, from a user's balance, failing with
+// ErrInsufficientBalance instead of going below zero.
+func DebitBalance(tx *gorm.DB, userID uint, amount models.Money) error {
+	result := tx.Model(&models.User{}).Where("id = ? AND balance >= ?", userID, amount.Amount).
+		Update("balance", gorm.Expr("balance - ?", amount.Amount))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInsufficientBalance
+	}
+
+	return nil
+}
+
+// CreditBalance atomically adds amount, which must be in the currency of the
+// user's wallet, to a user's balance, failing with ErrBalanceLimit instead of
+// going over models.MaxBalance.
+func CreditBalance(tx *gorm.DB, userID uint, amount models.Money) error {
+	result := tx.Model(&models.User{}).Where("id = ? AND balance + ? <= ?", userID, amount.Amount, models.MaxBalance).
+		Update("balance", gorm.Expr("balance + ?", amount.Amount))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrBalanceLimit
+	}
+
+	return nil
+}
+
+// KeepSuperAdmin fails with ErrLastSuperAdmin when the user is the last active
+// super admin, whose role or status must then not change. It must run in a
+// transaction.
+func KeepSuperAdmin(tx *gorm.DB, user *models.User) error {
+	if user.Role != models.RoleSuperAdmin || user.Status != models.UserStatusActive {
+		return nil
+	}
+
+	// Serialize the check so two super admins cannot demote each other at once
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('users.super_admin'))").Error; err != nil {
+		return err
+	}
+
+	var others int64
+	err := tx.Model(&models.User{}).
+		Where("role = ? AND status = ? AND id <> ?", models.RoleSuperAdmin, models.UserStatusActive, user.ID).
+		Count(&others).Error
+	if err != nil {
+		return err
+	}
+	if others == 0 {
+		return ErrLastSuperAdmin
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Pijuyy/testing_project4/models"
+)
+
+func TestCreditBalanceLimit(t *testing.T) {
+	db := testDB(t)
+	user := models.User{
+		FullName: "Test customer",
+		Email:    fmt.Sprintf("topup-%d@example.com", time.Now().UnixNano()),
+		Password: "not a real hash",
+		Role:     models.RoleCustomer,
+		Balance:  models.Rupiah(models.MaxBalance - 1000),
+	}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CreditBalance(db, user.ID, models.Rupiah(1001)); !errors.Is(err, ErrBalanceLimit) {
+		t.Errorf("credit over the limit: error = %v, want ErrBalanceLimit", err)
+	}
+	if err := CreditBalance(db, user.ID, models.Rupiah(1000)); err != nil {
+		t.Errorf("credit up to the limit: %v", err)
+	}
+
+	if err := db.First(&user, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if user.Balance.Amount != models.MaxBalance {
+		t.Errorf("balance = %d, want %d", user.Balance.Amount, models.MaxBalance)
+	}
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/Pijuyy/testing_project4/models"
+)
+
+// ShippingRequest is what a shipping cost is quoted for.
+type ShippingRequest struct {
+	Address     models.Address
+	WeightGrams int
+	// Subtotal is the price of the goods after discounts
+	Subtotal models.Money
+}
+
+// ShippingRateStrategy quotes the cost of shipping an order. The quote is in
+// the currency of the order's subtotal.
+type ShippingRateStrategy interface {
+	Name() string
+	Quote(request ShippingRequest) (models.Money, error)
+}
+
+// FlatRate charges the same amount for every order.
+type FlatRate struct {
+	Amount models.Money
+}
+
+func (FlatRate) Name() string { return "flat" }
+
+func (s FlatRate) Quote(request ShippingRequest) (models.Money, error) {
+	return s.Amount, nil
+}
+
+// WeightBasedRate charges a base amount plus an amount per started kilogram.
+type WeightBasedRate struct {
+	Base  models.Money
+	PerKg models.Money
+}
+
+func (WeightBasedRate) Name() string { return "weight" }
+
+func (s WeightBasedRate) Quote(request ShippingRequest) (models.Money, error) {
+	kilograms := (int64(request.WeightGrams) + 999) / 1000
+	perKg, err := s.PerKg.Mul(kilograms)
+	if err != nil {
+		return models.Money{}, err
+	}
+	return s.Base.Add(perKg)
+}
+
+// FreeOverThreshold ships orders whose subtotal reaches the threshold for
+// free and quotes the others with the fallback strategy.
+type FreeOverThreshold struct {
+	Threshold models.Money
+	Fallback  ShippingRateStrategy
+}
+
+func (s FreeOverThreshold) Name() string { return "free_over:" + s.Fallback.Name() }
+
+func (s FreeOverThreshold) Quote(request ShippingRequest) (models.Money, error) {
+	remaining, err := s.Threshold.Sub(request.Subtotal)
+	if err != nil {
+		return models.Money{}, err
+	}
+	if remaining.Amount <= 0 {
+		return models.NewMoney(0, request.Subtotal.Currency), nil
+	}
+	return s.Fallback.Quote(request)
+}
+
+// DefaultShippingStrategy quotes shipping at checkout. It is read from
+// SHIPPING_STRATEGY, one of flat, weight or free_over, and defaults to flat.
+// The amounts, in rupiah, come from SHIPPING_FLAT_RATE, SHIPPING_BASE_RATE,
+// SHIPPING_RATE_PER_KG and SHIPPING_FREE_THRESHOLD; free_over charges the
+// flat rate below the threshold.
+var DefaultShippingStrategy ShippingRateStrategy = shippingStrategyFromEnv()
+
+func shippingStrategyFromEnv() ShippingRateStrategy {
+	flat := FlatRate{Amount: rupiahFromEnv("SHIPPING_FLAT_RATE", 10000)}
+
+	switch strategy := os.Getenv("SHIPPING_STRATEGY"); strategy {
+	case "", "flat":
+		return flat
+	case "weight":
+		return WeightBasedRate{
+			Base:  rupiahFromEnv("SHIPPING_BASE_RATE", 5000),
+			PerKg: rupiahFromEnv("SHIPPING_RATE_PER_KG", 5000),
+		}
+	case "free_over":
+		return FreeOverThreshold{
+			Threshold: rupiahFromEnv("SHIPPING_FREE_THRESHOLD", 250000),
+			Fallback:  flat,
+		}
+	default:
+		log.Printf("unknown SHIPPING_STRATEGY %q, using flat", strategy)
+		return flat
+	}
+}
+
+func rupiahFromEnv(name string, fallback int64) models.Money {
+	value := os.Getenv(name)
+	if value == "" {
+		return models.Rupiah(fallback)
+	}
+
+	amount, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || amount < 0 {
+		log.Printf("invalid %s %q, using %d", name, value, fallback)
+		return models.Rupiah(fallback)
+	}
+	return models.Rupiah(amount)
+}
+
+// PickupMethod is the shipping method of orders that are picked up instead
+// of shipped. Picking up is free.
+const PickupMethod = "pickup"
+
+// ApplyShipping quotes shipping the transaction's goods to the address with
+// DefaultShippingStrategy and records the address and the cost on it. A nil
+// address makes the order a pickup. The total price is set by ApplyTax
+// afterwards.
+func ApplyShipping(transaction *models.TransactionHistory, address *models.Address, weightGrams int) error {
+	subtotal, err := transaction.Subtotal.Sub(transaction.Discount)
+	if err != nil {
+		return err
+	}
+
+	if address == nil {
+		transaction.ShippingAddressID = nil
+		transaction.ShippingAddress = ""
+		transaction.ShippingMethod = PickupMethod
+		transaction.ShippingCost = models.NewMoney(0, subtotal.Currency)
+		return nil
+	}
+
+	cost, err := DefaultShippingStrategy.Quote(ShippingRequest{
+		Address:     *address,
+		WeightGrams: weightGrams,
+		Subtotal:    subtotal,
+	})
+	if err != nil {
+		return err
+	}
+
+	transaction.ShippingAddressID = &address.ID
+	transaction.ShippingAddress = address.Format()
+	transaction.ShippingMethod = DefaultShippingStrategy.Name()
+	transaction.ShippingCost = cost
+	return nil
+}
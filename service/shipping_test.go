@@ -0,0 +1,76 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/Pijuyy/testing_project4/models"
+)
+
+func TestShippingStrategies(t *testing.T) {
+	flat := FlatRate{Amount: models.Rupiah(10000)}
+	weight := WeightBasedRate{Base: models.Rupiah(5000), PerKg: models.Rupiah(4000)}
+	freeOver := FreeOverThreshold{Threshold: models.Rupiah(250000), Fallback: weight}
+
+	tests := []struct {
+		name     string
+		strategy ShippingRateStrategy
+		grams    int
+		subtotal int64
+		want     int64
+	}{
+		{"flat", flat, 12000, 50000, 10000},
+		{"weight without weight", weight, 0, 50000, 5000},
+		{"weight of one gram", weight, 1, 50000, 9000},
+		{"weight of a kilogram", weight, 1000, 50000, 9000},
+		{"weight over a kilogram", weight, 1001, 50000, 13000},
+		{"below the threshold", freeOver, 2500, 249999, 17000},
+		{"at the threshold", freeOver, 2500, 250000, 0},
+		{"over the threshold", freeOver, 2500, 1000000, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.strategy.Quote(ShippingRequest{WeightGrams: tt.grams, Subtotal: models.Rupiah(tt.subtotal)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Amount != tt.want {
+				t.Errorf("Quote = %d, want %d", got.Amount, tt.want)
+			}
+		})
+	}
+
+	if got := freeOver.Name(); got != "free_over:weight" {
+		t.Errorf("Name = %s, want free_over:weight", got)
+	}
+}
+
+func TestApplyShipping(t *testing.T) {
+	defer func(strategy ShippingRateStrategy) { DefaultShippingStrategy = strategy }(DefaultShippingStrategy)
+	DefaultShippingStrategy = FreeOverThreshold{
+		Threshold: models.Rupiah(100000),
+		Fallback:  FlatRate{Amount: models.Rupiah(10000)},
+	}
+
+	// The threshold is compared with the subtotal after the discount
+	transaction := models.TransactionHistory{Subtotal: models.Rupiah(105000), Discount: models.Rupiah(10000)}
+	address := &models.Address{ID: 7, RecipientName: "Budi", Line1: "Jl. Merdeka 1", City: "Bandung", CountryCode: "ID"}
+	if err := ApplyShipping(&transaction, address, 500); err != nil {
+		t.Fatal(err)
+	}
+	if transaction.ShippingCost != models.Rupiah(10000) || transaction.ShippingMethod != "free_over:flat" {
+		t.Errorf("shipping %+v by %s, want 10000 by free_over:flat", transaction.ShippingCost, transaction.ShippingMethod)
+	}
+	if transaction.ShippingAddressID == nil || *transaction.ShippingAddressID != 7 || transaction.ShippingAddress != address.Format() {
+		t.Errorf("address %v %q", transaction.ShippingAddressID, transaction.ShippingAddress)
+	}
+
+	// Without an address the order is picked up for free
+	if err := ApplyShipping(&transaction, nil, 500); err != nil {
+		t.Fatal(err)
+	}
+	if transaction.ShippingCost != models.Rupiah(0) || transaction.ShippingMethod != PickupMethod ||
+		transaction.ShippingAddressID != nil || transaction.ShippingAddress != "" {
+		t.Errorf("pickup = %+v", transaction)
+	}
+}
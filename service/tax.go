@@ -0,0 +1,133 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"os"
+
+	"github.com/Pijuyy/testing_project4/models"
+	"gorm.io/gorm"
+)
+
+// Tax pricing modes deciding whether prices include tax.
+const (
+	// TaxInclusive prices include the tax, which is worked out of them.
+	TaxInclusive = "inclusive"
+	// TaxExclusive prices exclude the tax, which is added at checkout.
+	TaxExclusive = "exclusive"
+)
+
+// TaxPricingMode is read from TAX_PRICING_MODE and defaults to TaxInclusive.
+var TaxPricingMode = taxPricingModeFromEnv()
+
+func taxPricingModeFromEnv() string {
+	switch mode := os.Getenv("TAX_PRICING_MODE"); mode {
+	case "", TaxInclusive:
+		return TaxInclusive
+	case TaxExclusive:
+		return TaxExclusive
+	default:
+		log.Printf("unknown TAX_PRICING_MODE %q, using %s", mode, TaxInclusive)
+		return TaxInclusive
+	}
+}
+
+// ErrTaxRateInUse is returned when deleting a tax rate categories still use.
+var ErrTaxRateInUse = errors.New("the tax rate is used by categories")
+
+// TaxRateFor returns the tax rate of products in the category: its own, the
+// nearest ancestor's, or else the default rate. It is nil when none applies.
+func TaxRateFor(tx *gorm.DB, categoryID uint) (*models.TaxRate, error) {
+	path, err := NewCategoryService(tx).Ancestors(categoryID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := tx.Where("is_default = ?", true)
+	for i := len(path) - 1; i >= 0; i-- {
+		if path[i].TaxRateID != nil {
+			query = tx.Where("id = ?", *path[i].TaxRateID)
+			break
+		}
+	}
+
+	var rate models.TaxRate
+	err = query.First(&rate).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &rate, err
+}
+
+// ApplyTax works out the transaction's tax from its subtotal and discount at
+// the rate, and sets its total price, which includes the shipping cost set
+// before. Without a rate no tax is charged.
+func ApplyTax(transaction *models.TransactionHistory, rate *models.TaxRate) error {
+	net, err := transaction.Subtotal.Sub(transaction.Discount)
+	if err != nil {
+		return err
+	}
+
+	transaction.TaxRateID, transaction.TaxName, transaction.TaxBasisPoints = nil, "", 0
+	transaction.TaxAmount = models.NewMoney(0, net.Currency)
+	transaction.TaxExclusive = TaxPricingMode == TaxExclusive
+	if rate != nil {
+		transaction.TaxRateID, transaction.TaxName, transaction.TaxBasisPoints = &rate.ID, rate.Name, rate.BasisPoints
+		if transaction.TaxAmount, err = rate.Tax(net, transaction.TaxExclusive); err != nil {
+			return err
+		}
+	}
+
+	transaction.TotalPrice, err = transaction.ExpectedTotal()
+	return err
+}
+
+// SaveTaxRate creates or updates the tax rate. When it becomes the default
+// rate, the previous default stops being one. It must run in a transaction.
+func SaveTaxRate(tx *gorm.DB, rate *models.TaxRate) error {
+	if rate.IsDefault {
+		// Serialize changes of the default so there is never more than one
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('tax_rates.default'))").Error; err != nil {
+			return err
+		}
+		err := tx.Model(&models.TaxRate{}).Where("is_default = ? AND id <> ?", true, rate.ID).
+			Update("is_default", false).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	if rate.ID == 0 {
+		return tx.Create(rate).Error
+	}
+
+	result := tx.Model(rate).Where("version = ?", rate.Version).Updates(map[string]interface{}{
+		"name":         rate.Name,
+		"basis_points": rate.BasisPoints,
+		"is_default":   rate.IsDefault,
+		"version":      gorm.Expr("version + 1"),
+		"updated_at":   rate.UpdatedAt,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrVersionConflict
+	}
+
+	rate.Version++
+	return nil
+}
+
+// DeleteTaxRate deletes a tax rate no category uses. Past transactions keep
+// its name and rate.
+func DeleteTaxRate(tx *gorm.DB, rate *models.TaxRate) error {
+	var count int64
+	if err := tx.Model(&models.Category{}).Where("tax_rate_id = ?", rate.ID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrTaxRateInUse
+	}
+	return tx.Delete(rate).Error
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/Pijuyy/testing_project4/models"
+)
+
+func TestApplyTax(t *testing.T) {
+	defer func(mode string) { TaxPricingMode = mode }(TaxPricingMode)
+	rate := &models.TaxRate{ID: 1, Name: "PPN", BasisPoints: 1100}
+
+	tests := []struct {
+		mode  string
+		rate  *models.TaxRate
+		tax   int64
+		total int64
+	}{
+		// 100,000 - 10,000 = 90,000 includes 8,918.92 tax
+		{TaxInclusive, rate, 8919, 105000},
+		// 90,000 * 11% is 9,900 on top
+		{TaxExclusive, rate, 9900, 114900},
+		{TaxExclusive, nil, 0, 105000},
+	}
+
+	for _, tt := range tests {
+		TaxPricingMode = tt.mode
+		transaction := models.TransactionHistory{
+			Subtotal:     models.Rupiah(100000),
+			Discount:     models.Rupiah(10000),
+			ShippingCost: models.Rupiah(15000),
+		}
+		if err := ApplyTax(&transaction, tt.rate); err != nil {
+			t.Fatal(err)
+		}
+
+		if transaction.TaxAmount != models.Rupiah(tt.tax) || transaction.TotalPrice != models.Rupiah(tt.total) {
+			t.Errorf("%s: tax %d, total %d, want %d and %d", tt.mode,
+				transaction.TaxAmount.Amount, transaction.TotalPrice.Amount, tt.tax, tt.total)
+		}
+		if transaction.TaxExclusive != (tt.mode == TaxExclusive) {
+			t.Errorf("%s: TaxExclusive = %v", tt.mode, transaction.TaxExclusive)
+		}
+		if (transaction.TaxRateID != nil) != (tt.rate != nil) || tt.rate != nil && transaction.TaxBasisPoints != 1100 {
+			t.Errorf("%s: rate %v, basis points %d", tt.mode, transaction.TaxRateID, transaction.TaxBasisPoints)
+		}
+	}
+}
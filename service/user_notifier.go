@@ -0,0 +1,68 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/Pijuyy/testing_project4/models"
+	"gorm.io/gorm"
+)
+
+// UserNotifier delivers notifications to users. It is called inside the
+// transaction that caused the notification, so implementations that store
+// notifications commit or roll back along with it.
+type UserNotifier interface {
+	NotifyUsers(tx *gorm.DB, userIDs []uint, notification models.Notification) error
+}
+
+// InboxNotifier stores notifications in the users' in-app inbox.
+type InboxNotifier struct{}
+
+func (InboxNotifier) NotifyUsers(tx *gorm.DB, userIDs []uint, notification models.Notification) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	notifications := make([]models.Notification, 0, len(userIDs))
+	for _, userID := range userIDs {
+		n := notification
+		n.UserID = userID
+		notifications = append(notifications, n)
+	}
+	return tx.Create(&notifications).Error
+}
+
+// DefaultUserNotifier is used to notify users, e.g. of wishlisted products
+// coming back in stock.
+var DefaultUserNotifier UserNotifier = InboxNotifier{}
+
+// NotifyBackInStock tells the users who wishlisted a product that it is
+// available again when added items, e.g. restocked or released from a
+// reservation, take what can be bought of it from zero to above zero. It must
+// run after the change, while the product row is still locked by it.
+func NotifyBackInStock(tx *gorm.DB, productID uint, added int) error {
+	if added <= 0 {
+		return nil
+	}
+	available, err := AvailableToSell(tx, productID)
+	if err != nil || available <= 0 || available-added > 0 {
+		return err
+	}
+
+	var userIDs []uint
+	err = tx.Model(&models.WishlistItem{}).Where("product_id = ?", productID).Order("user_id").Pluck("user_id", &userIDs).Error
+	if err != nil || len(userIDs) == 0 {
+		return err
+	}
+
+	var product models.Product
+	if err := tx.Select("id", "title").First(&product, productID).Error; err != nil {
+		return err
+	}
+
+	return DefaultUserNotifier.NotifyUsers(tx, userIDs, models.Notification{
+		Type:      models.NotificationBackInStock,
+		Title:     fmt.Sprintf("%s is back in stock", product.Title),
+		Body:      fmt.Sprintf("%s from your wishlist is available again.", product.Title),
+		ProductID: &product.ID,
+	})
+}
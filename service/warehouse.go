@@ -0,0 +1,141 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"os"
+
+	"github.com/Pijuyy/testing_project4/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Allocation strategies deciding which warehouses a sale ships from.
+const (
+	// AllocationPriority drains warehouses in priority order.
+	AllocationPriority = "priority"
+	// AllocationMostStock ships from the warehouses holding the most stock.
+	AllocationMostStock = "most_stock"
+)
+
+// AllocationStrategy is read from ALLOCATION_STRATEGY and defaults to
+// AllocationPriority.
+var AllocationStrategy = allocationStrategyFromEnv()
+
+func allocationStrategyFromEnv() string {
+	switch strategy := os.Getenv("ALLOCATION_STRATEGY"); strategy {
+	case "", AllocationPriority:
+		return AllocationPriority
+	case AllocationMostStock:
+		return AllocationMostStock
+	default:
+		log.Printf("unknown ALLOCATION_STRATEGY %q, using %s", strategy, AllocationPriority)
+		return AllocationPriority
+	}
+}
+
+// ErrWarehouseNotFound is returned when a warehouse does not exist or is inactive.
+var ErrWarehouseNotFound = errors.New("Warehouse not found")
+
+// Allocation is the quantity of a sale taken from one warehouse.
+type Allocation struct {
+	WarehouseID uint
+	Quantity    int
+}
+
+// FindWarehouse returns the active warehouse with the given ID, or the
+// default warehouse (the active one with the lowest priority) when id is 0.
+func FindWarehouse(tx *gorm.DB, id uint) (*models.Warehouse, error) {
+	query := tx.Where("active = ?", true)
+	if id != 0 {
+		query = query.Where("id = ?", id)
+	}
+
+	var warehouse models.Warehouse
+	err := query.Order("priority, id").First(&warehouse).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrWarehouseNotFound
+	}
+	return &warehouse, err
+}
+
+// AllocateStock picks the warehouses that together hold quantity items of a
+// product, or of one of its variants when variantID is not nil, ordered by
+// the given strategy. The chosen stock levels stay locked
+// until the transaction ends, so they can be applied without racing other
+// sales. It fails with ErrInsufficientStock when the active warehouses do not
+// hold enough.
+func AllocateStock(tx *gorm.DB, productID uint, variantID *uint, quantity int, strategy string) ([]Allocation, error) {
+	order := "warehouses.priority, warehouses.id"
+	if strategy == AllocationMostStock {
+		order = "warehouse_stocks.quantity DESC, " + order
+	}
+
+	var levels []models.WarehouseStock
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE", Table: clause.Table{Name: "warehouse_stocks"}}).
+		Select("warehouse_stocks.*").
+		Joins("JOIN warehouses ON warehouses.id = warehouse_stocks.warehouse_id AND warehouses.active").
+		Where("warehouse_stocks.product_id = ? AND warehouse_stocks.variant_id = ? AND warehouse_stocks.quantity > 0",
+			productID, variantIDOrZero(variantID)).
+		Order(order).
+		Find(&levels).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var allocations []Allocation
+	remaining := quantity
+	for _, level := range levels {
+		if remaining == 0 {
+			break
+		}
+		take := min(level.Quantity, remaining)
+		allocations = append(allocations, Allocation{WarehouseID: level.WarehouseID, Quantity: take})
+		remaining -= take
+	}
+	if remaining > 0 {
+		return nil, ErrInsufficientStock
+	}
+
+	return allocations, nil
+}
+
+// TransferStock moves stock of a product between two active warehouses and
+// records the transfer. The product's total stock is unchanged.
+func TransferStock(tx *gorm.DB, transfer *models.StockTransfer) error {
+	for _, id := range []uint{transfer.FromWarehouseID, transfer.ToWarehouseID} {
+		if _, err := FindWarehouse(tx, id); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Create(transfer).Error; err != nil {
+		return err
+	}
+
+	legs := []StockChange{
+		{WarehouseID: transfer.FromWarehouseID, Quantity: -transfer.Quantity},
+		{WarehouseID: transfer.ToWarehouseID, Quantity: transfer.Quantity},
+	}
+	for _, leg := range legs {
+		leg.ProductID = transfer.ProductID
+		leg.VariantID = transfer.VariantID
+		leg.Type = models.MovementTransfer
+		leg.Reason = transfer.Reason
+		leg.ActorID = &transfer.ActorID
+		if _, err := ApplyStockChange(tx, leg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// variantIDOrZero returns the variant ID used by warehouse stock levels, where
+// 0 stands for the product itself.
+func variantIDOrZero(variantID *uint) uint {
+	if variantID == nil {
+		return 0
+	}
+	return *variantID
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Pijuyy/testing_project4/models"
+)
+
+func TestAllocateStock(t *testing.T) {
+	db := testDB(t)
+	product := createTestProduct(t, db, 111)
+
+	var warehouses []models.Warehouse
+	for i, quantity := range []int{3, 8, 100} {
+		warehouse := models.Warehouse{Code: fmt.Sprintf("T%d-%d", time.Now().UnixNano(), i), Name: "Test", Priority: i + 1, Active: true}
+		if err := db.Create(&warehouse).Error; err != nil {
+			t.Fatal(err)
+		}
+		level := models.WarehouseStock{WarehouseID: warehouse.ID, ProductID: product.ID, Quantity: quantity}
+		if err := db.Create(&level).Error; err != nil {
+			t.Fatal(err)
+		}
+		warehouses = append(warehouses, warehouse)
+	}
+	// Stock in inactive warehouses can't be allocated
+	if err := db.Model(&warehouses[2]).Update("active", false).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	first, second := warehouses[0].ID, warehouses[1].ID
+	tests := []struct {
+		strategy string
+		quantity int
+		want     []Allocation
+		err      error
+	}{
+		{AllocationPriority, 5, []Allocation{{first, 3}, {second, 2}}, nil},
+		{AllocationMostStock, 5, []Allocation{{second, 5}}, nil},
+		{AllocationMostStock, 10, []Allocation{{second, 8}, {first, 2}}, nil},
+		{AllocationPriority, 12, nil, ErrInsufficientStock},
+	}
+
+	for _, tt := range tests {
+		got, err := AllocateStock(db, product.ID, nil, tt.quantity, tt.strategy)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s %d: error = %v, want %v", tt.strategy, tt.quantity, err, tt.err)
+		} else if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s %d: allocations = %v, want %v", tt.strategy, tt.quantity, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLocalStorageHandler(t *testing.T) {
+	s := NewLocalStorage(t.TempDir(), "/media")
+	if err := s.Put(context.Background(), "products/1/a.png", []byte("image"), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/media/products/1/a.png", http.StatusOK},
+		{"/media/products/1/", http.StatusNotFound},
+		{"/media/products/", http.StatusNotFound},
+		{"/media/", http.StatusNotFound},
+		{"/media/products/1/missing.png", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rec.Code != tt.want {
+			t.Errorf("GET %s = %d, want %d", tt.path, rec.Code, tt.want)
+		}
+	}
+}
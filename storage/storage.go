@@ -0,0 +1,73 @@
+// Package storage stores uploaded files such as product images.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Storage saves files under keys like "products/1/abc.jpg" and knows the
+// public URL they are served from.
+type Storage interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Delete(ctx context.Context, key string) error
+	URL(key string) string
+}
+
+// ErrInvalidKey is returned for keys that are empty or escape the storage root.
+var ErrInvalidKey = errors.New("invalid storage key")
+
+// validKey reports whether key is a relative, slash separated path without
+// "." or ".." segments.
+func validKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") {
+		return false
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// FromEnv builds the storage configured by STORAGE_BACKEND, "local" (the
+// default) or "s3".
+//
+// The local backend writes to STORAGE_DIR (default "uploads") and serves
+// files under STORAGE_URL_PREFIX (default "/media").
+//
+// The s3 backend talks to any S3-compatible service using path-style URLs,
+// configured through S3_ENDPOINT, S3_REGION, S3_BUCKET, S3_ACCESS_KEY_ID,
+// S3_SECRET_ACCESS_KEY and optionally S3_PUBLIC_URL.
+func FromEnv() (Storage, error) {
+	switch backend := os.Getenv("STORAGE_BACKEND"); backend {
+	case "", "local":
+		return NewLocalStorage(getenv("STORAGE_DIR", "uploads"), getenv("STORAGE_URL_PREFIX", "/media")), nil
+	case "s3":
+		s3 := &S3Storage{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          getenv("S3_REGION", "us-east-1"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			PublicURL:       os.Getenv("S3_PUBLIC_URL"),
+		}
+		if s3.Endpoint == "" || s3.Bucket == "" || s3.AccessKeyID == "" || s3.SecretAccessKey == "" {
+			return nil, errors.New("S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY are required")
+		}
+		return s3, nil
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_BACKEND %q", backend)
+	}
+}
+
+func getenv(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}